@@ -1,6 +1,6 @@
 import { useState, useEffect, useCallback } from 'react'
 import { Save, Square, HardDrive } from 'lucide-react'
-import { api, type DisplayInfo, type EncoderInfo, type Config, type State } from '@/lib/wails'
+import { api, isCapturing, type DisplayInfo, type EncoderInfo, type Config, type State } from '@/lib/wails'
 import { formatTime, formatBufferDisplay, getBufferUnit, formatError, cn } from '@/lib/utils'
 
 // Components
@@ -107,14 +107,14 @@ function App() {
             setState(s)
 
             // Auto-close config panel when recording starts (e.g. via shortcut)
-            if (s.status === 'recording' && configOpen) {
+            if (isCapturing(s.status) && configOpen) {
                 setConfigOpen(false)
             }
         })
 
         // Poll for buffer usage when recording
         let interval: NodeJS.Timeout
-        if (state.status === 'recording') {
+        if (isCapturing(state.status)) {
             interval = setInterval(async () => {
                 try {
                     const s = await api.getState()
@@ -184,7 +184,7 @@ function App() {
         }
     }, [])
 
-    const isRecording = state.status === 'recording'
+    const isRecording = isCapturing(state.status)
 
     if (loading) {
         return (
@@ -45,6 +45,16 @@ export function ClipsDrawer() {
         }
     }
 
+    // The refresh button also picks up clips changed outside the app
+    const rescanClips = async () => {
+        try {
+            await api.rescanClips()
+        } catch (err) {
+            console.error(err)
+        }
+        await fetchClips()
+    }
+
     useEffect(() => {
         if (open) {
             toast.dismiss()
@@ -135,7 +145,7 @@ export function ClipsDrawer() {
                             size="icon"
                             className="h-6 w-6 text-muted-foreground hover:text-foreground ml-auto"
                             style={{ '--wails-draggable': 'no-drag' } as React.CSSProperties}
-                            onClick={fetchClips}
+                            onClick={rescanClips}
                             disabled={loading}
                         >
                             <RefreshCcw className={cn("h-3.5 w-3.5", loading && "animate-spin")} />
@@ -41,6 +41,13 @@ export interface State {
     errorMessage?: string
     bufferUsage: number
     recordingFor: number
+    extending?: boolean
+    pendingSaves?: number
+}
+
+// The buffer keeps filling while a clip is being saved
+export function isCapturing(status: State['status']): boolean {
+    return status === 'recording' || status === 'saving'
 }
 
 import * as AppBindings from '../../bindings/rewind/internal/app/app'
@@ -104,6 +111,10 @@ export const api = {
         return clips as unknown as Clip[]
     },
 
+    async rescanClips(): Promise<void> {
+        return (AppBindings as any).RescanClips()
+    },
+
     async openClip(path: string): Promise<void> {
         return AppBindings.OpenClip(path)
     },
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// streamedEvents are forwarded to WebSocket clients
+var streamedEvents = map[string]bool{
+	"state-changed":    true,
+	"clips-updated":    true,
+	"clip-saved":       true,
+	"clip-save-failed": true,
+	"marker-added":     true,
+}
+
+// eventsPath is the WebSocket event stream
+const eventsPath = "/api/v1/events"
+
+// Controller is the part of the app the API drives
+type Controller interface {
+	Start() error
+	Stop() error
+	SaveClip(durationSec int) (string, error)
+	AddMarker(label string) (any, error)
+	State() any
+	Clips() (any, error)
+	Config() any
+	SetConfig(data []byte) error
+	Subscribe(fn func(name string, data any)) (unsubscribe func())
+}
+
+// Event is a message on the WebSocket stream
+type Event struct {
+	Event string `json:"event"`
+	Data  any    `json:"data,omitempty"`
+}
+
+// Server runs the control API while it is enabled
+type Server struct {
+	ctrl Controller
+
+	mu       sync.Mutex
+	settings Settings
+	srv      *http.Server
+	sockets  map[*websocket.Conn]struct{}
+}
+
+// NewServer creates a stopped server
+func NewServer(ctrl Controller) *Server {
+	return &Server{ctrl: ctrl, sockets: map[*websocket.Conn]struct{}{}}
+}
+
+// Apply starts, stops or restarts the server to match s. It never waits
+// for running requests, so it can be called while the controller is busy.
+func (s *Server) Apply(settings Settings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.srv != nil && settings == s.settings {
+		return nil
+	}
+	s.closeLocked()
+	s.settings = settings
+
+	if !settings.Enabled {
+		return nil
+	}
+
+	ln, err := settings.listen()
+	if err != nil {
+		return fmt.Errorf("failed to start control API: %w", err)
+	}
+
+	srv := &http.Server{
+		Handler:           s.routes(settings.Token),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.srv = srv
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("control API stopped", "error", err)
+		}
+	}()
+
+	slog.Info("control API listening", "addr", ln.Addr().String())
+	return nil
+}
+
+// Close stops the server and disconnects all clients
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked()
+	s.settings = Settings{}
+}
+
+func (s *Server) closeLocked() {
+	if s.srv == nil {
+		return
+	}
+	s.srv.Close()
+	s.srv = nil
+
+	// Hijacked connections are not closed by http.Server
+	for ws := range s.sockets {
+		ws.Close()
+	}
+	clear(s.sockets)
+
+	if path, ok := strings.CutPrefix(s.settings.Addr, unixPrefix); ok {
+		os.Remove(path)
+	}
+	slog.Info("control API stopped")
+}
+
+func (s *Server) routes(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/state", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.ctrl.State())
+	})
+	mux.HandleFunc("POST /api/v1/start", func(w http.ResponseWriter, r *http.Request) {
+		s.respond(w, s.ctrl.Start())
+	})
+	mux.HandleFunc("POST /api/v1/stop", func(w http.ResponseWriter, r *http.Request) {
+		s.respond(w, s.ctrl.Stop())
+	})
+	mux.HandleFunc("POST /api/v1/save", s.handleSave)
+	mux.HandleFunc("POST /api/v1/marker", func(w http.ResponseWriter, r *http.Request) {
+		marker, err := s.ctrl.AddMarker(r.URL.Query().Get("label"))
+		if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, marker)
+	})
+	mux.HandleFunc("GET /api/v1/clips", func(w http.ResponseWriter, r *http.Request) {
+		clips, err := s.ctrl.Clips()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, clips)
+	})
+	mux.HandleFunc("GET /api/v1/config", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.ctrl.Config())
+	})
+	mux.HandleFunc("PUT /api/v1/config", func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := s.ctrl.SetConfig(data); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.ctrl.Config())
+	})
+	mux.Handle("GET "+eventsPath, websocket.Server{
+		// Browsers can't set headers on WebSocket requests, so the token
+		// check replaces the origin check
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler:   s.handleEvents,
+	})
+
+	return requireToken(token, mux)
+}
+
+// requireToken accepts "Authorization: Bearer TOKEN". Only the event stream
+// also takes "?token=TOKEN", since browsers can't set headers on WebSocket
+// requests; elsewhere the token would end up in history and proxy logs.
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok && r.Method == http.MethodGet && r.URL.Path == eventsPath {
+			got = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("invalid token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleSave saves a clip; ?duration=SECONDS keeps only the end of the buffer
+func (s *Server) handleSave(w http.ResponseWriter, r *http.Request) {
+	var duration int
+	if v := r.URL.Query().Get("duration"); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil || d < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid duration: %s", v))
+			return
+		}
+		duration = d
+	}
+
+	filename, err := s.ctrl.SaveClip(duration)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"filename": filename})
+}
+
+// handleEvents streams events to a WebSocket client until it disconnects
+func (s *Server) handleEvents(ws *websocket.Conn) {
+	s.mu.Lock()
+	s.sockets[ws] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.sockets, ws)
+		s.mu.Unlock()
+		ws.Close()
+	}()
+
+	events := make(chan Event, 64)
+	unsubscribe := s.ctrl.Subscribe(func(name string, data any) {
+		if !streamedEvents[name] {
+			return
+		}
+		select {
+		case events <- Event{Event: name, Data: data}:
+		default:
+			// Slow clients miss events rather than stalling the app
+		}
+	})
+	defer unsubscribe()
+
+	// Clients send nothing; reading detects the disconnect
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, ws)
+		close(closed)
+	}()
+
+	if err := websocket.JSON.Send(ws, Event{Event: "state-changed", Data: s.ctrl.State()}); err != nil {
+		return
+	}
+	for {
+		select {
+		case ev := <-events:
+			if err := websocket.JSON.Send(ws, ev); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func (s *Server) respond(w http.ResponseWriter, err error) {
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.ctrl.State())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// listenUnix listens on a Unix socket only the current user can access. A
+// stale socket of a previous run is replaced, any other file is refused.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	os.Chmod(path, 0600)
+	return ln, nil
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const testToken = "0123456789abcdef"
+
+type testConfig struct {
+	FPS     int    `json:"fps"`
+	Bitrate string `json:"bitrate"`
+}
+
+// fakeController records calls and publishes events on demand
+type fakeController struct {
+	mu       sync.Mutex
+	saved    []int
+	saveErr  error
+	config   testConfig
+	handlers []func(string, any)
+}
+
+func (c *fakeController) Start() error                  { return nil }
+func (c *fakeController) Stop() error                   { return nil }
+func (c *fakeController) AddMarker(string) (any, error) { return nil, nil }
+func (c *fakeController) State() any                    { return map[string]string{"status": "recording"} }
+func (c *fakeController) Clips() (any, error)           { return []string{}, nil }
+
+func (c *fakeController) SaveClip(durationSec int) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.saveErr != nil {
+		return "", c.saveErr
+	}
+	c.saved = append(c.saved, durationSec)
+	return "clip.mp4", nil
+}
+
+func (c *fakeController) Config() any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.config
+}
+
+// SetConfig merges like the app does: fields missing from data keep their
+// value
+func (c *fakeController) SetConfig(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cfg := c.config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+	if cfg.FPS <= 0 {
+		return errors.New("fps must be positive")
+	}
+	c.config = cfg
+	return nil
+}
+
+func (c *fakeController) Subscribe(fn func(string, any)) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers = append(c.handlers, fn)
+	return func() {}
+}
+
+func (c *fakeController) publish(name string, data any) {
+	c.mu.Lock()
+	handlers := c.handlers
+	c.mu.Unlock()
+	for _, fn := range handlers {
+		fn(name, data)
+	}
+}
+
+func newTestServer(t *testing.T) (*fakeController, *httptest.Server) {
+	t.Helper()
+	ctrl := &fakeController{config: testConfig{FPS: 30, Bitrate: "15M"}}
+	srv := httptest.NewServer(NewServer(ctrl).routes(testToken))
+	t.Cleanup(srv.Close)
+	return ctrl, srv
+}
+
+func do(t *testing.T, method, url, token, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, strings.TrimSpace(string(b))
+}
+
+func TestRequireToken(t *testing.T) {
+	_, srv := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{name: "no token", method: "GET", path: "/api/v1/state", want: http.StatusUnauthorized},
+		{name: "wrong token", method: "GET", path: "/api/v1/state", token: "fedcba9876543210", want: http.StatusUnauthorized},
+		{name: "bearer token", method: "GET", path: "/api/v1/state", token: testToken, want: http.StatusOK},
+		{name: "save without token", method: "POST", path: "/api/v1/save", want: http.StatusUnauthorized},
+		{name: "query token outside the event stream", method: "GET", path: "/api/v1/state?token=" + testToken, want: http.StatusUnauthorized},
+		{name: "query token on a POST", method: "POST", path: "/api/v1/start?token=" + testToken, want: http.StatusUnauthorized},
+		// A plain GET is no WebSocket handshake, but it got past the token
+		{name: "query token on the event stream", method: "GET", path: "/api/v1/events?token=" + testToken, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, body := do(t, tt.method, srv.URL+tt.path, tt.token, ""); got != tt.want {
+				t.Errorf("status = %d, want %d: %s", got, tt.want, body)
+			}
+		})
+	}
+}
+
+func TestSave(t *testing.T) {
+	tests := []struct {
+		query     string
+		saveErr   error
+		want      int
+		wantSaved []int
+	}{
+		{query: "", want: http.StatusOK, wantSaved: []int{0}},
+		{query: "?duration=15", want: http.StatusOK, wantSaved: []int{15}},
+		{query: "?duration=-1", want: http.StatusBadRequest},
+		{query: "?duration=abc", want: http.StatusBadRequest},
+		{query: "", saveErr: errors.New("not recording"), want: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			ctrl, srv := newTestServer(t)
+			ctrl.saveErr = tt.saveErr
+
+			got, body := do(t, "POST", srv.URL+"/api/v1/save"+tt.query, testToken, "")
+			if got != tt.want {
+				t.Errorf("status = %d, want %d: %s", got, tt.want, body)
+			}
+			if got == http.StatusOK && body != `{"filename":"clip.mp4"}` {
+				t.Errorf("body = %s", body)
+			}
+			if len(ctrl.saved) != len(tt.wantSaved) || (len(tt.wantSaved) > 0 && ctrl.saved[0] != tt.wantSaved[0]) {
+				t.Errorf("saved = %v, want %v", ctrl.saved, tt.wantSaved)
+			}
+		})
+	}
+}
+
+func TestPutConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+		cfg  testConfig
+	}{
+		{name: "partial", body: `{"fps": 60}`, want: http.StatusOK, cfg: testConfig{FPS: 60, Bitrate: "15M"}},
+		{name: "invalid value", body: `{"fps": -1}`, want: http.StatusBadRequest, cfg: testConfig{FPS: 30, Bitrate: "15M"}},
+		{name: "not json", body: `fps=60`, want: http.StatusBadRequest, cfg: testConfig{FPS: 30, Bitrate: "15M"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl, srv := newTestServer(t)
+
+			got, body := do(t, "PUT", srv.URL+"/api/v1/config", testToken, tt.body)
+			if got != tt.want {
+				t.Errorf("status = %d, want %d: %s", got, tt.want, body)
+			}
+			if ctrl.config != tt.cfg {
+				t.Errorf("config = %+v, want %+v", ctrl.config, tt.cfg)
+			}
+			if got == http.StatusOK {
+				var cfg testConfig
+				if err := json.Unmarshal([]byte(body), &cfg); err != nil || cfg != tt.cfg {
+					t.Errorf("response = %s, want %+v", body, tt.cfg)
+				}
+			}
+		})
+	}
+}
+
+func TestEvents(t *testing.T) {
+	ctrl, srv := newTestServer(t)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + eventsPath
+
+	tests := []struct {
+		name   string
+		url    string
+		header bool
+	}{
+		{name: "header", url: url, header: true},
+		{name: "query", url: url + "?token=" + testToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := websocket.NewConfig(tt.url, srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header {
+				cfg.Header.Set("Authorization", "Bearer "+testToken)
+			}
+			ws, err := websocket.DialConfig(cfg)
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer ws.Close()
+			ws.SetReadDeadline(time.Now().Add(time.Second))
+
+			var ev Event
+			if err := websocket.JSON.Receive(ws, &ev); err != nil || ev.Event != "state-changed" {
+				t.Fatalf("first event = %+v, %v; want the current state", ev, err)
+			}
+
+			ctrl.publish("frontend-only", nil)
+			ctrl.publish("clip-saved", map[string]string{"path": "clip.mp4"})
+			if err := websocket.JSON.Receive(ws, &ev); err != nil {
+				t.Fatal(err)
+			}
+			if data, _ := ev.Data.(map[string]any); ev.Event != "clip-saved" || data["path"] != "clip.mp4" {
+				t.Errorf("event = %+v, want clip-saved", ev)
+			}
+		})
+	}
+
+	if _, err := websocket.Dial(url, "", srv.URL); err == nil {
+		t.Error("connected to the event stream without a token")
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	dir := t.TempDir()
+
+	// A file that is not a socket is never removed
+	file := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(file, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ln, err := listenUnix(file); err == nil {
+		ln.Close()
+		t.Error("listenUnix() replaced a regular file")
+	}
+	if data, _ := os.ReadFile(file); string(data) != "keep" {
+		t.Errorf("file content = %q after listenUnix()", data)
+	}
+
+	// A stale socket is replaced
+	sock := filepath.Join(dir, "api.sock")
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("no Unix sockets: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listenUnix(sock)
+	if err != nil {
+		t.Fatalf("listenUnix() over a stale socket error = %v", err)
+	}
+	ln.Close()
+}
@@ -0,0 +1,79 @@
+// Package api serves the local control API used by external tools such as
+// Stream Deck plugins, macro pads and scripts
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+)
+
+// DefaultAddr is the listen address used when none is configured
+const DefaultAddr = "127.0.0.1:7071"
+
+// unixPrefix selects a Unix domain socket, e.g. "unix:/run/rewind.sock"
+const unixPrefix = "unix:"
+
+// Settings configures the control API. It is off by default.
+type Settings struct {
+	Enabled bool   `json:"enabled"`
+	Addr    string `json:"addr"`  // loopback "host:port" or "unix:PATH"
+	Token   string `json:"token"` // sent as "Authorization: Bearer TOKEN"
+}
+
+// DefaultSettings returns the settings used when none are configured
+func DefaultSettings() Settings {
+	return Settings{Addr: DefaultAddr}
+}
+
+// NewToken returns a random access token
+func NewToken() string {
+	key := make([]byte, 24)
+	rand.Read(key)
+	return hex.EncodeToString(key)
+}
+
+// Validate checks that the API only listens locally
+func (s Settings) Validate() error {
+	if path, ok := strings.CutPrefix(s.Addr, unixPrefix); ok {
+		if path == "" {
+			return fmt.Errorf("API socket path must not be empty")
+		}
+	} else {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid API address: %w", err)
+		}
+		if host != "localhost" {
+			ip := net.ParseIP(host)
+			if ip == nil || !ip.IsLoopback() {
+				return fmt.Errorf("API address must be a loopback address")
+			}
+		}
+	}
+
+	if s.Enabled && len(s.Token) < 16 {
+		return fmt.Errorf("API token must be at least 16 characters")
+	}
+	return nil
+}
+
+// LogValue logs whether a token is set instead of the token
+func (s Settings) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Bool("enabled", s.Enabled),
+		slog.String("addr", s.Addr),
+		slog.Bool("token", s.Token != ""),
+	)
+}
+
+// listen opens the configured socket
+func (s Settings) listen() (net.Listener, error) {
+	if path, ok := strings.CutPrefix(s.Addr, unixPrefix); ok {
+		return listenUnix(path)
+	}
+	return net.Listen("tcp", s.Addr)
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSettingsLogValue(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	s := Settings{Enabled: true, Addr: DefaultAddr, Token: NewToken()}
+	logger.Info("settings", "api", s)
+
+	out := buf.String()
+	if strings.Contains(out, s.Token) {
+		t.Errorf("log line contains the token: %s", out)
+	}
+	if !strings.Contains(out, "api.token=true") || !strings.Contains(out, "api.addr="+DefaultAddr) {
+		t.Errorf("log line = %s", out)
+	}
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"rewind/internal/api"
+	"rewind/internal/events"
+	"rewind/internal/obsws"
+)
+
+// apiController exposes the App to the control API
+type apiController struct {
+	a *App
+}
+
+func (c apiController) Start() error { return c.a.Start() }
+func (c apiController) Stop() error  { return c.a.Stop() }
+func (c apiController) State() any   { return c.a.GetState() }
+func (c apiController) Config() any  { return c.a.GetConfig() }
+
+func (c apiController) SaveClip(durationSec int) (string, error) {
+	return c.a.SaveClipFor(durationSec)
+}
+
+func (c apiController) AddMarker(label string) (any, error) {
+	return c.a.AddMarker(label)
+}
+
+func (c apiController) Clips() (any, error) {
+	clips, err := c.a.GetClips()
+	return clips, err
+}
+
+// SetConfig applies a full or partial config document; missing fields
+// keep their current values
+func (c apiController) SetConfig(data []byte) error {
+	cfg := c.a.GetConfig()
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	return c.a.SetConfig(cfg)
+}
+
+func (c apiController) Subscribe(fn func(name string, data any)) func() {
+	return c.a.Events().Subscribe(func(ev events.Event) {
+		fn(ev.Topic(), eventData(ev))
+	})
+}
+
+// obsController exposes the App to the obs-websocket server
+type obsController struct {
+	a *App
+}
+
+func (c obsController) Start() error              { return c.a.Start() }
+func (c obsController) Stop() error               { return c.a.Stop() }
+func (c obsController) SaveClip() (string, error) { return c.a.SaveClip() }
+func (c obsController) Recording() bool           { return c.a.IsRecording() }
+
+func (c obsController) AddMarker(label string) error {
+	_, err := c.a.AddMarker(label)
+	return err
+}
+
+func (c obsController) Subscribe(onRecording func(bool), onSaved func(string)) func() {
+	// Moving between recording and saving keeps the replay buffer active,
+	// only report changes of that
+	var mu sync.Mutex
+	var last *bool
+	return c.a.Events().Subscribe(func(ev events.Event) {
+		switch ev := ev.(type) {
+		case StateChanged:
+			active := ev.Status.Capturing()
+			mu.Lock()
+			changed := last == nil || *last != active
+			last = &active
+			mu.Unlock()
+			if changed {
+				onRecording(active)
+			}
+		case ClipSaved:
+			onSaved(ev.Path)
+		}
+	})
+}
+
+// applyAPI starts, stops or restarts the control API and the obs-websocket
+// server. Must be called with a.mu held.
+func (a *App) applyAPI(s api.Settings, obs obsws.Settings) {
+	if err := a.api.Apply(s); err != nil {
+		slog.Warn("failed to apply control API settings", "error", err)
+	}
+	if err := a.obs.Apply(obs); err != nil {
+		slog.Warn("failed to apply obs-websocket settings", "error", err)
+	}
+}
+
+// RegenerateAPIToken replaces the control API token; clients using the old
+// one are rejected from then on
+func (a *App) RegenerateAPIToken() (string, error) {
+	cfg := a.GetConfig()
+	cfg.API.Token = api.NewToken()
+	if err := a.SetConfig(cfg); err != nil {
+		return "", err
+	}
+	return cfg.API.Token, nil
+}
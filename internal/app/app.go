@@ -12,10 +12,16 @@ import (
 	"sync"
 	"time"
 
+	"rewind/internal/api"
 	"rewind/internal/audio"
 	"rewind/internal/buffer"
 	"rewind/internal/capture"
+	"rewind/internal/events"
+	"rewind/internal/foreground"
 	"rewind/internal/hardware"
+	"rewind/internal/hooks"
+	"rewind/internal/library"
+	"rewind/internal/obsws"
 	"rewind/internal/utils"
 
 	"github.com/wailsapp/wails/v3/pkg/application"
@@ -33,17 +39,56 @@ const (
 
 // Config represents user-configurable settings
 type Config struct {
+	Version           int    `json:"version"` // schema version, see ConfigVersion
 	DisplayIndex      int    `json:"displayIndex"`
 	EncoderName       string `json:"encoderName"`
 	FPS               int    `json:"fps"`
 	Bitrate           string `json:"bitrate"`
 	RecordSeconds     int    `json:"recordSeconds"`
+	PostRollSeconds   int    `json:"postRollSeconds"` // 0 = save immediately
 	OutputDir         string `json:"outputDir"`
 	ConvertToMP4      bool   `json:"convertToMP4"`
 	MicrophoneDevice  string `json:"microphoneDevice"`
 	MicVolume         int    `json:"micVolume"` // 0-200
 	SystemAudioDevice string `json:"systemAudioDevice"`
-	SysVolume         int    `json:"sysVolume"` // 0-200
+	SysVolume         int    `json:"sysVolume"`        // 0-200
+	FilenameTemplate  string `json:"filenameTemplate"` // e.g. "clip_{date}_{time}"
+	FolderTemplate    string `json:"folderTemplate"`   // e.g. "{app}/{yyyy-mm}", "" = no subfolders
+
+	Audio     capture.AudioSettings `json:"audio"`
+	Retention library.Policy        `json:"retention"`
+	Hooks     []hooks.Hook          `json:"hooks"`
+
+	AutoSwitch foreground.Settings `json:"autoSwitch"`
+	API        api.Settings        `json:"api"`
+	OBS        obsws.Settings      `json:"obsWebsocket"`
+}
+
+// LogValue logs the config with its secrets and webhook header values
+// masked. Handlers format nested structs with fmt, which never calls the
+// LogValue of API and OBS.
+func (c Config) LogValue() slog.Value {
+	type plain Config // drops the methods, or slog would resolve forever
+	p := plain(c)
+	if p.API.Token != "" {
+		p.API.Token = "[redacted]"
+	}
+	if p.OBS.Password != "" {
+		p.OBS.Password = "[redacted]"
+	}
+	// Webhook headers usually carry credentials
+	p.Hooks = make([]hooks.Hook, len(c.Hooks))
+	for i, h := range c.Hooks {
+		if len(h.Headers) > 0 {
+			headers := make(map[string]string, len(h.Headers))
+			for k := range h.Headers {
+				headers[k] = "[redacted]"
+			}
+			h.Headers = headers
+		}
+		p.Hooks[i] = h
+	}
+	return slog.AnyValue(p)
 }
 
 // DefaultConfig returns sensible defaults
@@ -56,17 +101,26 @@ func DefaultConfig() Config {
 	}
 
 	return Config{
+		Version:           ConfigVersion,
 		DisplayIndex:      0,
 		EncoderName:       "", // auto-select
 		FPS:               30,
 		Bitrate:           "15M",
 		RecordSeconds:     30,
+		PostRollSeconds:   0,
 		OutputDir:         outputDir,
 		ConvertToMP4:      true,
 		MicrophoneDevice:  "",
 		MicVolume:         100,
 		SystemAudioDevice: "",
 		SysVolume:         100,
+		FilenameTemplate:  capture.DefaultFilenameTemplate,
+		FolderTemplate:    "",
+		Audio:             capture.DefaultAudioSettings(),
+		Retention:         library.DefaultPolicy(),
+		AutoSwitch:        foreground.DefaultSettings(),
+		API:               api.DefaultSettings(),
+		OBS:               obsws.DefaultSettings(),
 	}
 }
 
@@ -76,6 +130,8 @@ type State struct {
 	ErrorMessage string `json:"errorMessage,omitempty"`
 	BufferUsage  int    `json:"bufferUsage"`  // percentage 0-100
 	RecordingFor int    `json:"recordingFor"` // seconds since recording started
+	Extending    bool   `json:"extending"`    // an extended save is collecting live data
+	PendingSaves int    `json:"pendingSaves"` // clips being captured or written
 }
 
 // App is the main application service for Wails binding
@@ -87,8 +143,30 @@ type App struct {
 	app *application.App
 
 	// Configuration
-	config     Config
-	ffmpegPath string
+	config       Config
+	configIssues []ConfigIssue // invalid settings reset by LoadConfig
+	configNewer  bool          // settings.json is from a newer version, see LoadConfig
+	ffmpegPath   string
+
+	// Named profiles (see profiles.go)
+	profiles      []Profile
+	activeProfile string
+
+	// Automatic profile switching (see autoswitch.go)
+	watcher        *foreground.Watcher
+	autoRecording  bool   // recording was started by an auto-record rule
+	autoSwitchGame string // auto-record rule of the last decision, "" if none
+
+	// Clip library index of the output dir (see library.go)
+	libraryMu sync.Mutex
+	library   *library.Index
+
+	// Local control API and obs-websocket server (see api.go)
+	api *api.Server
+	obs *obsws.Server
+
+	// Command given on the first launch, run once initialized
+	startupCommand Command
 
 	// Hardware info (detected once)
 	sysInfo *hardware.SystemInfo
@@ -99,15 +177,30 @@ type App struct {
 	audioManager *audio.CaptureManager
 	ringBuffer   *buffer.Buffer
 	saver        *capture.Saver
+	previews     *capture.PreviewQueue
+	hooks        *hooks.Runner
 	startTime    time.Time
 	lastSaveTime time.Time
 
-	// Event callbacks (legacy - kept for compatibility)
-	OnStateChange func(state State)
-	OnClipSaved   func(filename string)
+	// Pending extended save (see SaveClip)
+	extendStop     chan struct{}
+	extendFilename string
+
+	// Markers dropped during the current recording (see markers.go)
+	markersMu sync.Mutex
+	markers   []capture.Marker
+
+	// Result of the startup recovery of interrupted saves
+	recovery *capture.RecoveryReport
 
-	// Tray state change callback
-	onTrayStateChange func(State)
+	// Serializes retention runs (see applyRetention)
+	retentionMu sync.Mutex
+
+	// Clips being captured or written, see saveStarted
+	savesInFlight int
+
+	// Every event for the frontend, tray and API (see events.go)
+	bus *events.Bus
 }
 
 // New creates a new App instance
@@ -116,24 +209,45 @@ func New(ffmpegPath string) *App {
 		config:     DefaultConfig(),
 		ffmpegPath: ffmpegPath,
 		state:      State{Status: StatusIdle},
+		bus:        events.NewBus(),
 	}
 
+	app.previews = capture.NewPreviewQueue(ffmpegPath)
+	app.previews.OnDone = func(string) { app.EmitClipsUpdate() }
+
+	app.hooks = hooks.NewRunner()
+	app.hooks.OnResult = app.emitHookResult
+	events.On(app.bus, func(ev ClipSaved) { app.runHooks(ev.Path) })
+
+	app.watcher = foreground.NewWatcher()
+	app.watcher.OnChange = app.onAutoSwitch
+
+	app.api = api.NewServer(apiController{app})
+	app.obs = obsws.NewServer(obsController{app})
+
 	// Load saved config (if exists)
 	if err := app.LoadConfig(); err != nil {
 		slog.Warn("failed to load config", "error", err)
 	}
+	if err := app.loadProfiles(); err != nil {
+		slog.Warn("failed to load profiles", "error", err)
+	}
+	app.hooks.SetHooks(app.config.Hooks)
 
 	return app
 }
 
-// SetApp stores the Wails application instance for event emission
+// SetApp stores the Wails application instance and forwards events to the
+// frontend
 func (a *App) SetApp(app *application.App) {
 	a.app = app
+	a.bus.Subscribe(a.forwardToFrontend)
 }
 
-// SetOnStateChange sets a callback for tray state updates
-func (a *App) SetOnStateChange(callback func(State)) {
-	a.onTrayStateChange = callback
+// RunOnStartup sets a command to run once the app is initialized, for
+// command flags given to the first launch
+func (a *App) RunOnStartup(cmd Command) {
+	a.startupCommand = cmd
 }
 
 // ServiceStartup is called when the Wails v3 app starts (lifecycle hook)
@@ -147,6 +261,14 @@ func (a *App) ServiceStartup(ctx context.Context, options application.ServiceOpt
 		return err
 	}
 
+	if cmd := a.startupCommand; !cmd.Empty() {
+		go func() {
+			if _, err := a.RunCommand(cmd); err != nil {
+				slog.Error("startup command failed", "error", err)
+			}
+		}()
+	}
+
 	return nil
 }
 
@@ -154,6 +276,10 @@ func (a *App) ServiceStartup(ctx context.Context, options application.ServiceOpt
 func (a *App) ServiceShutdown() error {
 	slog.Info("Rewind service shutting down...")
 
+	a.watcher.Stop()
+	a.api.Close()
+	a.obs.Close()
+
 	// Stop recording if active
 	if a.IsRecording() {
 		a.Stop()
@@ -188,6 +314,18 @@ func (a *App) Initialize() error {
 
 	a.sysInfo = sysInfo
 
+	// Saved display and encoder may be gone since the config was written
+	if sysInfo.GetDisplay(a.config.DisplayIndex) == nil {
+		a.configIssues = append(a.configIssues, ConfigIssue{Field: "displayIndex", Message: fmt.Sprintf("display not found: %d", a.config.DisplayIndex)})
+		slog.Warn("saved display not found, using primary", "display", a.config.DisplayIndex)
+		a.config.DisplayIndex = 0
+	}
+	if a.config.EncoderName != "" && sysInfo.GetEncoder(a.config.EncoderName) == nil {
+		a.configIssues = append(a.configIssues, ConfigIssue{Field: "encoderName", Message: fmt.Sprintf("encoder not found: %s", a.config.EncoderName)})
+		slog.Warn("saved encoder not available, auto-selecting", "encoder", a.config.EncoderName)
+		a.config.EncoderName = ""
+	}
+
 	// Auto-select encoder if not set
 	if a.config.EncoderName == "" {
 		a.config.EncoderName = hardware.FindBestEncoder(sysInfo.Encoders).Name
@@ -198,9 +336,48 @@ func (a *App) Initialize() error {
 		"encoders", len(sysInfo.GetAvailableEncoders()),
 	)
 
+	a.configureAutoSwitch(a.config.AutoSwitch)
+	a.applyAPI(a.config.API, a.config.OBS)
+
+	// Finish saves interrupted by a crash, then enforce the retention
+	// policy; conversions can take a while
+	saver := capture.NewSaver(a.ffmpegPath, a.config.OutputDir)
+	started := time.Now()
+	go func() {
+		a.recoverClips(saver, started)
+		a.applyRetention("")
+	}()
+
 	return nil
 }
 
+// recoverClips converts or keeps clips whose save was interrupted before
+// the given time and reports the result to the frontend
+func (a *App) recoverClips(saver *capture.Saver, before time.Time) {
+	report := saver.Recover(before)
+
+	a.mu.Lock()
+	a.recovery = report
+	a.mu.Unlock()
+
+	if report.Empty() {
+		return
+	}
+	for _, path := range report.Recovered {
+		a.previews.Enqueue(path)
+	}
+	a.emit("clips-recovered", report)
+	a.clipsChanged()
+}
+
+// GetRecoveryReport returns what the startup recovery found, or nil while
+// it is still running
+func (a *App) GetRecoveryReport() *capture.RecoveryReport {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.recovery
+}
+
 // GetDisplays returns all available displays
 func (a *App) GetDisplays() []DisplayInfo {
 	a.mu.RLock()
@@ -291,21 +468,42 @@ func (a *App) GetConfig() Config {
 	return a.config
 }
 
-// SetConfig updates the configuration (only when not recording)
+// SetConfig updates the configuration (only when not recording). The
+// active profile, if any, is updated as well.
 func (a *App) SetConfig(cfg Config) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if a.state.Status == StatusRecording {
+	if a.state.Status.Capturing() {
 		return fmt.Errorf("cannot change config while recording")
 	}
+	if a.configNewer {
+		return fmt.Errorf("settings were saved by a newer version of Rewind, update Rewind to change them")
+	}
 
-	// Validate
-	if cfg.FPS <= 0 || cfg.FPS > 240 {
-		return fmt.Errorf("FPS must be between 1 and 240")
+	if err := a.applyConfig(cfg); err != nil {
+		return err
+	}
+
+	if a.activeProfile != "" {
+		if err := a.updateActiveProfile(a.config); err != nil {
+			slog.Warn("failed to update active profile", "profile", a.activeProfile, "error", err)
+		}
+	}
+	return nil
+}
+
+// applyConfig validates and activates cfg and saves it to settings.json.
+// Must be called with a.mu held.
+func (a *App) applyConfig(cfg Config) error {
+	// Enabling the control API without a token creates one
+	if cfg.API.Enabled && cfg.API.Token == "" {
+		cfg.API.Token = api.NewToken()
 	}
-	if cfg.RecordSeconds <= 0 {
-		return fmt.Errorf("record seconds must be positive")
+
+	// Validate
+	if err := cfg.validate(); err != nil {
+		return err
 	}
 
 	// Validate display exists
@@ -320,11 +518,24 @@ func (a *App) SetConfig(cfg Config) error {
 		}
 	}
 
+	cfg.Version = ConfigVersion
 	a.config = cfg
+	a.configIssues = nil
+	if a.configNewer {
+		a.configIssues = []ConfigIssue{newerConfigIssue}
+	}
+	a.hooks.SetHooks(cfg.Hooks)
+	if a.sysInfo != nil {
+		a.configureAutoSwitch(cfg.AutoSwitch)
+		a.applyAPI(cfg.API, cfg.OBS)
+	}
 	slog.Info("config updated", "config", cfg)
 
-	// Save config to file (use helper to avoid mutex deadlock)
-	if err := saveConfigToFile(cfg); err != nil {
+	// Save config to file (use helper to avoid mutex deadlock). Profile
+	// switches still apply to a newer file, but only until Rewind quits.
+	if a.configNewer {
+		slog.Warn("config not saved, settings.json is from a newer version")
+	} else if err := saveConfigToFile(cfg); err != nil {
 		slog.Warn("failed to save config", "error", err)
 	}
 
@@ -337,7 +548,7 @@ func (a *App) GetState() State {
 	defer a.mu.RUnlock()
 
 	state := a.state
-	if a.ringBuffer != nil && a.state.Status == StatusRecording {
+	if a.ringBuffer != nil && a.state.Status.Capturing() {
 		total := a.ringBuffer.Size()
 		used := a.ringBuffer.Len()
 		if total > 0 {
@@ -348,12 +559,13 @@ func (a *App) GetState() State {
 	return state
 }
 
-// Start begins recording
+// Start begins recording. A failure enters the error status, from which
+// Start can be retried.
 func (a *App) Start() error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if a.state.Status == StatusRecording {
+	if a.state.Status.Capturing() {
 		return fmt.Errorf("already recording")
 	}
 
@@ -361,6 +573,22 @@ func (a *App) Start() error {
 		return fmt.Errorf("not initialized")
 	}
 
+	if err := a.startCapture(); err != nil {
+		a.ringBuffer = nil
+		a.transition(StatusError, ReasonStartFailed, err.Error())
+		return err
+	}
+
+	if err := a.transition(StatusRecording, ReasonStart, ""); err != nil {
+		a.stopCapture()
+		return err
+	}
+	return nil
+}
+
+// startCapture starts video and audio capture into a new buffer. Must be
+// called with a.mu held.
+func (a *App) startCapture() error {
 	// Ensure OutputDir is absolute and create it
 	absDir, err := utils.ResolveAbsPath(a.config.OutputDir, "")
 	if err != nil {
@@ -391,7 +619,7 @@ func (a *App) Start() error {
 	// Create components
 	bufSize := capture.CalculateBufferSize(a.config.Bitrate, a.config.RecordSeconds)
 	a.ringBuffer = buffer.New(bufSize)
-	a.saver = capture.NewSaver(a.ffmpegPath, a.config.OutputDir)
+	a.saver = a.newSaver()
 
 	capturer, err := capture.NewCapturer(captureCfg)
 	if err != nil {
@@ -403,7 +631,7 @@ func (a *App) Start() error {
 	}
 
 	capturer.OnError = func(err error) {
-		slog.Warn("capture error", "error", err)
+		a.onCaptureError(capturer, err)
 	}
 
 	if err := capturer.Start(); err != nil {
@@ -412,7 +640,7 @@ func (a *App) Start() error {
 
 	a.capturer = capturer
 	a.startTime = time.Now()
-	a.setState(StatusRecording, "")
+	a.clearMarkers()
 
 	slog.Info("recording started",
 		"display", a.config.DisplayIndex,
@@ -442,15 +670,30 @@ func (a *App) Start() error {
 	return nil
 }
 
-// Stop stops recording
+// Stop stops recording, or leaves the error status. Clips that are still
+// being written finish in the background.
 func (a *App) Stop() error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if a.state.Status != StatusRecording {
+	if a.state.Status == StatusIdle {
 		return fmt.Errorf("not recording")
 	}
 
+	a.stopCapture()
+	if err := a.transition(StatusIdle, ReasonStop, ""); err != nil {
+		return err
+	}
+	slog.Info("recording stopped")
+	return nil
+}
+
+// stopCapture stops capturing and releases the buffer. Must be called with
+// a.mu held.
+func (a *App) stopCapture() {
+	// Flush a pending extended save with whatever was captured so far
+	a.finishExtendedSave(a.extendStop)
+
 	if a.capturer != nil {
 		a.capturer.Stop()
 		a.capturer = nil
@@ -466,20 +709,54 @@ func (a *App) Stop() error {
 	stdruntime.GC()
 	debug.FreeOSMemory()
 
-	a.setState(StatusIdle, "")
-	slog.Info("recording stopped")
+	a.autoRecording = false
+}
+
+// restartCapture restarts capture to pick up a changed config. The status
+// and the auto-record flag carry over; a failure enters the error status.
+// Must be called with a.mu held.
+func (a *App) restartCapture() error {
+	autoRecording := a.autoRecording
+	a.stopCapture()
+	if err := a.startCapture(); err != nil {
+		a.ringBuffer = nil
+		a.transition(StatusError, ReasonStartFailed, err.Error())
+		return err
+	}
+	a.autoRecording = autoRecording
+	a.transition(a.state.Status, ReasonStart, "")
 	return nil
 }
 
-// SaveClip saves the current buffer as a clip
+// SaveClip saves the current buffer as a clip. When PostRollSeconds is set,
+// the clip keeps collecting live data for that long; calling SaveClip again
+// meanwhile finishes it early.
 func (a *App) SaveClip() (string, error) {
+	return a.SaveClipFor(0)
+}
+
+// SaveClipFor works like SaveClip but keeps only the last seconds of the
+// buffer. 0 keeps the whole buffer.
+func (a *App) SaveClipFor(seconds int) (string, error) {
+	if seconds < 0 {
+		return "", fmt.Errorf("duration must not be negative")
+	}
+
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if a.state.Status != StatusRecording {
+	if !a.state.Status.Capturing() {
 		return "", fmt.Errorf("not recording")
 	}
 
+	// Second press while extending ends the pending clip
+	if a.extendStop != nil {
+		filename := a.extendFilename
+		a.finishExtendedSave(a.extendStop)
+		slog.Info("extended save stopped by user", "filename", filename)
+		return filename, nil
+	}
+
 	// Debounce
 	if time.Since(a.lastSaveTime) < 3*time.Second {
 		return "", fmt.Errorf("please wait before saving another clip")
@@ -489,40 +766,177 @@ func (a *App) SaveClip() (string, error) {
 		return "", fmt.Errorf("not initialized")
 	}
 
-	filename := fmt.Sprintf("clip_%s", time.Now().Format("20060102_150405"))
+	if err := a.checkDiskSpace(); err != nil {
+		return "", err
+	}
+
+	metadata := a.recordingMetadata()
+	filename := a.saver.ClipName(a.config.FilenameTemplate, a.config.FolderTemplate, capture.NameFields{
+		Time:    time.Now(),
+		Display: metadata.Display,
+		Encoder: metadata.Encoder,
+		App:     metadata.ForegroundApp,
+		Profile: a.profileName(),
+	})
+
 	opts := capture.DefaultSaveOptions(filename)
 	opts.ConvertToMP4, opts.DeleteTS = a.config.ConvertToMP4, a.config.ConvertToMP4
 	opts.DurationSec = a.config.RecordSeconds
+	if seconds > 0 && seconds < opts.DurationSec {
+		opts.DurationSec = seconds
+	}
+	opts.Audio = a.config.Audio
+	opts.Metadata = metadata
+	opts.Markers = a.recordedMarkers
+	opts.RecordingStart = a.startTime
 
-	var audioSrc capture.Snapshotter
-	if a.audioManager != nil && a.audioManager.IsRunning() {
-		audioSrc = a.audioManager.GetBuffer()
+	ext := "/"
+	if a.config.ConvertToMP4 {
+		ext = ".mp4"
 	}
 
-	if err := a.saver.SaveWithAudio(a.ringBuffer, audioSrc, opts); err != nil {
+	if a.config.PostRollSeconds > 0 {
+		if err := a.startExtendedSave(opts, filename+ext); err != nil {
+			a.saver.ReleaseName(filename)
+			return "", fmt.Errorf("save failed: %w", err)
+		}
+		return filename + ext, nil
+	}
+
+	if err := a.saver.SaveWithAudio(a.ringBuffer, a.audioTracks(), opts); err != nil {
+		a.saver.ReleaseName(filename)
 		return "", fmt.Errorf("save failed: %w", err)
 	}
 
 	a.lastSaveTime = time.Now()
+	a.saveStarted()
+	a.publish(ClipCaptured{Filename: filename + ext})
 
-	ext := "/"
-	if a.config.ConvertToMP4 {
-		ext = ".mp4"
+	slog.Info("clip saved", "filename", filename)
+	return filename + ext, nil
+}
+
+// recordingMetadata describes the current recording setup for clip
+// metadata. Must be called with a.mu held.
+func (a *App) recordingMetadata() *capture.ClipMetadata {
+	m := &capture.ClipMetadata{
+		Encoder:    a.config.EncoderName,
+		FPS:        a.config.FPS,
+		Bitrate:    a.config.Bitrate,
+		AppVersion: utils.AppVersion,
+	}
+
+	if a.sysInfo != nil {
+		if d := a.sysInfo.GetDisplay(a.config.DisplayIndex); d != nil {
+			m.Display = d.FriendlyName
+			if m.Display == "" {
+				m.Display = d.Name
+			}
+			m.Width, m.Height = d.Width, d.Height
+		}
+		if e := a.sysInfo.GetEncoder(a.config.EncoderName); e != nil {
+			m.Codec = e.Codec
+		}
+	}
+
+	if a.audioManager != nil && a.audioManager.IsRunning() {
+		if a.config.MicrophoneDevice != "" {
+			m.MicrophoneDevice = a.config.MicrophoneDevice
+			m.MicVolume = a.config.MicVolume
+		}
+		if a.config.SystemAudioDevice != "" {
+			m.SystemAudioDevice = a.config.SystemAudioDevice
+			m.SysVolume = a.config.SysVolume
+		}
+	}
+
+	if w, err := foreground.Current(); err == nil {
+		m.ForegroundApp = w.ProcessName()
+		m.WindowTitle = w.Title
+	} else {
+		slog.Debug("failed to get foreground window", "error", err)
+	}
+
+	return m
+}
+
+// audioTracks returns the separate audio tracks of the running capture.
+// Must be called with a.mu held.
+func (a *App) audioTracks() []capture.AudioTrack {
+	if a.audioManager == nil || !a.audioManager.IsRunning() {
+		return nil
+	}
+
+	var tracks []capture.AudioTrack
+	for _, t := range a.audioManager.Tracks() {
+		tracks = append(tracks, capture.AudioTrack{Label: t.Label, Source: t.Buffer})
+	}
+	return tracks
+}
+
+// startExtendedSave snapshots the buffers and keeps tapping them for
+// PostRollSeconds. Must be called with a.mu held.
+func (a *App) startExtendedSave(opts *capture.SaveOptions, clipName string) error {
+	stop := make(chan struct{})
+	if err := a.saver.SaveExtended(a.ringBuffer, a.audioTracks(), opts, stop); err != nil {
+		return err
 	}
 
-	if a.OnClipSaved != nil {
-		go a.OnClipSaved(filename + ext)
+	a.extendStop = stop
+	a.extendFilename = clipName
+	a.lastSaveTime = time.Now()
+	a.state.Extending = true
+	a.saveStarted()
+
+	postRoll := time.Duration(a.config.PostRollSeconds) * time.Second
+	go func() {
+		select {
+		case <-stop:
+		case <-time.After(postRoll):
+			a.mu.Lock()
+			a.finishExtendedSave(stop)
+			a.mu.Unlock()
+		}
+	}()
+
+	slog.Info("extended save pending", "filename", clipName, "postRoll", postRoll)
+	return nil
+}
+
+// finishExtendedSave ends the pending extended save if stop is still the
+// current one. Must be called with a.mu held.
+func (a *App) finishExtendedSave(stop chan struct{}) {
+	if stop == nil || a.extendStop != stop {
+		return
 	}
 
+	close(stop)
+	filename := a.extendFilename
+	a.extendStop = nil
+	a.extendFilename = ""
+	a.state.Extending = false
+	a.transition(a.state.Status, ReasonExtendFinished, a.state.ErrorMessage)
+	a.publish(ClipCaptured{Filename: filename})
+
 	slog.Info("clip saved", "filename", filename)
-	return filename + ext, nil
+}
+
+// WaitForSaves blocks until clips that are being written are on disk
+func (a *App) WaitForSaves() {
+	a.mu.RLock()
+	saver := a.saver
+	a.mu.RUnlock()
+
+	if saver != nil {
+		saver.Wait()
+	}
 }
 
 // IsRecording returns true if currently recording
 func (a *App) IsRecording() bool {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
-	return a.state.Status == StatusRecording
+	return a.state.Status.Capturing()
 }
 
 func (a *App) SelectDirectory() (string, error) {
@@ -550,20 +964,14 @@ func (a *App) SelectDirectory() (string, error) {
 func (a *App) EstimateMemory(bitrate string, seconds int, hasMic bool, hasSys bool) string {
 	videoSize := capture.CalculateBufferSize(bitrate, seconds)
 
+	// Each stream keeps a short processing buffer and its own track
 	audioSize := 0
-	activeStreams := 0
 
 	if hasMic {
-		activeStreams++
-		audioSize += audio.CalculateStreamBufferSize(2)
+		audioSize += audio.CalculateStreamBufferSize(2) + audio.CalculateTrackBufferSize(seconds)
 	}
 	if hasSys {
-		activeStreams++
-		audioSize += audio.CalculateStreamBufferSize(2)
-	}
-
-	if activeStreams > 0 {
-		audioSize += audio.CalculateMixedBufferSize(seconds)
+		audioSize += audio.CalculateStreamBufferSize(2) + audio.CalculateTrackBufferSize(seconds)
 	}
 
 	totalSize := videoSize + audioSize
@@ -580,84 +988,41 @@ type Clip struct {
 	Size        int64     `json:"size"`
 	ModTime     time.Time `json:"modTime"`
 	IsRawFolder bool      `json:"isRawFolder"`
+	Folder      string    `json:"folder,omitempty"` // relative to the output dir, "" = top level
 	DurationSec int       `json:"durationSec,omitempty"`
+	Health      string    `json:"health,omitempty"` // "ok", "broken", "" = not verified
+	Thumbnail   string    `json:"thumbnail,omitempty"`
+	SpriteSheet string    `json:"spriteSheet,omitempty"`
+	SpriteIndex string    `json:"spriteIndex,omitempty"`
+
+	Metadata *capture.ClipMetadata `json:"metadata,omitempty"`
 }
 
-// GetClips returns a list of saved clips in the output directory.
-func (a *App) GetClips() ([]Clip, error) {
-	// Ensure OutputDir is absolute
-	outputDir, err := utils.ResolveAbsPath(a.config.OutputDir, "")
-	if err != nil {
-		return nil, fmt.Errorf("failed to resolve output directory: %w", err)
+// attachPreviews fills in cached preview paths, or queues generation for
+// clips that don't have them yet
+func (a *App) attachPreviews(clip *Clip) {
+	if filepath.Ext(clip.Path) == ".gif" || filepath.Ext(clip.Path) == ".webp" {
+		return
 	}
 
-	files, err := os.ReadDir(outputDir)
-	if err != nil {
-		// If dir doesn't exist, return empty
-		if os.IsNotExist(err) {
-			return []Clip{}, nil
-		}
-		return nil, err
+	p, ok := capture.CachedPreviews(clip.Path)
+	if !ok {
+		a.previews.Enqueue(clip.Path)
+		return
 	}
+	clip.Thumbnail = p.Poster
+	clip.SpriteSheet = p.Sprite
+	clip.SpriteIndex = p.Index
+}
 
-	var clips []Clip
-	for _, f := range files {
-		absPath := filepath.Join(outputDir, f.Name())
-
-		if f.IsDir() {
-			metadata, err := capture.ReadMetadata(absPath)
-			if err != nil {
-				continue
-			}
-
-			var folderSize int64
-			filepath.Walk(absPath, func(_ string, info os.FileInfo, _ error) error {
-				if info != nil && !info.IsDir() {
-					folderSize += info.Size()
-				}
-				return nil
-			})
-
-			info, _ := f.Info()
-			modTime := time.Now()
-			if info != nil {
-				modTime = info.ModTime()
-			}
-			if !metadata.CreatedAt.IsZero() {
-				modTime = metadata.CreatedAt
-			}
-
-			clips = append(clips, Clip{
-				Name:        f.Name(),
-				Path:        absPath,
-				Size:        folderSize,
-				ModTime:     modTime,
-				IsRawFolder: true,
-				DurationSec: metadata.DurationSec,
-			})
-			continue
-		}
-
-		ext := filepath.Ext(f.Name())
-		if ext != ".mp4" && ext != ".ts" {
-			continue
-		}
-
-		info, err := f.Info()
-		if err != nil {
-			continue
-		}
-
-		clips = append(clips, Clip{
-			Name:        f.Name(),
-			Path:        absPath,
-			Size:        info.Size(),
-			ModTime:     info.ModTime(),
-			IsRawFolder: false,
-		})
+// GetClips returns the saved clips in the output directory and its
+// subfolders, newest first
+func (a *App) GetClips() ([]Clip, error) {
+	page, err := a.QueryClips(library.Query{})
+	if err != nil {
+		return nil, err
 	}
-
-	return clips, nil
+	return page.Clips, nil
 }
 
 // OpenClip opens a clip in the default system player
@@ -676,12 +1041,13 @@ func (a *App) OpenClip(path string) error {
 
 // ConvertToMP4 converts a raw clip folder or .ts file to .mp4
 func (a *App) ConvertToMP4(inputPath string) error {
+	// The conversion runs unlocked, it can take a while
 	a.mu.Lock()
-	defer a.mu.Unlock()
-
 	if a.saver == nil {
-		a.saver = capture.NewSaver(a.ffmpegPath, a.config.OutputDir)
+		a.saver = a.newSaver()
 	}
+	saver, audio := a.saver, a.config.Audio
+	a.mu.Unlock()
 
 	// Check if input is a directory (raw folder) or a file
 	info, err := os.Stat(inputPath)
@@ -691,7 +1057,7 @@ func (a *App) ConvertToMP4(inputPath string) error {
 
 	if info.IsDir() {
 		// Raw folder conversion
-		if err := a.saver.ConvertRawFolder(inputPath, true); err != nil {
+		if err := saver.ConvertRawFolder(inputPath, true, audio); err != nil {
 			return err
 		}
 	} else {
@@ -706,40 +1072,212 @@ func (a *App) ConvertToMP4(inputPath string) error {
 		opts := capture.DefaultSaveOptions(nameWithoutExt)
 		opts.ConvertToMP4, opts.DeleteTS = true, true
 
-		if err := a.saver.ConvertToMP4(inputPath, opts); err != nil {
+		if err := saver.ConvertToMP4(inputPath, opts); err != nil {
 			return err
 		}
 	}
 
-	a.EmitClipsUpdate()
+	a.clipsChanged()
 	return nil
 }
 
-func (a *App) EmitClipsUpdate() {
-	if a.app != nil {
-		a.app.Event.Emit("clips-updated")
+// VerifyClip checks that a clip is playable and stores the result in its
+// metadata
+func (a *App) VerifyClip(path string) (*capture.Health, error) {
+	absPath, err := utils.ResolveAndValidatePath(path, a.GetConfig().OutputDir)
+	if err != nil {
+		return nil, fmt.Errorf("clip not found: %w", err)
+	}
+
+	// Without a sidecar there is nothing to compare against
+	metadata, _ := capture.ReadMetadata(absPath)
+	health := a.getSaver().Verify(absPath, metadata)
+	if err := capture.UpdateMetadata(absPath, func(m *capture.ClipMetadata) { m.Health = health }); err != nil {
+		slog.Warn("failed to store clip health", "path", absPath, "error", err)
 	}
+
+	a.refreshLibrary(absPath)
+	a.EmitClipsUpdate()
+	return health, nil
 }
 
-// --- Internal methods ---
+// RetryClip converts a clip that failed verification again from the
+// sources that were kept for it
+func (a *App) RetryClip(path string) (*capture.Health, error) {
+	absPath, err := utils.ResolveAndValidatePath(path, a.GetConfig().OutputDir)
+	if err != nil {
+		return nil, fmt.Errorf("clip not found: %w", err)
+	}
+
+	health, err := a.getSaver().RetryConversion(absPath, a.GetConfig().Audio)
+	if err != nil {
+		return nil, err
+	}
+
+	capture.RemovePreviews(absPath)
+	a.previews.Forget(absPath)
+	a.previews.Enqueue(absPath)
+	a.refreshLibrary(absPath)
+	a.EmitClipsUpdate()
+	return health, nil
+}
 
-func (a *App) setState(status Status, errorMsg string) {
-	a.state.Status = status
-	a.state.ErrorMessage = errorMsg
+// GetExportPresets returns the built-in export presets
+func (a *App) GetExportPresets() []capture.ExportPreset {
+	return capture.ExportPresets
+}
 
-	if a.OnStateChange != nil {
-		go a.OnStateChange(a.state)
+// ExportClip re-encodes an existing clip with a named preset. audio may set
+// per-track gains (dB by track label) and loudness normalization; nil keeps
+// the audio as is. Progress is emitted to the frontend as "export-progress"
+// events.
+func (a *App) ExportClip(path string, presetName string, audio *capture.AudioSettings) (string, error) {
+	preset, ok := capture.FindExportPreset(presetName)
+	if !ok {
+		return "", fmt.Errorf("unknown export preset: %s", presetName)
 	}
 
-	// Notify frontend
-	if a.app != nil {
-		a.app.Event.Emit("state-changed", a.state)
+	absPath, err := utils.ResolveAndValidatePath(path, a.GetConfig().OutputDir)
+	if err != nil {
+		return "", fmt.Errorf("clip not found: %w", err)
+	}
+
+	out, err := a.getSaver().Export(absPath, preset, audio, a.emitExportProgress)
+	if err != nil {
+		return "", err
+	}
+
+	a.clipsChanged()
+	return out, nil
+}
+
+// ExportAnimated exports a time range of a saved clip as GIF or WebP
+func (a *App) ExportAnimated(path string, opts capture.AnimatedOptions) (string, error) {
+	absPath, err := utils.ResolveAndValidatePath(path, a.GetConfig().OutputDir)
+	if err != nil {
+		return "", fmt.Errorf("clip not found: %w", err)
+	}
+
+	out, err := a.getSaver().ExportAnimated(absPath, opts, a.emitExportProgress)
+	if err != nil {
+		return "", err
+	}
+
+	a.clipsChanged()
+	return out, nil
+}
+
+// ExportAnimatedFromBuffer exports a time range of the live buffer as GIF
+// or WebP. StartSec is usually negative, counting back from now.
+func (a *App) ExportAnimatedFromBuffer(opts capture.AnimatedOptions) (string, error) {
+	a.mu.RLock()
+	if !a.state.Status.Capturing() || a.ringBuffer == nil || a.saver == nil {
+		a.mu.RUnlock()
+		return "", fmt.Errorf("not recording")
+	}
+	src, saver := a.ringBuffer, a.saver
+	a.mu.RUnlock()
+
+	out, err := saver.ExportAnimatedFromBuffer(src, opts, a.emitExportProgress)
+	if err != nil {
+		return "", err
 	}
 
-	// Notify tray manager
-	if a.onTrayStateChange != nil {
-		go a.onTrayStateChange(a.state)
+	a.clipsChanged()
+	return out, nil
+}
+
+// ConcatClips joins saved clips in the given order into a new highlight
+// reel. Progress is emitted as "export-progress" events.
+func (a *App) ConcatClips(paths []string, opts capture.ConcatOptions) (string, error) {
+	outputDir := a.GetConfig().OutputDir
+
+	absPaths := make([]string, 0, len(paths))
+	for _, p := range paths {
+		absPath, err := utils.ResolveAndValidatePath(p, outputDir)
+		if err != nil {
+			return "", fmt.Errorf("clip not found: %w", err)
+		}
+		absPaths = append(absPaths, absPath)
 	}
+
+	out, err := a.getSaver().Concat(absPaths, opts, a.emitExportProgress)
+	if err != nil {
+		return "", err
+	}
+
+	a.previews.Enqueue(out)
+	a.clipsChanged()
+	return out, nil
+}
+
+func (a *App) emitExportProgress(p capture.ExportProgress) {
+	a.emit("export-progress", p)
+}
+
+// getSaver returns the active saver, creating one for the output dir if
+// nothing is recording
+func (a *App) getSaver() *capture.Saver {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.saver == nil {
+		a.saver = a.newSaver()
+	}
+	return a.saver
+}
+
+// newSaver creates a saver for the output dir. Must be called with a.mu held.
+func (a *App) newSaver() *capture.Saver {
+	saver := capture.NewSaver(a.ffmpegPath, a.config.OutputDir)
+	saver.OnComplete = a.onClipWritten
+	return saver
+}
+
+// onClipWritten runs once the saver has finished writing a clip. Hooks
+// run on the ClipSaved event.
+func (a *App) onClipWritten(path string, err error) {
+	a.mu.Lock()
+	a.saveFinished()
+	a.mu.Unlock()
+
+	if err != nil {
+		a.publish(ClipSaveFailed{Error: err.Error()})
+		return
+	}
+	a.previews.Enqueue(path)
+	a.publish(ClipSaved{Path: path})
+	a.clipsChanged()
+	a.applyRetention(path)
+}
+
+// runHooks starts the post-save hooks for a clip that exists on disk
+func (a *App) runHooks(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		slog.Warn("skipping hooks, clip not found", "path", path, "error", err)
+		return
+	}
+
+	ev := hooks.Event{
+		Path:        path,
+		Name:        filepath.Base(path),
+		Size:        info.Size(),
+		IsRawFolder: info.IsDir(),
+		SavedAt:     time.Now(),
+	}
+	if metadata, err := capture.ReadMetadata(path); err == nil {
+		ev.Metadata = metadata
+	}
+	a.hooks.Run(ev)
+}
+
+func (a *App) emitHookResult(res hooks.Result) {
+	a.emit("hook-result", res)
+}
+
+func (a *App) EmitClipsUpdate() {
+	a.emit("clips-updated")
 }
 
 // --- DTOs for Wails binding ---
@@ -0,0 +1,54 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rewind/internal/capture"
+	"rewind/internal/library"
+)
+
+func TestConvertToMP4(t *testing.T) {
+	a := newTestApp(t)
+	raw := filepath.Join(a.config.OutputDir, "clip")
+
+	video, err := os.ReadFile(filepath.Join("..", "remux", "testdata", "h264.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(raw, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(raw, "video.ts"), video, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := capture.UpdateMetadata(raw, func(m *capture.ClipMetadata) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- a.ConvertToMP4(raw) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ConvertToMP4() error = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("ConvertToMP4() did not return")
+	}
+
+	if _, err := os.Stat(raw + ".mp4"); err != nil {
+		t.Errorf("converted clip missing: %v", err)
+	}
+	if _, err := os.Stat(raw); !os.IsNotExist(err) {
+		t.Errorf("raw folder left behind: %v", err)
+	}
+
+	// The app stays usable afterwards
+	page, err := a.QueryClips(library.Query{})
+	if err != nil || page.Total != 1 {
+		t.Errorf("QueryClips() = %d clips, %v; want the converted clip", page.Total, err)
+	}
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+
+	"rewind/internal/foreground"
+)
+
+// configureAutoSwitch starts or stops the foreground watcher to match the
+// settings. Must be called with a.mu held.
+func (a *App) configureAutoSwitch(s foreground.Settings) {
+	a.watcher.SetSettings(s)
+	if s.Enabled && len(s.Rules) > 0 {
+		a.watcher.Start()
+	} else {
+		a.watcher.Stop()
+		a.autoSwitchGame = ""
+	}
+}
+
+// onAutoSwitch applies a debounced decision of the foreground watcher:
+// first the profile, then auto-record. Recording starts only when a game
+// starts running, so focus changes never restart a recording the user
+// stopped.
+func (a *App) onAutoSwitch(d foreground.Decision) {
+	a.mu.Lock()
+	enabled := a.config.AutoSwitch.Enabled
+	active := a.activeProfile
+	autoRecording := a.autoRecording
+	prevGame := a.autoSwitchGame
+	if enabled {
+		a.autoSwitchGame = d.Game
+	}
+	a.mu.Unlock()
+
+	if !enabled {
+		return
+	}
+
+	slog.Info("auto-switch rules matched",
+		"rule", d.Rule,
+		"process", d.Window.ProcessName(),
+		"title", d.Window.Title,
+		"profile", d.Profile,
+		"game", d.Game,
+	)
+
+	if d.Profile != "" && !strings.EqualFold(d.Profile, active) {
+		if err := a.SwitchProfile(d.Profile); err != nil {
+			slog.Warn("auto-switch failed", "rule", d.Rule, "profile", d.Profile, "error", err)
+		} else {
+			slog.Info("profile switched automatically", "rule", d.Rule, "from", active, "to", d.Profile)
+		}
+	}
+
+	switch {
+	case d.Game != "" && prevGame == "" && !a.IsRecording():
+		if err := a.Start(); err != nil {
+			slog.Warn("auto-record failed to start", "rule", d.Game, "error", err)
+			break
+		}
+		a.mu.Lock()
+		a.autoRecording = true
+		a.mu.Unlock()
+		slog.Info("recording started automatically", "rule", d.Game)
+	case d.Game == "" && autoRecording && a.IsRecording():
+		if err := a.Stop(); err != nil {
+			slog.Warn("auto-record failed to stop", "error", err)
+			break
+		}
+		slog.Info("recording stopped automatically, game exited")
+	}
+
+	a.emit("auto-switch", d)
+}
+
+// GetRunningProcesses returns the sorted names of running processes, for
+// picking auto-switch rule targets
+func (a *App) GetRunningProcesses() ([]string, error) {
+	names, err := foreground.Processes()
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(names)
+	return slices.Compact(names), nil
+}
@@ -0,0 +1,217 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"rewind/internal/capture"
+	"rewind/internal/library"
+	"rewind/internal/utils"
+)
+
+// outputRoot returns the absolute output directory
+func (a *App) outputRoot() (string, error) {
+	root, err := utils.ResolveAbsPath(a.GetConfig().OutputDir, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve output directory: %w", err)
+	}
+	return filepath.Clean(root), nil
+}
+
+// resolveClip resolves an existing clip path and checks that it lies inside
+// the output directory. It returns the output directory and the clip path.
+func (a *App) resolveClip(path string) (root, absPath string, err error) {
+	root, err = a.outputRoot()
+	if err != nil {
+		return "", "", err
+	}
+	absPath, err = utils.ResolveAndValidatePath(path, root)
+	if err != nil {
+		return "", "", fmt.Errorf("clip not found: %w", err)
+	}
+	absPath = filepath.Clean(absPath)
+
+	rel, err := filepath.Rel(root, absPath)
+	if err != nil {
+		return "", "", fmt.Errorf("path is outside the output directory")
+	}
+	if err := library.WithinLibrary(rel); err != nil {
+		return "", "", err
+	}
+	return root, absPath, nil
+}
+
+// RenameClip renames a clip in place, keeping its sidecar, previews and
+// tags. The extension is kept if newName has none. It returns the new path.
+func (a *App) RenameClip(path, newName string) (string, error) {
+	_, absPath, err := a.resolveClip(path)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.ContainsAny(newName, `/\`) {
+		return "", fmt.Errorf("name must not contain path separators")
+	}
+	name := capture.SanitizeName(newName)
+	if name == "" {
+		return "", fmt.Errorf("name is empty")
+	}
+	if info, err := os.Stat(absPath); err == nil && !info.IsDir() {
+		if ext := filepath.Ext(absPath); !strings.EqualFold(filepath.Ext(name), ext) {
+			name += ext
+		}
+	}
+
+	newPath := filepath.Join(filepath.Dir(absPath), name)
+	if newPath == absPath {
+		return absPath, nil
+	}
+	if err := library.MoveClip(absPath, newPath); err != nil {
+		return "", fmt.Errorf("failed to rename clip: %w", err)
+	}
+	a.previews.Forget(absPath)
+
+	slog.Info("clip renamed", "from", absPath, "to", newPath)
+	a.clipsChanged()
+	return newPath, nil
+}
+
+// MoveClip moves a clip into folder, a path relative to the output
+// directory. An empty folder moves it to the top level. It returns the new
+// path.
+func (a *App) MoveClip(path, folder string) (string, error) {
+	root, absPath, err := a.resolveClip(path)
+	if err != nil {
+		return "", err
+	}
+
+	dir := root
+	if folder = strings.Trim(filepath.Clean(filepath.FromSlash(folder)), string(filepath.Separator)); folder != "." && folder != "" {
+		if err := library.WithinLibrary(folder); err != nil {
+			return "", err
+		}
+		for _, part := range strings.Split(folder, string(filepath.Separator)) {
+			if capture.SanitizeName(part) != part {
+				return "", fmt.Errorf("invalid folder name: %s", part)
+			}
+		}
+		dir = filepath.Join(root, folder)
+	}
+
+	newPath := filepath.Join(dir, filepath.Base(absPath))
+	if newPath == absPath {
+		return absPath, nil
+	}
+	if err := library.MoveClip(absPath, newPath); err != nil {
+		return "", fmt.Errorf("failed to move clip: %w", err)
+	}
+	a.previews.Forget(absPath)
+
+	slog.Info("clip moved", "from", absPath, "to", newPath)
+	a.clipsChanged()
+	return newPath, nil
+}
+
+// RevealClip shows a clip selected in the file manager
+func (a *App) RevealClip(path string) error {
+	_, absPath, err := a.resolveClip(path)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("explorer", "/select,"+absPath)
+	return cmd.Start()
+}
+
+// DeleteClip moves a clip with its sidecar and previews to the trash, from
+// where it can be restored until purged. Locked clips must be unlocked
+// first.
+func (a *App) DeleteClip(path string) error {
+	root, absPath, err := a.resolveClip(path)
+	if err != nil {
+		return err
+	}
+
+	if m, err := capture.ReadMetadata(absPath); err == nil && m.Locked {
+		return fmt.Errorf("clip is locked")
+	}
+
+	item, err := library.NewTrash(root).Add(absPath)
+	if err != nil {
+		return fmt.Errorf("failed to delete clip: %w", err)
+	}
+	a.previews.Forget(absPath)
+
+	slog.Info("clip moved to trash", "path", absPath, "id", item.ID)
+	a.clipsChanged()
+	return nil
+}
+
+// GetTrash lists the deleted clips that can still be restored
+func (a *App) GetTrash() ([]library.TrashItem, error) {
+	root, err := a.outputRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := library.NewTrash(root).List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trash: %w", err)
+	}
+	return items, nil
+}
+
+// RestoreClip moves a clip out of the trash back to its original folder and
+// returns its path
+func (a *App) RestoreClip(id string) (string, error) {
+	root, err := a.outputRoot()
+	if err != nil {
+		return "", err
+	}
+
+	path, err := library.NewTrash(root).Restore(id)
+	if err != nil {
+		return "", fmt.Errorf("failed to restore clip: %w", err)
+	}
+	a.previews.Forget(path)
+
+	slog.Info("clip restored", "id", id, "path", path)
+	a.clipsChanged()
+	return path, nil
+}
+
+// PurgeTrash permanently deletes clips from the trash
+func (a *App) PurgeTrash(ids []string) error {
+	root, err := a.outputRoot()
+	if err != nil {
+		return err
+	}
+
+	if err := library.NewTrash(root).Purge(ids); err != nil {
+		return fmt.Errorf("failed to purge trash: %w", err)
+	}
+
+	slog.Info("trash purged", "count", len(ids))
+	a.EmitClipsUpdate()
+	return nil
+}
+
+// EmptyTrash permanently deletes every clip in the trash
+func (a *App) EmptyTrash() error {
+	root, err := a.outputRoot()
+	if err != nil {
+		return err
+	}
+
+	if err := library.NewTrash(root).Empty(); err != nil {
+		return fmt.Errorf("failed to empty trash: %w", err)
+	}
+
+	slog.Info("trash emptied")
+	a.EmitClipsUpdate()
+	return nil
+}
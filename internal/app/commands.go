@@ -0,0 +1,127 @@
+package app
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Command is an action requested on the command line of a second launch,
+// e.g. a desktop shortcut running "Rewind.exe --save-clip --duration 60"
+type Command struct {
+	Start    bool   `json:"start,omitempty"`
+	Stop     bool   `json:"stop,omitempty"`
+	SaveClip bool   `json:"saveClip,omitempty"`
+	Duration int    `json:"duration,omitempty"` // seconds to keep, 0 = whole buffer
+	Profile  string `json:"profile,omitempty"`
+}
+
+// commandFlags defines the command flags, storing them in c
+func commandFlags(c *Command) *flag.FlagSet {
+	fs := flag.NewFlagSet("rewind", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&c.Start, "start", false, "start recording")
+	fs.BoolVar(&c.Stop, "stop", false, "stop recording")
+	fs.BoolVar(&c.SaveClip, "save-clip", false, "save a clip")
+	fs.IntVar(&c.Duration, "duration", 0, "seconds to keep when saving")
+	fs.StringVar(&c.Profile, "profile", "", "profile to activate")
+	return fs
+}
+
+// HasCommandFlag reports whether args name any command flag. Launches
+// without one open the app, whatever else they pass.
+func HasCommandFlag(args []string) bool {
+	fs := commandFlags(&Command{})
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, ok := strings.CutPrefix(arg, "-")
+		if !ok {
+			continue
+		}
+		name, _, _ = strings.Cut(strings.TrimPrefix(name, "-"), "=")
+		if fs.Lookup(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCommand reads command flags. Arguments without any command flag
+// give an empty command.
+func ParseCommand(args []string) (Command, error) {
+	var c Command
+	fs := commandFlags(&c)
+
+	if err := fs.Parse(args); err != nil {
+		return Command{}, err
+	}
+	if fs.NArg() > 0 {
+		return Command{}, fmt.Errorf("unexpected argument: %s", fs.Arg(0))
+	}
+	if c.Start && c.Stop {
+		return Command{}, fmt.Errorf("--start and --stop are mutually exclusive")
+	}
+	if c.Duration < 0 {
+		return Command{}, fmt.Errorf("--duration must not be negative")
+	}
+	if c.Duration > 0 && !c.SaveClip {
+		return Command{}, fmt.Errorf("--duration requires --save-clip")
+	}
+	return c, nil
+}
+
+// Empty reports whether the command asks for nothing
+func (c Command) Empty() bool {
+	return c == Command{}
+}
+
+// Args formats the command as flags that ParseCommand reads back
+func (c Command) Args() []string {
+	var args []string
+	if c.Profile != "" {
+		args = append(args, "--profile", c.Profile)
+	}
+	if c.Stop {
+		args = append(args, "--stop")
+	}
+	if c.Start {
+		args = append(args, "--start")
+	}
+	if c.SaveClip {
+		args = append(args, "--save-clip")
+	}
+	if c.Duration > 0 {
+		args = append(args, "--duration", fmt.Sprint(c.Duration))
+	}
+	return args
+}
+
+// RunCommand executes a command: the profile first, then stop, start and
+// save. It returns the saved clip name, if any.
+func (a *App) RunCommand(c Command) (string, error) {
+	slog.Info("running command", "args", strings.Join(c.Args(), " "))
+
+	if c.Profile != "" && !strings.EqualFold(c.Profile, a.GetActiveProfile()) {
+		if err := a.SwitchProfile(c.Profile); err != nil {
+			return "", err
+		}
+	}
+	if c.Stop && a.IsRecording() {
+		if err := a.Stop(); err != nil {
+			return "", err
+		}
+	}
+	if c.Start && !a.IsRecording() {
+		if err := a.Start(); err != nil {
+			return "", err
+		}
+	}
+	if c.SaveClip {
+		return a.SaveClipFor(c.Duration)
+	}
+	return "", nil
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    Command
+		wantErr string
+	}{
+		{args: nil, want: Command{}},
+		{args: []string{"--start"}, want: Command{Start: true}},
+		{args: []string{"-stop"}, want: Command{Stop: true}},
+		{args: []string{"--save-clip", "--duration", "60"}, want: Command{SaveClip: true, Duration: 60}},
+		{args: []string{"--duration=15", "--save-clip"}, want: Command{SaveClip: true, Duration: 15}},
+		{args: []string{"--profile", "My Game", "--start"}, want: Command{Profile: "My Game", Start: true}},
+		{args: []string{"--stop", "--profile=Work", "--start=false"}, want: Command{Stop: true, Profile: "Work"}},
+		{args: []string{"--start", "--stop"}, wantErr: "mutually exclusive"},
+		{args: []string{"--stop", "--start", "--save-clip"}, wantErr: "mutually exclusive"},
+		{args: []string{"--duration", "60"}, wantErr: "requires --save-clip"},
+		{args: []string{"--save-clip", "--duration", "-5"}, wantErr: "must not be negative"},
+		{args: []string{"--save-clip", "--duration", "soon"}, wantErr: "invalid value"},
+		{args: []string{"--start", "extra"}, wantErr: "unexpected argument"},
+		{args: []string{"--save-clip", "--minimized"}, wantErr: "not defined"},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseCommand(tt.args)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseCommand(%q) error = %v, want %q", tt.args, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseCommand(%q) error = %v", tt.args, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseCommand(%q) = %+v, want %+v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestCommandArgsRoundTrip(t *testing.T) {
+	tests := []struct {
+		cmd  Command
+		args []string
+	}{
+		{Command{}, nil},
+		{Command{Start: true}, []string{"--start"}},
+		{Command{Stop: true}, []string{"--stop"}},
+		{Command{SaveClip: true}, []string{"--save-clip"}},
+		{Command{SaveClip: true, Duration: 90}, []string{"--save-clip", "--duration", "90"}},
+		{
+			Command{Profile: "-tricky name", Stop: true, SaveClip: true, Duration: 5},
+			[]string{"--profile", "-tricky name", "--stop", "--save-clip", "--duration", "5"},
+		},
+	}
+
+	for _, tt := range tests {
+		args := tt.cmd.Args()
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%+v.Args() = %q, want %q", tt.cmd, args, tt.args)
+		}
+		got, err := ParseCommand(args)
+		if err != nil || got != tt.cmd {
+			t.Errorf("ParseCommand(%q) = %+v, %v, want %+v", args, got, err, tt.cmd)
+		}
+		if got.Empty() != (len(args) == 0) {
+			t.Errorf("%+v.Empty() = %v", got, got.Empty())
+		}
+	}
+}
+
+func TestHasCommandFlag(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{nil, false},
+		{[]string{"--minimized"}, false},
+		{[]string{"-psn_0_12345"}, false},
+		{[]string{"start"}, false},
+		{[]string{"--", "--start"}, false},
+		{[]string{"--start"}, true},
+		{[]string{"-save-clip"}, true},
+		{[]string{"--minimized", "--duration=30"}, true},
+		{[]string{"--profile", "Work"}, true},
+	}
+
+	for _, tt := range tests {
+		if got := HasCommandFlag(tt.args); got != tt.want {
+			t.Errorf("HasCommandFlag(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
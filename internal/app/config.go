@@ -2,15 +2,233 @@ package app
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 
+	"rewind/internal/capture"
 	"rewind/internal/utils"
 )
 
 const configFileName = "settings.json"
 
+// ConfigVersion is the schema version written to settings.json. Files
+// without a version are version 1.
+const ConfigVersion = 2
+
+// configMigrations[n] upgrades a settings file from version n to n+1. Add
+// a migration whenever a field is renamed, moved or changes meaning.
+var configMigrations = map[int]func(raw map[string]any){
+	// v2 moved mixAudioTrack into the audio settings
+	1: func(raw map[string]any) {
+		mix, ok := raw["mixAudioTrack"]
+		if !ok {
+			return
+		}
+		delete(raw, "mixAudioTrack")
+
+		audio, _ := raw["audio"].(map[string]any)
+		if audio == nil {
+			audio = map[string]any{}
+			raw["audio"] = audio
+		}
+		if _, set := audio["mix"]; !set {
+			audio["mix"] = mix
+		}
+	},
+}
+
+// maxPostRollSeconds bounds the post-roll
+const maxPostRollSeconds = 300
+
+// ConfigIssue is a setting that was invalid and reset to its default
+type ConfigIssue struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// newerConfigIssue is reported while settings.json is from a newer version
+var newerConfigIssue = ConfigIssue{
+	Field:   "version",
+	Message: "settings were saved by a newer version of Rewind and are not changed by this one",
+}
+
+// configField validates one setting and can reset it to its default
+type configField struct {
+	name  string
+	check func(c *Config) error
+	reset func(c *Config, def Config)
+}
+
+// configFields holds the checks that don't depend on detected hardware
+var configFields = []configField{
+	{"fps", func(c *Config) error {
+		if c.FPS <= 0 || c.FPS > 240 {
+			return fmt.Errorf("FPS must be between 1 and 240")
+		}
+		return nil
+	}, func(c *Config, def Config) { c.FPS = def.FPS }},
+	{"bitrate", func(c *Config) error {
+		if c.Bitrate == "" {
+			return fmt.Errorf("bitrate must not be empty")
+		}
+		return nil
+	}, func(c *Config, def Config) { c.Bitrate = def.Bitrate }},
+	{"recordSeconds", func(c *Config) error {
+		if c.RecordSeconds <= 0 {
+			return fmt.Errorf("record seconds must be positive")
+		}
+		return nil
+	}, func(c *Config, def Config) { c.RecordSeconds = def.RecordSeconds }},
+	{"postRollSeconds", func(c *Config) error {
+		// The post-roll is held in memory until the clip is written
+		if c.PostRollSeconds < 0 || c.PostRollSeconds > maxPostRollSeconds {
+			return fmt.Errorf("post-roll seconds must be between 0 and %d", maxPostRollSeconds)
+		}
+		return nil
+	}, func(c *Config, def Config) { c.PostRollSeconds = def.PostRollSeconds }},
+	{"outputDir", func(c *Config) error {
+		if c.OutputDir == "" {
+			return fmt.Errorf("output directory must not be empty")
+		}
+		return nil
+	}, func(c *Config, def Config) { c.OutputDir = def.OutputDir }},
+	{"micVolume", func(c *Config) error {
+		if c.MicVolume < 0 || c.MicVolume > 200 {
+			return fmt.Errorf("microphone volume must be between 0 and 200")
+		}
+		return nil
+	}, func(c *Config, def Config) { c.MicVolume = def.MicVolume }},
+	{"sysVolume", func(c *Config) error {
+		if c.SysVolume < 0 || c.SysVolume > 200 {
+			return fmt.Errorf("system volume must be between 0 and 200")
+		}
+		return nil
+	}, func(c *Config, def Config) { c.SysVolume = def.SysVolume }},
+	{"filenameTemplate", func(c *Config) error {
+		return capture.ValidateTemplate(c.FilenameTemplate, false)
+	}, func(c *Config, def Config) { c.FilenameTemplate = def.FilenameTemplate }},
+	{"folderTemplate", func(c *Config) error {
+		return capture.ValidateTemplate(c.FolderTemplate, true)
+	}, func(c *Config, def Config) { c.FolderTemplate = def.FolderTemplate }},
+	{"audio", func(c *Config) error {
+		return c.Audio.Validate()
+	}, func(c *Config, def Config) { c.Audio = def.Audio }},
+	{"retention", func(c *Config) error {
+		r := c.Retention
+		if r.MaxTotalMB < 0 || r.MaxAgeDays < 0 || r.MaxCount < 0 || r.TrashDays < 0 {
+			return fmt.Errorf("retention limits must not be negative")
+		}
+		return nil
+	}, func(c *Config, def Config) { c.Retention = def.Retention }},
+	{"hooks", func(c *Config) error {
+		for _, h := range c.Hooks {
+			if err := h.Validate(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(c *Config, def Config) { c.Hooks = def.Hooks }},
+	{"autoSwitch", func(c *Config) error {
+		return c.AutoSwitch.Validate()
+	}, func(c *Config, def Config) { c.AutoSwitch = def.AutoSwitch }},
+	{"api", func(c *Config) error {
+		return c.API.Validate()
+	}, func(c *Config, def Config) { c.API = def.API }},
+	{"obsWebsocket", func(c *Config) error {
+		return c.OBS.Validate()
+	}, func(c *Config, def Config) { c.OBS = def.OBS }},
+}
+
+// validate returns the first invalid setting
+func (c *Config) validate() error {
+	for _, f := range configFields {
+		if err := f.check(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sanitize resets invalid settings to their defaults and reports them
+func (c *Config) sanitize(def Config) []ConfigIssue {
+	var issues []ConfigIssue
+	for _, f := range configFields {
+		if err := f.check(c); err != nil {
+			issues = append(issues, ConfigIssue{Field: f.name, Message: err.Error()})
+			f.reset(c, def)
+		}
+	}
+	return issues
+}
+
+// decodeConfig parses a settings document of any schema version and
+// returns the version it was written with. Missing fields keep their
+// defaults and invalid values are reset and reported.
+func decodeConfig(data []byte) (cfg Config, issues []ConfigIssue, version int, err error) {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return Config{}, nil, 0, err
+	}
+
+	version = 1
+	if v, ok := raw["version"].(float64); ok {
+		version = int(v)
+	}
+	if version > ConfigVersion {
+		slog.Warn("config is from a newer version, unknown settings are ignored",
+			"version", version, "supported", ConfigVersion)
+	}
+	for v := version; v < ConfigVersion; v++ {
+		if migrate, ok := configMigrations[v]; ok {
+			migrate(raw)
+		}
+		slog.Info("config migrated", "from", v, "to", v+1)
+	}
+
+	// Decode over the defaults so missing fields keep their default value,
+	// one setting at a time so a value of the wrong type only resets itself
+	def := DefaultConfig()
+	cfg = DefaultConfig() // shares no maps with def
+	for _, key := range slices.Sorted(maps.Keys(raw)) {
+		field, err := json.Marshal(map[string]any{key: raw[key]})
+		if err != nil {
+			return Config{}, nil, 0, err
+		}
+		// Check on a scratch value first, a failed decode leaves partial
+		// values behind
+		var scratch Config
+		if err := json.Unmarshal(field, &scratch); err != nil {
+			issues = append(issues, ConfigIssue{Field: key, Message: typeMessage(err)})
+			continue
+		}
+		if err := json.Unmarshal(field, &cfg); err != nil {
+			return Config{}, nil, 0, err
+		}
+	}
+
+	issues = append(issues, cfg.sanitize(def)...)
+	for _, issue := range issues {
+		slog.Warn("invalid setting reset to default", "field", issue.Field, "error", issue.Message)
+	}
+
+	cfg.Version = ConfigVersion
+	return cfg, issues, version, nil
+}
+
+// typeMessage describes why a setting could not be decoded
+func typeMessage(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value)
+	}
+	return err.Error()
+}
+
 func getConfigFilePath() (string, error) {
 	configDir, err := utils.GetConfigDir()
 	if err != nil {
@@ -19,6 +237,11 @@ func getConfigFilePath() (string, error) {
 	return filepath.Join(configDir, configFileName), nil
 }
 
+// LoadConfig restores the saved settings. Older files are migrated to the
+// current schema, missing fields keep their defaults and invalid values are
+// reset and reported through GetConfigIssues. Files from a newer version
+// are used but never rewritten, so going back to this version loses none
+// of their settings.
 func (a *App) LoadConfig() error {
 	configPath, err := getConfigFilePath()
 	if err != nil {
@@ -35,22 +258,36 @@ func (a *App) LoadConfig() error {
 		return err
 	}
 
-	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
+	cfg, issues, version, err := decodeConfig(data)
+	if err != nil {
 		slog.Warn("failed to parse config file, using defaults", "error", err)
 		return nil
 	}
 
-	//a.config = cfg   // todo:
-	if a.config.OutputDir != cfg.OutputDir {
-		slog.Info("output directory changed", "old", a.config.OutputDir, "new", cfg.OutputDir)
-		a.config.OutputDir = cfg.OutputDir
+	a.config = cfg
+	a.configIssues = issues
+	a.configNewer = version > ConfigVersion
+
+	if a.configNewer {
+		a.configIssues = append(a.configIssues, newerConfigIssue)
+	} else if version < ConfigVersion || len(issues) > 0 {
+		if err := saveConfigToFile(cfg); err != nil {
+			slog.Warn("failed to save migrated config", "error", err)
+		}
 	}
 
 	slog.Info("config loaded", "path", configPath)
 	return nil
 }
 
+// GetConfigIssues returns the settings that were invalid when the config
+// was loaded and have been reset to their defaults
+func (a *App) GetConfigIssues() []ConfigIssue {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.configIssues
+}
+
 func saveConfigToFile(cfg Config) error {
 	slog.Info("saving config...")
 
@@ -60,13 +297,14 @@ func saveConfigToFile(cfg Config) error {
 		return err
 	}
 
+	cfg.Version = ConfigVersion
 	data, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
 		slog.Warn("failed to marshal config", "error", err)
 		return err
 	}
 
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
+	if err := utils.WriteFileAtomic(configPath, data); err != nil {
 		slog.Warn("failed to write config file", "error", err)
 		return err
 	}
@@ -0,0 +1,151 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"rewind/internal/hooks"
+)
+
+func TestDecodeConfigVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantVersion int
+		wantMix     bool
+	}{
+		{name: "unversioned is version 1", data: `{"mixAudioTrack": false}`, wantVersion: 1, wantMix: false},
+		{name: "current", data: `{"version": 2, "audio": {"mix": false}}`, wantVersion: 2, wantMix: false},
+		{name: "newer keeps its version", data: `{"version": 9, "futureSetting": 1}`, wantVersion: 9, wantMix: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _, version, err := decodeConfig([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("decodeConfig() error = %v", err)
+			}
+			if version != tt.wantVersion {
+				t.Errorf("version = %d, want %d", version, tt.wantVersion)
+			}
+			if cfg.Version != ConfigVersion {
+				t.Errorf("cfg.Version = %d, want %d", cfg.Version, ConfigVersion)
+			}
+			if cfg.Audio.Mix != tt.wantMix {
+				t.Errorf("cfg.Audio.Mix = %v, want %v", cfg.Audio.Mix, tt.wantMix)
+			}
+		})
+	}
+}
+
+func TestDecodeConfigTrashDays(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		want       int
+		wantIssues int
+	}{
+		{name: "saved before the setting", data: `{"version": 2, "retention": {"maxCount": 100}}`, want: 30},
+		{name: "kept until emptied", data: `{"version": 2, "retention": {"trashDays": 0}}`, want: 0},
+		{name: "custom", data: `{"version": 2, "retention": {"trashDays": 7}}`, want: 7},
+		{name: "negative", data: `{"version": 2, "retention": {"trashDays": -1}}`, want: 30, wantIssues: 1},
+		{name: "wrong type", data: `{"version": 2, "retention": {"trashDays": "7"}}`, want: 30, wantIssues: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, issues, _, err := decodeConfig([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("decodeConfig() error = %v", err)
+			}
+			if cfg.Retention.TrashDays != tt.want {
+				t.Errorf("TrashDays = %d, want %d", cfg.Retention.TrashDays, tt.want)
+			}
+			if len(issues) != tt.wantIssues {
+				t.Errorf("issues = %v, want %d", issues, tt.wantIssues)
+			}
+		})
+	}
+}
+
+func TestDecodeConfigWrongType(t *testing.T) {
+	data := `{"version": 2, "fps": "60", "bitrate": "50M", "audio": {"mix": "yes"}, "recordSeconds": 120}`
+	cfg, issues, _, err := decodeConfig([]byte(data))
+	if err != nil {
+		t.Fatalf("decodeConfig() error = %v", err)
+	}
+
+	def := DefaultConfig()
+	if cfg.FPS != def.FPS || !reflect.DeepEqual(cfg.Audio, def.Audio) {
+		t.Errorf("wrongly typed settings = %d, %+v; want the defaults", cfg.FPS, cfg.Audio)
+	}
+	if cfg.Bitrate != "50M" || cfg.RecordSeconds != 120 {
+		t.Errorf("other settings = %q, %d; want them kept", cfg.Bitrate, cfg.RecordSeconds)
+	}
+
+	var fields []string
+	for _, issue := range issues {
+		fields = append(fields, issue.Field)
+	}
+	if want := []string{"audio", "fps"}; !slices.Equal(fields, want) {
+		t.Errorf("issues = %v, want %v", issues, want)
+	}
+}
+
+func TestDecodeConfigPostRoll(t *testing.T) {
+	tests := []struct {
+		postRoll  int
+		want      int
+		wantIssue bool
+	}{
+		{postRoll: 0, want: 0},
+		{postRoll: 30, want: 30},
+		{postRoll: maxPostRollSeconds, want: maxPostRollSeconds},
+		{postRoll: maxPostRollSeconds + 1, want: 0, wantIssue: true},
+		{postRoll: -5, want: 0, wantIssue: true},
+	}
+
+	for _, tt := range tests {
+		cfg, issues, _, err := decodeConfig(fmt.Appendf(nil, `{"version": 2, "postRollSeconds": %d}`, tt.postRoll))
+		if err != nil {
+			t.Fatalf("decodeConfig() error = %v", err)
+		}
+		if cfg.PostRollSeconds != tt.want || (len(issues) > 0) != tt.wantIssue {
+			t.Errorf("postRollSeconds %d: got %d with issues %v, want %d", tt.postRoll, cfg.PostRollSeconds, issues, tt.want)
+		}
+	}
+}
+
+func TestConfigLogValue(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	cfg := DefaultConfig()
+	cfg.API.Token = "0123456789abcdef-api"
+	cfg.OBS.Password = "obs-secret"
+	cfg.Hooks = []hooks.Hook{{
+		Name:    "upload",
+		Type:    hooks.TypeWebhook,
+		URL:     "http://127.0.0.1:8080/clips",
+		Headers: map[string]string{"Authorization": "Bearer webhook-secret", "X-Api-Key": "key-secret"},
+	}}
+	logger.Info("config updated", "config", cfg)
+
+	out := buf.String()
+	for _, secret := range []string{cfg.API.Token, cfg.OBS.Password, "webhook-secret", "key-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log line contains %q: %s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "Authorization:[redacted]") || !strings.Contains(out, "http://127.0.0.1:8080/clips") {
+		t.Errorf("log line = %s", out)
+	}
+	if cfg.Hooks[0].Headers["Authorization"] != "Bearer webhook-secret" {
+		t.Error("LogValue() changed the headers of the config")
+	}
+}
@@ -0,0 +1,80 @@
+package app
+
+import "rewind/internal/events"
+
+// StateChanged is published on every state transition. It embeds the new
+// state, so its JSON is a superset of State.
+type StateChanged struct {
+	State
+	From   Status `json:"from"`
+	Reason Reason `json:"reason"`
+}
+
+func (StateChanged) Topic() string { return "state-changed" }
+
+// ClipCaptured is published once the content of a clip is complete and it
+// is being written
+type ClipCaptured struct {
+	Filename string `json:"filename"`
+}
+
+func (ClipCaptured) Topic() string { return "clip-captured" }
+
+// ClipSaved is published once a clip has been written
+type ClipSaved struct {
+	Path string `json:"path"`
+}
+
+func (ClipSaved) Topic() string { return "clip-saved" }
+
+// ClipSaveFailed is published when writing a clip failed
+type ClipSaveFailed struct {
+	Error string `json:"error"`
+}
+
+func (ClipSaveFailed) Topic() string { return "clip-save-failed" }
+
+// Message is an event without a dedicated type; the frontend receives Data
+type Message struct {
+	Name string
+	Data any
+}
+
+func (m Message) Topic() string { return m.Name }
+
+// eventData is the payload the frontend and API clients receive for ev
+func eventData(ev events.Event) any {
+	if m, ok := ev.(Message); ok {
+		return m.Data
+	}
+	return ev
+}
+
+// Events returns the bus every App event is published on. Handlers run on
+// their own goroutine and may call back into App.
+func (a *App) Events() *events.Bus {
+	return a.bus
+}
+
+// publish sends a typed event to the frontend and all subscribers
+func (a *App) publish(ev events.Event) {
+	a.bus.Publish(ev)
+}
+
+// emit publishes an untyped event
+func (a *App) emit(name string, data ...any) {
+	var payload any
+	if len(data) > 0 {
+		payload = data[0]
+	}
+	a.publish(Message{Name: name, Data: payload})
+}
+
+// forwardToFrontend sends bus events on as Wails events
+func (a *App) forwardToFrontend(ev events.Event) {
+	if data := eventData(ev); data != nil {
+		a.app.Event.Emit(ev.Topic(), data)
+	} else {
+		a.app.Event.Emit(ev.Topic())
+	}
+}
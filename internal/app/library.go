@@ -0,0 +1,123 @@
+package app
+
+import (
+	"fmt"
+
+	"rewind/internal/capture"
+	"rewind/internal/library"
+	"rewind/internal/utils"
+)
+
+// ClipPage is one page of QueryClips results
+type ClipPage struct {
+	Clips []Clip `json:"clips"`
+	Total int    `json:"total"` // matches before paging
+}
+
+// libraryIndex returns the index of the current output directory, opening
+// it on first use and whenever the directory changes
+func (a *App) libraryIndex() (*library.Index, error) {
+	outputDir, err := utils.ResolveAbsPath(a.GetConfig().OutputDir, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve output directory: %w", err)
+	}
+
+	a.libraryMu.Lock()
+	defer a.libraryMu.Unlock()
+
+	if a.library == nil || a.library.Root() != outputDir {
+		a.library = library.Open(outputDir)
+	}
+	return a.library, nil
+}
+
+// QueryClips searches, filters, sorts and pages the saved clips
+func (a *App) QueryClips(q library.Query) (ClipPage, error) {
+	idx, err := a.libraryIndex()
+	if err != nil {
+		return ClipPage{}, err
+	}
+	if err := idx.SyncIfStale(); err != nil {
+		return ClipPage{}, fmt.Errorf("failed to scan clips: %w", err)
+	}
+
+	page := idx.Query(q)
+	result := ClipPage{Clips: make([]Clip, 0, len(page.Items)), Total: page.Total}
+	for _, it := range page.Items {
+		clip := Clip{
+			Name:        it.Name,
+			Path:        it.Path,
+			Size:        it.Size,
+			ModTime:     it.Time,
+			IsRawFolder: it.IsRawFolder,
+			Folder:      it.Folder,
+			Metadata:    it.Metadata,
+		}
+		if m := it.Metadata; m != nil {
+			clip.DurationSec = m.DurationSec
+			if m.Health != nil {
+				clip.Health = m.Health.Status
+			}
+		}
+		a.attachPreviews(&clip)
+		result.Clips = append(result.Clips, clip)
+	}
+	return result, nil
+}
+
+// GetClipTags returns every tag in use, most used first
+func (a *App) GetClipTags() ([]library.TagCount, error) {
+	idx, err := a.libraryIndex()
+	if err != nil {
+		return nil, err
+	}
+	if err := idx.SyncIfStale(); err != nil {
+		return nil, err
+	}
+	return idx.Tags(), nil
+}
+
+// SetClipTags replaces the tags of a clip
+func (a *App) SetClipTags(path string, tags []string) error {
+	tags = library.NormalizeTags(tags)
+	return a.updateClipMetadata(path, func(m *capture.ClipMetadata) { m.Tags = tags })
+}
+
+// SetClipDetails sets the title and notes of a clip
+func (a *App) SetClipDetails(path string, title, notes string) error {
+	return a.updateClipMetadata(path, func(m *capture.ClipMetadata) {
+		m.Title = title
+		m.Notes = notes
+	})
+}
+
+// RescanClips scans the output directory again, picking up clips that were
+// changed outside the app without touching their folder, which queries
+// otherwise only notice within a minute
+func (a *App) RescanClips() error {
+	idx, err := a.libraryIndex()
+	if err != nil {
+		return err
+	}
+	if err := idx.Sync(); err != nil {
+		return fmt.Errorf("failed to scan clips: %w", err)
+	}
+	a.EmitClipsUpdate()
+	return nil
+}
+
+// clipsChanged invalidates the library index after the app wrote, moved or
+// deleted clips, and tells the frontend
+func (a *App) clipsChanged() {
+	if idx, err := a.libraryIndex(); err == nil {
+		idx.Invalidate()
+	}
+	a.EmitClipsUpdate()
+}
+
+// refreshLibrary updates the index entry of a clip that was changed
+func (a *App) refreshLibrary(path string) {
+	if idx, err := a.libraryIndex(); err == nil {
+		idx.Refresh(path)
+	}
+}
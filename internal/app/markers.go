@@ -0,0 +1,76 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"rewind/internal/capture"
+)
+
+// maxMarkerLabel limits marker labels, which become chapter titles
+const maxMarkerLabel = 100
+
+// AddMarker flags the current moment of the recording. Clips saved later
+// that cover it get a chapter with the label.
+func (a *App) AddMarker(label string) (capture.Marker, error) {
+	a.mu.RLock()
+	recording := a.state.Status.Capturing()
+	reach := time.Duration(a.config.RecordSeconds+a.config.PostRollSeconds) * time.Second
+	a.mu.RUnlock()
+
+	if !recording {
+		return capture.Marker{}, fmt.Errorf("not recording")
+	}
+
+	label = strings.Join(strings.Fields(label), " ")
+	if runes := []rune(label); len(runes) > maxMarkerLabel {
+		label = string(runes[:maxMarkerLabel])
+	}
+	m := capture.Marker{Time: time.Now(), Label: label}
+
+	a.markersMu.Lock()
+	// Markers older than any clip can reach back are dropped
+	cutoff := m.Time.Add(-reach)
+	i := 0
+	for i < len(a.markers) && a.markers[i].Time.Before(cutoff) {
+		i++
+	}
+	a.markers = append(a.markers[i:], m)
+	a.markersMu.Unlock()
+
+	slog.Info("marker added", "label", label)
+	a.emit("marker-added", m)
+	return m, nil
+}
+
+// GetMarkers returns the markers that are still in the buffer
+func (a *App) GetMarkers() []capture.Marker {
+	a.mu.RLock()
+	window := time.Duration(a.config.RecordSeconds) * time.Second
+	a.mu.RUnlock()
+
+	cutoff := time.Now().Add(-window)
+	markers := []capture.Marker{}
+	for _, m := range a.recordedMarkers() {
+		if !m.Time.Before(cutoff) {
+			markers = append(markers, m)
+		}
+	}
+	return markers
+}
+
+// recordedMarkers returns a copy of the markers of the current recording
+func (a *App) recordedMarkers() []capture.Marker {
+	a.markersMu.Lock()
+	defer a.markersMu.Unlock()
+	return append([]capture.Marker(nil), a.markers...)
+}
+
+// clearMarkers forgets the markers of the previous recording
+func (a *App) clearMarkers() {
+	a.markersMu.Lock()
+	a.markers = nil
+	a.markersMu.Unlock()
+}
@@ -0,0 +1,467 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"rewind/internal/api"
+	"rewind/internal/foreground"
+	"rewind/internal/obsws"
+	"rewind/internal/utils"
+)
+
+const profilesFileName = "profiles.json"
+
+// Profile is a named snapshot of the whole configuration
+type Profile struct {
+	Name      string    `json:"name"`
+	Config    Config    `json:"config"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// profileFile is the layout of profiles.json and of exported profiles
+type profileFile struct {
+	Version  int               `json:"version"`
+	Active   string            `json:"active,omitempty"`
+	Profiles []json.RawMessage `json:"profiles"`
+}
+
+func getProfilesFilePath() (string, error) {
+	configDir, err := utils.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, profilesFileName), nil
+}
+
+// withoutGlobals returns cfg with the global settings reset to their
+// defaults. Hooks run commands and the control API and obs-websocket hold
+// secrets, so like the switching rules they are never stored in or
+// exported with a profile.
+func withoutGlobals(cfg Config) Config {
+	cfg.Hooks = nil
+	cfg.AutoSwitch = foreground.DefaultSettings()
+	cfg.API = api.DefaultSettings()
+	cfg.OBS = obsws.DefaultSettings()
+	return cfg
+}
+
+// withGlobals returns cfg with the global settings of cur
+func withGlobals(cfg, cur Config) Config {
+	cfg.Hooks = cur.Hooks
+	cfg.AutoSwitch = cur.AutoSwitch
+	cfg.API = cur.API
+	cfg.OBS = cur.OBS
+	return cfg
+}
+
+// decodeProfile parses a stored profile, migrating its config
+func decodeProfile(data []byte) (Profile, error) {
+	var stored struct {
+		Name      string          `json:"name"`
+		Config    json.RawMessage `json:"config"`
+		UpdatedAt time.Time       `json:"updatedAt"`
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return Profile{}, err
+	}
+	if stored.Name == "" {
+		return Profile{}, fmt.Errorf("profile has no name")
+	}
+
+	cfg, issues, _, err := decodeConfig(stored.Config)
+	if err != nil {
+		return Profile{}, fmt.Errorf("profile %q: %w", stored.Name, err)
+	}
+	for _, issue := range issues {
+		slog.Warn("invalid profile setting reset to default", "profile", stored.Name, "field", issue.Field)
+	}
+	return Profile{Name: stored.Name, Config: cfg, UpdatedAt: stored.UpdatedAt}, nil
+}
+
+// loadProfiles reads profiles.json. Must be called before the app is shared.
+func (a *App) loadProfiles() error {
+	path, err := getProfilesFilePath()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var f profileFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+
+	var stale bool
+	for _, raw := range f.Profiles {
+		p, err := decodeProfile(raw)
+		if err != nil {
+			slog.Warn("skipping invalid profile", "error", err)
+			continue
+		}
+		// Older versions stored the global settings in every profile
+		if cfg := withoutGlobals(p.Config); !reflect.DeepEqual(cfg, p.Config) {
+			p.Config = cfg
+			stale = true
+		}
+		a.profiles = append(a.profiles, p)
+	}
+	if a.findProfile(f.Active) >= 0 {
+		a.activeProfile = f.Active
+	}
+	if stale {
+		if err := a.saveProfiles(); err != nil {
+			slog.Warn("failed to remove global settings from profiles", "error", err)
+		}
+	}
+
+	slog.Info("profiles loaded", "count", len(a.profiles), "active", a.activeProfile)
+	return nil
+}
+
+// saveProfiles writes profiles.json. Must be called with a.mu held.
+func (a *App) saveProfiles() error {
+	path, err := getProfilesFilePath()
+	if err != nil {
+		return err
+	}
+
+	f := profileFile{Version: ConfigVersion, Active: a.activeProfile}
+	for _, p := range a.profiles {
+		p.Config.Version = ConfigVersion
+		raw, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		f.Profiles = append(f.Profiles, raw)
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(path, data)
+}
+
+// findProfile returns the index of a profile, or -1. Names are matched
+// case-insensitively. Must be called with a.mu held.
+func (a *App) findProfile(name string) int {
+	for i, p := range a.profiles {
+		if strings.EqualFold(p.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// profileName is the name used for the {profile} template token. Must be
+// called with a.mu held.
+func (a *App) profileName() string {
+	if a.activeProfile == "" {
+		return "default"
+	}
+	return a.activeProfile
+}
+
+// updateActiveProfile stores cfg in the active profile. Must be called
+// with a.mu held.
+func (a *App) updateActiveProfile(cfg Config) error {
+	i := a.findProfile(a.activeProfile)
+	if i < 0 {
+		return fmt.Errorf("profile not found: %s", a.activeProfile)
+	}
+	a.profiles[i].Config = withoutGlobals(cfg)
+	a.profiles[i].UpdatedAt = time.Now()
+	return a.saveProfiles()
+}
+
+func validateProfileName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("profile name must not be empty")
+	}
+	if len(name) > 64 {
+		return fmt.Errorf("profile name is too long")
+	}
+	return nil
+}
+
+// GetProfiles returns all saved profiles. Their global settings are the
+// defaults, see withoutGlobals.
+func (a *App) GetProfiles() []Profile {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]Profile(nil), a.profiles...)
+}
+
+// GetActiveProfile returns the name of the active profile, "" if none
+func (a *App) GetActiveProfile() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.activeProfile
+}
+
+// CreateProfile saves cfg as a new profile
+func (a *App) CreateProfile(name string, cfg Config) error {
+	name = strings.TrimSpace(name)
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.findProfile(name) >= 0 {
+		return fmt.Errorf("profile already exists: %s", name)
+	}
+
+	cfg.Version = ConfigVersion
+	a.profiles = append(a.profiles, Profile{Name: name, Config: withoutGlobals(cfg), UpdatedAt: time.Now()})
+	slog.Info("profile created", "profile", name)
+	return a.saveProfiles()
+}
+
+// SaveCurrentAsProfile creates or overwrites a profile with the current
+// configuration
+func (a *App) SaveCurrentAsProfile(name string) error {
+	name = strings.TrimSpace(name)
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	p := Profile{Name: name, Config: withoutGlobals(a.config), UpdatedAt: time.Now()}
+	if i := a.findProfile(name); i >= 0 {
+		a.profiles[i] = p
+	} else {
+		a.profiles = append(a.profiles, p)
+	}
+	slog.Info("profile saved", "profile", name)
+	return a.saveProfiles()
+}
+
+// UpdateProfile replaces the settings of a profile. Updating the active
+// profile does not apply it; use SwitchProfile for that.
+func (a *App) UpdateProfile(name string, cfg Config) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i := a.findProfile(name)
+	if i < 0 {
+		return fmt.Errorf("profile not found: %s", name)
+	}
+
+	cfg.Version = ConfigVersion
+	a.profiles[i].Config = withoutGlobals(cfg)
+	a.profiles[i].UpdatedAt = time.Now()
+	return a.saveProfiles()
+}
+
+// RenameProfile changes the name of a profile
+func (a *App) RenameProfile(oldName, newName string) error {
+	newName = strings.TrimSpace(newName)
+	if err := validateProfileName(newName); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i := a.findProfile(oldName)
+	if i < 0 {
+		return fmt.Errorf("profile not found: %s", oldName)
+	}
+	if j := a.findProfile(newName); j >= 0 && j != i {
+		return fmt.Errorf("profile already exists: %s", newName)
+	}
+
+	if strings.EqualFold(a.activeProfile, a.profiles[i].Name) {
+		a.activeProfile = newName
+	}
+	a.profiles[i].Name = newName
+	a.profiles[i].UpdatedAt = time.Now()
+	return a.saveProfiles()
+}
+
+// DeleteProfile removes a profile. Deleting the active profile keeps the
+// current settings but leaves no profile active.
+func (a *App) DeleteProfile(name string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i := a.findProfile(name)
+	if i < 0 {
+		return fmt.Errorf("profile not found: %s", name)
+	}
+
+	if strings.EqualFold(a.activeProfile, a.profiles[i].Name) {
+		a.activeProfile = ""
+	}
+	a.profiles = append(a.profiles[:i], a.profiles[i+1:]...)
+	slog.Info("profile deleted", "profile", name)
+	return a.saveProfiles()
+}
+
+// SwitchProfile applies a profile. While recording, capture is restarted
+// only if the profile captures differently, which starts the replay buffer
+// over; other settings apply to the next clip. Hooks, the control API,
+// obs-websocket and the automatic switching rules are global and not taken
+// from the profile.
+func (a *App) SwitchProfile(name string) error {
+	a.mu.Lock()
+	i := a.findProfile(name)
+	if i < 0 {
+		a.mu.Unlock()
+		return fmt.Errorf("profile not found: %s", name)
+	}
+	profile := a.profiles[i]
+
+	cfg := withGlobals(profile.Config, a.config)
+
+	capturing := a.state.Status.Capturing()
+	restart := capturing && a.captureChanged(cfg)
+	if capturing && !restart {
+		cfg.OutputDir = a.config.OutputDir // the same folder, already resolved
+	}
+
+	if err := a.applyConfig(cfg); err != nil {
+		a.mu.Unlock()
+		return err
+	}
+	a.activeProfile = profile.Name
+	if err := a.saveProfiles(); err != nil {
+		slog.Warn("failed to save profiles", "error", err)
+	}
+
+	var err error
+	if restart {
+		err = a.restartCapture()
+	}
+	a.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to restart recording: %w", err)
+	}
+
+	slog.Info("profile activated", "profile", profile.Name, "restarted", restart)
+	a.emitProfileChanged()
+	return nil
+}
+
+// captureChanged reports whether cfg captures differently from the running
+// capture, so applying it takes a restart. Must be called with a.mu held.
+func (a *App) captureChanged(cfg Config) bool {
+	cur := a.config
+	outputDir, err := utils.ResolveAbsPath(cfg.OutputDir, "")
+	return err != nil || outputDir != cur.OutputDir ||
+		cfg.DisplayIndex != cur.DisplayIndex ||
+		cfg.EncoderName != cur.EncoderName ||
+		cfg.FPS != cur.FPS ||
+		cfg.Bitrate != cur.Bitrate ||
+		cfg.RecordSeconds != cur.RecordSeconds ||
+		cfg.MicrophoneDevice != cur.MicrophoneDevice ||
+		cfg.MicVolume != cur.MicVolume ||
+		cfg.SystemAudioDevice != cur.SystemAudioDevice ||
+		cfg.SysVolume != cur.SysVolume
+}
+
+func (a *App) emitProfileChanged() {
+	a.emit("profile-changed", a.GetActiveProfile())
+}
+
+// ExportProfile writes a profile to a JSON file that ImportProfile reads.
+// Profiles hold no global settings, so the file holds no secrets.
+func (a *App) ExportProfile(name, path string) error {
+	a.mu.RLock()
+	i := a.findProfile(name)
+	var p Profile
+	if i >= 0 {
+		p = a.profiles[i]
+	}
+	a.mu.RUnlock()
+
+	if i < 0 {
+		return fmt.Errorf("profile not found: %s", name)
+	}
+
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(profileFile{Version: ConfigVersion, Profiles: []json.RawMessage{raw}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write profile: %w", err)
+	}
+
+	slog.Info("profile exported", "profile", name, "path", path)
+	return nil
+}
+
+// ImportProfile adds the profiles of an exported file. Names that are
+// already taken get a numeric suffix, and global settings in the file are
+// ignored. It returns the imported names.
+func (a *App) ImportProfile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile: %w", err)
+	}
+
+	var f profileFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid profile file: %w", err)
+	}
+	if len(f.Profiles) == 0 {
+		return nil, fmt.Errorf("no profiles in file")
+	}
+
+	var imported []Profile
+	for _, raw := range f.Profiles {
+		p, err := decodeProfile(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid profile: %w", err)
+		}
+		p.Config = withoutGlobals(p.Config)
+		imported = append(imported, p)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var names []string
+	for _, p := range imported {
+		base := p.Name
+		for n := 2; a.findProfile(p.Name) >= 0; n++ {
+			p.Name = fmt.Sprintf("%s (%d)", base, n)
+		}
+		p.UpdatedAt = time.Now()
+		a.profiles = append(a.profiles, p)
+		names = append(names, p.Name)
+	}
+
+	slog.Info("profiles imported", "path", path, "profiles", names)
+	return names, a.saveProfiles()
+}
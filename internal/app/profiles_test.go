@@ -0,0 +1,307 @@
+package app
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"rewind/internal/api"
+	"rewind/internal/foreground"
+	"rewind/internal/hooks"
+	"rewind/internal/obsws"
+)
+
+// newTestApp returns an app whose settings live in a temporary folder
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir) // os.UserCacheDir on Linux
+	t.Setenv("LocalAppData", dir)   // and on Windows
+	a := New("")
+	a.config.OutputDir = t.TempDir()
+	return a
+}
+
+// withSecrets returns cfg with every global setting filled in
+func withSecrets(cfg Config) Config {
+	cfg.Hooks = []hooks.Hook{{Name: "upload", Type: hooks.TypeCommand, Enabled: true, Command: "upload.exe"}}
+	cfg.AutoSwitch = foreground.Settings{Enabled: true, DebounceSec: 5}
+	cfg.API = api.Settings{Enabled: true, Addr: api.DefaultAddr, Token: "0123456789abcdef-api"}
+	cfg.OBS = obsws.Settings{Enabled: true, Addr: obsws.DefaultAddr, Password: "obs-secret"}
+	return cfg
+}
+
+func profileNames(a *App) []string {
+	var names []string
+	for _, p := range a.GetProfiles() {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func TestProfileLifecycle(t *testing.T) {
+	a := newTestApp(t)
+	cfg := a.GetConfig()
+
+	if err := a.CreateProfile(" Gaming ", cfg); err != nil {
+		t.Fatalf("CreateProfile() error = %v", err)
+	}
+	if err := a.CreateProfile("gaming", cfg); err == nil {
+		t.Error("CreateProfile() accepted a name differing only in case")
+	}
+	if err := a.CreateProfile("  ", cfg); err == nil {
+		t.Error("CreateProfile() accepted an empty name")
+	}
+	if err := a.CreateProfile("Work", cfg); err != nil {
+		t.Fatalf("CreateProfile() error = %v", err)
+	}
+
+	if err := a.SwitchProfile("GAMING"); err != nil {
+		t.Fatalf("SwitchProfile() error = %v", err)
+	}
+	if got := a.GetActiveProfile(); got != "Gaming" {
+		t.Errorf("active profile = %q, want Gaming", got)
+	}
+
+	if err := a.RenameProfile("gaming", "work"); err == nil {
+		t.Error("RenameProfile() accepted a taken name")
+	}
+	if err := a.RenameProfile("gaming", "GAMING"); err != nil {
+		t.Errorf("RenameProfile() to a new case error = %v", err)
+	}
+	if err := a.RenameProfile("gaming", "Shooters"); err != nil {
+		t.Fatalf("RenameProfile() error = %v", err)
+	}
+	if got := a.GetActiveProfile(); got != "Shooters" {
+		t.Errorf("active profile after rename = %q, want Shooters", got)
+	}
+
+	if err := a.DeleteProfile("shooters"); err != nil {
+		t.Fatalf("DeleteProfile() error = %v", err)
+	}
+	if got := a.GetActiveProfile(); got != "" {
+		t.Errorf("active profile after delete = %q, want none", got)
+	}
+	if err := a.DeleteProfile("shooters"); err == nil {
+		t.Error("DeleteProfile() of a missing profile succeeded")
+	}
+	if got := profileNames(a); !reflect.DeepEqual(got, []string{"Work"}) {
+		t.Errorf("profiles = %v, want [Work]", got)
+	}
+
+	// The profiles survive a restart
+	b := New("")
+	if got := profileNames(b); !reflect.DeepEqual(got, []string{"Work"}) {
+		t.Errorf("reloaded profiles = %v, want [Work]", got)
+	}
+}
+
+func TestImportProfile(t *testing.T) {
+	a := newTestApp(t)
+	if err := a.CreateProfile("gaming", a.GetConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	var raws []json.RawMessage
+	for _, name := range []string{"Gaming", "GAMING", "Work"} {
+		raw, err := json.Marshal(Profile{Name: name, Config: withSecrets(DefaultConfig())})
+		if err != nil {
+			t.Fatal(err)
+		}
+		raws = append(raws, raw)
+	}
+	data, err := json.Marshal(profileFile{Version: ConfigVersion, Profiles: raws})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := a.ImportProfile(path)
+	if err != nil {
+		t.Fatalf("ImportProfile() error = %v", err)
+	}
+	if want := []string{"Gaming (2)", "GAMING (3)", "Work"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("imported names = %v, want %v", names, want)
+	}
+
+	for _, p := range a.GetProfiles()[1:] {
+		if len(p.Config.Hooks) != 0 || p.Config.API.Token != "" || p.Config.OBS.Password != "" || p.Config.AutoSwitch.Enabled {
+			t.Errorf("profile %q kept global settings from the file", p.Name)
+		}
+	}
+}
+
+func TestExportProfileLeavesOutGlobals(t *testing.T) {
+	a := newTestApp(t)
+	if err := a.CreateProfile("Gaming", withSecrets(a.GetConfig())); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "gaming.json")
+	if err := a.ExportProfile("gaming", path); err != nil {
+		t.Fatalf("ExportProfile() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var f profileFile
+	if err := json.Unmarshal(data, &f); err != nil || len(f.Profiles) != 1 {
+		t.Fatalf("exported file = %s", data)
+	}
+	p, err := decodeProfile(f.Profiles[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := withoutGlobals(p.Config); !reflect.DeepEqual(p.Config, want) {
+		t.Errorf("exported config has global settings: %+v", p.Config)
+	}
+}
+
+func TestProfilesLeaveOutGlobals(t *testing.T) {
+	a := newTestApp(t)
+	secret := withSecrets(a.GetConfig())
+	secret.AutoSwitch.Enabled = false // no foreground watcher in tests
+	a.config = secret
+
+	if err := a.CreateProfile("Created", secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SaveCurrentAsProfile("Current"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.CreateProfile("Updated", DefaultConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.UpdateProfile("Updated", secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.CreateProfile("Active", DefaultConfig()); err != nil {
+		t.Fatal(err)
+	}
+	a.mu.Lock()
+	a.activeProfile = "Active"
+	err := a.updateActiveProfile(secret)
+	a.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkStored := func(a *App) {
+		t.Helper()
+		for _, p := range a.GetProfiles() {
+			if want := withoutGlobals(p.Config); !reflect.DeepEqual(p.Config, want) {
+				t.Errorf("profile %q holds global settings: %+v", p.Name, p.Config)
+			}
+		}
+		path, err := getProfilesFilePath()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []string{secret.API.Token, secret.OBS.Password, "upload.exe"} {
+			if strings.Contains(string(data), s) {
+				t.Errorf("profiles.json contains %q", s)
+			}
+		}
+	}
+	checkStored(a)
+	if got := len(a.GetProfiles()); got != 4 {
+		t.Errorf("%d profiles, want 4", got)
+	}
+
+	// Files written by older versions are cleaned up when loaded
+	raw, err := json.Marshal(Profile{Name: "Old", Config: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(profileFile{Version: ConfigVersion, Profiles: []json.RawMessage{raw}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := getProfilesFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkStored(New(""))
+}
+
+func TestSwitchProfileKeepsGlobals(t *testing.T) {
+	a := newTestApp(t)
+	cur := withSecrets(a.GetConfig())
+	cur.AutoSwitch.Enabled = false // no foreground watcher in tests
+	a.config = cur
+
+	other := DefaultConfig()
+	other.OutputDir = cur.OutputDir
+	other.FPS = 60
+	a.profiles = []Profile{{Name: "Other", Config: other}}
+
+	if err := a.SwitchProfile("Other"); err != nil {
+		t.Fatalf("SwitchProfile() error = %v", err)
+	}
+	got := a.GetConfig()
+	if got.FPS != 60 {
+		t.Errorf("FPS = %d, want the profile's 60", got.FPS)
+	}
+	if !reflect.DeepEqual(withGlobals(Config{}, got), withGlobals(Config{}, cur)) {
+		t.Errorf("global settings changed by the switch: %+v", got)
+	}
+}
+
+func TestCaptureChanged(t *testing.T) {
+	cur := DefaultConfig()
+	cur.OutputDir = t.TempDir()
+	with := func(f func(*Config)) Config {
+		c := cur
+		f(&c)
+		return c
+	}
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want bool
+	}{
+		{name: "same", cfg: cur},
+		{name: "clip settings only", cfg: with(func(c *Config) {
+			c.FilenameTemplate = "{app}_{date}"
+			c.ConvertToMP4 = !c.ConvertToMP4
+			c.PostRollSeconds = 10
+			c.Audio.BitrateKbps = 320
+		})},
+		{name: "globals only", cfg: withSecrets(cur)},
+		{name: "output dir", cfg: with(func(c *Config) { c.OutputDir = t.TempDir() }), want: true},
+		{name: "display", cfg: with(func(c *Config) { c.DisplayIndex = 1 }), want: true},
+		{name: "encoder", cfg: with(func(c *Config) { c.EncoderName = "h264_nvenc" }), want: true},
+		{name: "fps", cfg: with(func(c *Config) { c.FPS = 60 }), want: true},
+		{name: "bitrate", cfg: with(func(c *Config) { c.Bitrate = "50M" }), want: true},
+		{name: "buffer length", cfg: with(func(c *Config) { c.RecordSeconds = 120 }), want: true},
+		{name: "microphone", cfg: with(func(c *Config) { c.MicrophoneDevice = "Mic" }), want: true},
+		{name: "mic volume", cfg: with(func(c *Config) { c.MicVolume = 50 }), want: true},
+		{name: "system audio", cfg: with(func(c *Config) { c.SystemAudioDevice = "Speakers" }), want: true},
+		{name: "system volume", cfg: with(func(c *Config) { c.SysVolume = 150 }), want: true},
+	}
+
+	a := &App{config: cur}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.captureChanged(tt.cfg); got != tt.want {
+				t.Errorf("captureChanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"rewind/internal/audio"
+	"rewind/internal/capture"
+	"rewind/internal/library"
+	"rewind/internal/utils"
+)
+
+// diskSpaceMargin is kept free on top of the estimated clip size
+const diskSpaceMargin = 256 * 1024 * 1024
+
+// applyRetention purges expired clips from the trash and deletes the clips
+// the retention policy selects. keep is never deleted, so a clip that was
+// just saved survives even if it alone exceeds a limit.
+func (a *App) applyRetention(keep string) {
+	a.retentionMu.Lock()
+	defer a.retentionMu.Unlock()
+
+	policy := a.GetConfig().Retention
+	a.expireTrash(policy.TrashDays)
+	if !policy.Enabled() {
+		return
+	}
+
+	clips, err := a.GetClips()
+	if err != nil {
+		slog.Warn("retention skipped, failed to list clips", "error", err)
+		return
+	}
+
+	entries := make([]library.Entry, 0, len(clips))
+	for _, c := range clips {
+		exempt := c.Path == keep
+		if c.Metadata != nil && (c.Metadata.Favorite || c.Metadata.Locked) {
+			exempt = true
+		}
+		entries = append(entries, library.Entry{Path: c.Path, Size: c.Size, ModTime: c.ModTime, Exempt: exempt})
+	}
+
+	remove := policy.Plan(entries, time.Now())
+	if len(remove) == 0 {
+		return
+	}
+
+	result := library.Result{}
+	for _, e := range remove {
+		if err := library.RemoveClip(e.Path); err != nil {
+			slog.Warn("retention failed to delete clip", "path", e.Path, "error", err)
+			result.Failed = append(result.Failed, e.Path)
+			continue
+		}
+		a.previews.Forget(e.Path)
+		result.Deleted = append(result.Deleted, e.Path)
+		result.FreedBytes += e.Size
+	}
+
+	slog.Info("retention policy applied",
+		"deleted", len(result.Deleted),
+		"freedMB", result.FreedBytes/(1024*1024),
+		"failed", len(result.Failed),
+	)
+
+	a.emit("retention-applied", result)
+	a.clipsChanged()
+}
+
+// expireTrash permanently deletes the clips that have been in the trash
+// for more than days, if days is set
+func (a *App) expireTrash(days int) {
+	if days <= 0 {
+		return
+	}
+	root, err := a.outputRoot()
+	if err != nil {
+		return
+	}
+
+	expired, err := library.NewTrash(root).Expire(time.Duration(days)*24*time.Hour, time.Now())
+	if err != nil {
+		slog.Warn("failed to purge expired clips from the trash", "error", err)
+	}
+	if len(expired) > 0 {
+		slog.Info("expired clips purged from the trash", "count", len(expired), "days", days)
+		a.EmitClipsUpdate()
+	}
+}
+
+// SetClipFavorite marks a clip as favorite, which exempts it from retention
+func (a *App) SetClipFavorite(path string, favorite bool) error {
+	return a.updateClipMetadata(path, func(m *capture.ClipMetadata) { m.Favorite = favorite })
+}
+
+// SetClipLocked locks a clip, which exempts it from retention
+func (a *App) SetClipLocked(path string, locked bool) error {
+	return a.updateClipMetadata(path, func(m *capture.ClipMetadata) { m.Locked = locked })
+}
+
+func (a *App) updateClipMetadata(path string, update func(*capture.ClipMetadata)) error {
+	absPath, err := utils.ResolveAndValidatePath(path, a.GetConfig().OutputDir)
+	if err != nil {
+		return fmt.Errorf("clip not found: %w", err)
+	}
+
+	if err := capture.UpdateMetadata(absPath, update); err != nil {
+		return fmt.Errorf("failed to update clip: %w", err)
+	}
+
+	a.refreshLibrary(absPath)
+	a.EmitClipsUpdate()
+	return nil
+}
+
+// checkDiskSpace refuses a save that would not fit on the output volume.
+// Must be called with a.mu held.
+func (a *App) checkDiskSpace() error {
+	free, err := utils.FreeDiskSpace(a.config.OutputDir)
+	if err != nil {
+		slog.Warn("failed to check free disk space", "error", err)
+		return nil
+	}
+
+	var tracks []uint64
+	for _, t := range a.audioTracks() {
+		if b, ok := t.Source.(interface{ Len() int }); ok {
+			tracks = append(tracks, uint64(b.Len()))
+		}
+	}
+
+	need := saveSize(a.config, uint64(a.ringBuffer.Len()), tracks) + diskSpaceMargin
+	if free < need {
+		err := fmt.Errorf("not enough disk space: clip needs ~%dMB, %dMB free", need/(1024*1024), free/(1024*1024))
+		// The trash holds space retention does not touch, point at it
+		if trash, _ := library.NewTrash(a.config.OutputDir).Size(); trash >= 1024*1024 {
+			err = fmt.Errorf("%w, emptying the trash frees %dMB", err, trash/(1024*1024))
+		}
+		return err
+	}
+	return nil
+}
+
+// saveSize estimates the disk space a save needs from the buffered video
+// and the buffered PCM of each audio track
+func saveSize(cfg Config, video uint64, tracks []uint64) uint64 {
+	var pcm uint64
+	for _, t := range tracks {
+		pcm += t
+	}
+
+	// Post-roll keeps recording into the clip after the buffers are taken
+	if post := cfg.PostRollSeconds; post > 0 {
+		video += uint64(capture.CalculateBufferSize(cfg.Bitrate, post))
+		pcm += uint64(len(tracks) * audio.CalculateTrackBufferSize(post))
+	}
+
+	// MP4 conversion keeps the TS and PCM files until the MP4 is written,
+	// which holds the video again and every track encoded, plus the mix
+	need := video + pcm
+	if cfg.ConvertToMP4 {
+		need += video
+		encoded := len(tracks)
+		if cfg.Audio.Mix && encoded > 1 {
+			encoded++
+		}
+		seconds := cfg.RecordSeconds + cfg.PostRollSeconds
+		need += uint64(encoded * cfg.Audio.BitrateKbps * 1000 / 8 * seconds)
+	}
+	return need
+}
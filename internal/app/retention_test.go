@@ -0,0 +1,64 @@
+package app
+
+import (
+	"testing"
+
+	"rewind/internal/capture"
+)
+
+func TestSaveSize(t *testing.T) {
+	const (
+		mb    = 1000 * 1000
+		video = 100 * mb
+		track = 20 * mb
+	)
+	base := Config{Bitrate: "8M", RecordSeconds: 30, Audio: capture.AudioSettings{BitrateKbps: 192, Mix: true}}
+	with := func(f func(*Config)) Config {
+		c := base
+		f(&c)
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		cfg    Config
+		tracks []uint64
+		want   uint64
+	}{
+		{name: "raw video", cfg: base, want: video},
+		{name: "raw with tracks", cfg: base, tracks: []uint64{track, track}, want: video + 2*track},
+		{
+			name:   "post-roll adds video and pcm per track",
+			cfg:    with(func(c *Config) { c.PostRollSeconds = 10 }),
+			tracks: []uint64{track, track},
+			// 8 Mbit/s is 1 MB/s with 1.5x headroom; PCM is 48 kHz stereo float
+			want: video + 15*mb + 2*track + 2*48000*8*10,
+		},
+		{
+			name:   "mp4 holds the video twice and every encoded track",
+			cfg:    with(func(c *Config) { c.ConvertToMP4 = true }),
+			tracks: []uint64{track},
+			want:   2*video + track + 192*1000/8*30,
+		},
+		{
+			name:   "mp4 adds the mix for several tracks",
+			cfg:    with(func(c *Config) { c.ConvertToMP4 = true }),
+			tracks: []uint64{track, track},
+			want:   2*video + 2*track + 3*192*1000/8*30,
+		},
+		{
+			name:   "mp4 without mix",
+			cfg:    with(func(c *Config) { c.ConvertToMP4, c.Audio.Mix = true, false }),
+			tracks: []uint64{track, track},
+			want:   2*video + 2*track + 2*192*1000/8*30,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := saveSize(tt.cfg, video, tt.tracks); got != tt.want {
+				t.Errorf("saveSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"rewind/internal/capture"
+)
+
+// Reason says why the state changed
+type Reason string
+
+const (
+	ReasonStart          Reason = "start"
+	ReasonStop           Reason = "stop"
+	ReasonStartFailed    Reason = "start-failed"
+	ReasonCaptureFailed  Reason = "capture-failed"
+	ReasonSaveStarted    Reason = "save-started"
+	ReasonExtendFinished Reason = "extend-finished"
+	ReasonSaveFinished   Reason = "save-finished"
+)
+
+// transitions lists where each status may move to. Staying in a status is
+// always allowed and publishes the updated details.
+var transitions = map[Status][]Status{
+	StatusIdle:      {StatusRecording, StatusError},
+	StatusRecording: {StatusSaving, StatusIdle, StatusError},
+	StatusSaving:    {StatusRecording, StatusIdle, StatusError},
+	StatusError:     {StatusRecording, StatusIdle},
+}
+
+// Capturing reports whether the buffer is being filled, which it is while
+// recording and while saving
+func (s Status) Capturing() bool {
+	return s == StatusRecording || s == StatusSaving
+}
+
+// CanTransition reports whether the state machine allows moving from one
+// status to another
+func CanTransition(from, to Status) bool {
+	return from == to || slices.Contains(transitions[from], to)
+}
+
+// transition moves to status and publishes the change. The error message is
+// only kept in the error status. A move the state machine does not allow
+// leaves the state as it is and is returned as an error. Must be called
+// with a.mu held.
+func (a *App) transition(to Status, reason Reason, errorMsg string) error {
+	from := a.state.Status
+	if !CanTransition(from, to) {
+		slog.Error("invalid state transition", "from", from, "to", to, "reason", reason)
+		return fmt.Errorf("cannot change from %s to %s", from, to)
+	}
+
+	a.state.Status = to
+	a.state.ErrorMessage = ""
+	if to == StatusError {
+		a.state.ErrorMessage = errorMsg
+	}
+	a.state.PendingSaves = a.savesInFlight
+
+	if from != to {
+		slog.Info("state changed", "from", from, "to", to, "reason", reason)
+	}
+	a.publish(StateChanged{State: a.state, From: from, Reason: reason})
+	return nil
+}
+
+// saveStarted counts a clip that is being captured or written; a recording
+// moves to saving. Must be called with a.mu held.
+func (a *App) saveStarted() {
+	a.savesInFlight++
+	if a.state.Status.Capturing() {
+		a.transition(StatusSaving, ReasonSaveStarted, "")
+		return
+	}
+	a.transition(a.state.Status, ReasonSaveStarted, a.state.ErrorMessage)
+}
+
+// saveFinished counts a clip as written or failed; saving returns to
+// recording once no clip is left. Must be called with a.mu held.
+func (a *App) saveFinished() {
+	if a.savesInFlight > 0 {
+		a.savesInFlight--
+	}
+
+	to := a.state.Status
+	if to == StatusSaving && a.savesInFlight == 0 {
+		to = StatusRecording
+	}
+	a.transition(to, ReasonSaveFinished, a.state.ErrorMessage)
+}
+
+// onCaptureError ends a recording whose capture broke and enters the error
+// status. Starting again recovers.
+func (a *App) onCaptureError(c *capture.Capturer, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Stopping the capturer on purpose can fail its reads too
+	if a.capturer != c {
+		return
+	}
+
+	slog.Error("capture failed", "error", err)
+	a.stopCapture()
+	a.transition(StatusError, ReasonCaptureFailed, err.Error())
+}
@@ -0,0 +1,183 @@
+package app
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"rewind/internal/events"
+)
+
+func TestCanTransition(t *testing.T) {
+	allowed := map[[2]Status]bool{
+		{StatusIdle, StatusRecording}:   true,
+		{StatusIdle, StatusError}:       true,
+		{StatusRecording, StatusSaving}: true,
+		{StatusRecording, StatusIdle}:   true,
+		{StatusRecording, StatusError}:  true,
+		{StatusSaving, StatusRecording}: true,
+		{StatusSaving, StatusIdle}:      true,
+		{StatusSaving, StatusError}:     true,
+		{StatusError, StatusRecording}:  true,
+		{StatusError, StatusIdle}:       true,
+	}
+
+	all := []Status{StatusIdle, StatusRecording, StatusSaving, StatusError}
+	for _, from := range all {
+		for _, to := range all {
+			want := from == to || allowed[[2]Status{from, to}]
+			if got := CanTransition(from, to); got != want {
+				t.Errorf("CanTransition(%s, %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+// watchStates returns the state changes published from now on
+func watchStates(t *testing.T, a *App) <-chan StateChanged {
+	ch := make(chan StateChanged, 256)
+	t.Cleanup(events.On(a.Events(), func(ev StateChanged) { ch <- ev }))
+	return ch
+}
+
+func nextState(t *testing.T, ch <-chan StateChanged) StateChanged {
+	t.Helper()
+	select {
+	case ev := <-ch:
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no state change published")
+		return StateChanged{}
+	}
+}
+
+func TestSaveStatus(t *testing.T) {
+	a := newTestApp(t)
+	a.state.Status = StatusRecording
+	states := watchStates(t, a)
+
+	step := func(f func()) StateChanged {
+		t.Helper()
+		a.mu.Lock()
+		f()
+		a.mu.Unlock()
+		return nextState(t, states)
+	}
+
+	tests := []struct {
+		name        string
+		f           func()
+		wantStatus  Status
+		wantFrom    Status
+		wantReason  Reason
+		wantPending int
+	}{
+		{"first save", a.saveStarted, StatusSaving, StatusRecording, ReasonSaveStarted, 1},
+		{"second save", a.saveStarted, StatusSaving, StatusSaving, ReasonSaveStarted, 2},
+		{"one finished", a.saveFinished, StatusSaving, StatusSaving, ReasonSaveFinished, 1},
+		{"all finished", a.saveFinished, StatusRecording, StatusSaving, ReasonSaveFinished, 0},
+		{"extra finish", a.saveFinished, StatusRecording, StatusRecording, ReasonSaveFinished, 0},
+	}
+
+	for _, tt := range tests {
+		ev := step(tt.f)
+		if ev.Status != tt.wantStatus || ev.From != tt.wantFrom || ev.Reason != tt.wantReason || ev.PendingSaves != tt.wantPending {
+			t.Errorf("%s: got %s -> %s (%s, %d pending), want %s -> %s (%s, %d pending)", tt.name,
+				ev.From, ev.Status, ev.Reason, ev.PendingSaves,
+				tt.wantFrom, tt.wantStatus, tt.wantReason, tt.wantPending)
+		}
+	}
+}
+
+func TestConcurrentSaves(t *testing.T) {
+	a := newTestApp(t)
+	a.state.Status = StatusRecording
+	states := watchStates(t, a)
+
+	const n = 20
+	var wg sync.WaitGroup
+	for range n {
+		wg.Go(func() {
+			a.mu.Lock()
+			a.saveStarted()
+			a.mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			a.mu.Lock()
+			a.saveFinished()
+			a.mu.Unlock()
+		})
+	}
+	wg.Wait()
+
+	// Whatever the interleaving, recording only resumes when no save is
+	// left, and every change is published
+	for range 2 * n {
+		ev := nextState(t, states)
+		if (ev.Status == StatusRecording) != (ev.PendingSaves == 0) {
+			t.Errorf("status %s with %d pending saves", ev.Status, ev.PendingSaves)
+		}
+	}
+	if got := a.GetState(); got.Status != StatusRecording || got.PendingSaves != 0 {
+		t.Errorf("final state = %s with %d pending, want recording with none", got.Status, got.PendingSaves)
+	}
+}
+
+func TestCaptureErrorDuringSave(t *testing.T) {
+	a := newTestApp(t)
+	a.state.Status = StatusRecording
+	states := watchStates(t, a)
+
+	a.mu.Lock()
+	a.saveStarted()
+	a.mu.Unlock()
+	nextState(t, states)
+
+	a.onCaptureError(nil, errors.New("ffmpeg exited"))
+	if ev := nextState(t, states); ev.Status != StatusError || ev.From != StatusSaving || ev.Reason != ReasonCaptureFailed || ev.ErrorMessage != "ffmpeg exited" {
+		t.Errorf("after capture error: %+v", ev)
+	}
+
+	// The clip that was being written still finishes, without leaving the
+	// error status
+	a.mu.Lock()
+	a.saveFinished()
+	a.mu.Unlock()
+	if ev := nextState(t, states); ev.Status != StatusError || ev.PendingSaves != 0 || ev.ErrorMessage != "ffmpeg exited" {
+		t.Errorf("after save finished: %+v", ev)
+	}
+
+	// Stopping recovers
+	if err := a.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if ev := nextState(t, states); ev.Status != StatusIdle || ev.From != StatusError || ev.ErrorMessage != "" {
+		t.Errorf("after stop: %+v", ev)
+	}
+	if err := a.Stop(); err == nil {
+		t.Error("Stop() while idle succeeded")
+	}
+}
+
+func TestInvalidTransition(t *testing.T) {
+	a := newTestApp(t)
+	states := watchStates(t, a)
+
+	a.mu.Lock()
+	err := a.transition(StatusSaving, ReasonSaveStarted, "")
+	a.mu.Unlock()
+
+	if err == nil {
+		t.Error("transition() from idle to saving succeeded")
+	}
+	if got := a.GetState().Status; got != StatusIdle {
+		t.Errorf("status = %s, want idle", got)
+	}
+	select {
+	case ev := <-states:
+		t.Errorf("published %+v for a refused transition", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -21,22 +21,35 @@ const (
 	BytesPerFrame  = BytesPerSample * Channels
 )
 
+// Track labels, also used as MP4 track titles
+const (
+	TrackMic    = "Mic"
+	TrackSystem = "System"
+)
+
 type CaptureManager struct {
-	ctx         *malgo.AllocatedContext
-	streams     []*Stream
-	mixedBuffer *buffer.Buffer
-	running     bool
-	mu          sync.Mutex
-	quitChan    chan struct{}
+	ctx      *malgo.AllocatedContext
+	streams  []*Stream
+	running  bool
+	mu       sync.Mutex
+	quitChan chan struct{}
 }
 
 type Stream struct {
+	label   string
 	device  *malgo.Device
-	buffer  *buffer.Buffer
+	buffer  *buffer.Buffer // raw device data waiting to be processed
+	track   *buffer.Buffer // last N seconds with gain applied
 	volume  float32
 	isReady bool
 }
 
+// Track is the processed audio of one capture device
+type Track struct {
+	Label  string
+	Buffer *buffer.Buffer
+}
+
 func NewCaptureManager() (*CaptureManager, error) {
 	ctx, err := malgo.InitContext(nil, malgo.ContextConfig{}, nil)
 	if err != nil {
@@ -44,9 +57,8 @@ func NewCaptureManager() (*CaptureManager, error) {
 	}
 
 	return &CaptureManager{
-		ctx:         ctx,
-		mixedBuffer: buffer.New(0),
-		quitChan:    make(chan struct{}),
+		ctx:      ctx,
+		quitChan: make(chan struct{}),
 	}, nil
 }
 
@@ -70,10 +82,6 @@ func (cm *CaptureManager) StartCapture(micID, sysID string, micVol, sysVol int,
 
 	cm.streams = nil
 
-	// Create buffer based on duration
-	bufferSize := SampleRate * BytesPerFrame * durationSec
-	cm.mixedBuffer = buffer.New(bufferSize)
-
 	// Calculate gains based on 0-200 range (100 = 1.0)
 	micGain := float32(micVol) / 100.0
 	sysGain := float32(sysVol) / 100.0
@@ -91,6 +99,7 @@ func (cm *CaptureManager) StartCapture(micID, sysID string, micVol, sysVol int,
 	}
 
 	type deviceEntry struct {
+		label  string
 		id     string
 		loop   bool
 		volume float32
@@ -98,10 +107,10 @@ func (cm *CaptureManager) StartCapture(micID, sysID string, micVol, sysVol int,
 
 	var deviceIDs []deviceEntry
 	if micID != "" {
-		deviceIDs = append(deviceIDs, deviceEntry{micID, false, micGain})
+		deviceIDs = append(deviceIDs, deviceEntry{TrackMic, micID, false, micGain})
 	}
 	if sysID != "" {
-		deviceIDs = append(deviceIDs, deviceEntry{sysID, true, sysGain})
+		deviceIDs = append(deviceIDs, deviceEntry{TrackSystem, sysID, true, sysGain})
 	}
 
 	if len(deviceIDs) == 0 {
@@ -116,7 +125,9 @@ func (cm *CaptureManager) StartCapture(micID, sysID string, micVol, sysVol int,
 		}
 
 		stream := &Stream{
-			buffer: buffer.New(SampleRate * BytesPerFrame * 2),
+			label:  dev.label,
+			buffer: buffer.New(CalculateStreamBufferSize(2)),
+			track:  buffer.New(CalculateTrackBufferSize(durationSec)),
 			volume: dev.volume,
 		}
 
@@ -153,7 +164,7 @@ func (cm *CaptureManager) StartCapture(micID, sysID string, micVol, sysVol int,
 		stream.device = device
 		stream.isReady = true
 		cm.streams = append(cm.streams, stream)
-		slog.Info("audio stream started", "loopback", dev.loop, "volume", dev.volume)
+		slog.Info("audio stream started", "track", dev.label, "loopback", dev.loop, "volume", dev.volume)
 	}
 
 	if len(cm.streams) == 0 {
@@ -162,7 +173,7 @@ func (cm *CaptureManager) StartCapture(micID, sysID string, micVol, sysVol int,
 
 	cm.running = true
 	cm.quitChan = make(chan struct{})
-	go cm.mixLoop()
+	go cm.processLoop()
 
 	return nil
 }
@@ -184,8 +195,16 @@ func (cm *CaptureManager) Stop() {
 	cm.streams = nil
 }
 
-func (cm *CaptureManager) GetBuffer() *buffer.Buffer {
-	return cm.mixedBuffer
+// Tracks returns the per-device track buffers in a stable order (mic first)
+func (cm *CaptureManager) Tracks() []Track {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	tracks := make([]Track, 0, len(cm.streams))
+	for _, s := range cm.streams {
+		tracks = append(tracks, Track{Label: s.label, Buffer: s.track})
+	}
+	return tracks
 }
 
 func (cm *CaptureManager) IsRunning() bool {
@@ -194,11 +213,13 @@ func (cm *CaptureManager) IsRunning() bool {
 	return cm.running
 }
 
-func (cm *CaptureManager) mixLoop() {
+// processLoop moves device data into the track buffers every 20ms. Each
+// track gets the same amount of data per tick, padded with silence, so the
+// tracks stay aligned with each other.
+func (cm *CaptureManager) processLoop() {
 	const framesPerChunk = 960
 	chunkSize := framesPerChunk * BytesPerFrame
 
-	mixBuf := make([]float32, framesPerChunk*Channels)
 	byteBuf := make([]byte, chunkSize)
 	streamBuf := make([]byte, chunkSize)
 
@@ -210,41 +231,30 @@ func (cm *CaptureManager) mixLoop() {
 		case <-cm.quitChan:
 			return
 		case <-ticker.C:
-			for i := range mixBuf {
-				mixBuf[i] = 0
-			}
-
-			// Mix all streams with volume
 			for _, s := range cm.streams {
 				n, _ := s.buffer.Read(streamBuf)
-				if n == 0 {
-					continue
-				}
 
 				numSamples := n / BytesPerSample
-				for i := 0; i < numSamples && i < len(mixBuf); i++ {
+				for i := 0; i < numSamples; i++ {
 					bits := binary.LittleEndian.Uint32(streamBuf[i*4 : (i+1)*4])
-					sample := math.Float32frombits(bits)
 					// Apply Volume/Gain
-					mixBuf[i] += sample * s.volume
-				}
-			}
+					sample := math.Float32frombits(bits) * s.volume
+
+					// Hard Clip Limiter
+					if sample > 1.0 {
+						sample = 1.0
+					} else if sample < -1.0 {
+						sample = -1.0
+					}
 
-			// Hard Clip Limiter
-			for i := range mixBuf {
-				if mixBuf[i] > 1.0 {
-					mixBuf[i] = 1.0
-				} else if mixBuf[i] < -1.0 {
-					mixBuf[i] = -1.0
+					binary.LittleEndian.PutUint32(byteBuf[i*4:(i+1)*4], math.Float32bits(sample))
 				}
-			}
 
-			for i, sample := range mixBuf {
-				bits := math.Float32bits(sample)
-				binary.LittleEndian.PutUint32(byteBuf[i*4:(i+1)*4], bits)
-			}
+				// Silence for missing data
+				clear(byteBuf[numSamples*BytesPerSample:])
 
-			cm.mixedBuffer.Write(byteBuf)
+				s.track.Write(byteBuf)
+			}
 		}
 	}
 }
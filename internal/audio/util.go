@@ -1,13 +1,13 @@
 package audio
 
-// CalculateMixedBufferSize returns the size of the final mixed audio buffer which
-// stores the last 'seconds' of audio for both mic and system combined.
-func CalculateMixedBufferSize(seconds int) int {
+// CalculateTrackBufferSize returns the size of a track buffer which stores
+// the last 'seconds' of audio of a single device (mic or system).
+func CalculateTrackBufferSize(seconds int) int {
 	return SampleRate * BytesPerFrame * seconds
 }
 
 // CalculateStreamBufferSize returns the size of the temporary buffer used by
-// an individual audio stream (mic or system) before mixing.
+// an individual audio stream (mic or system) before processing.
 func CalculateStreamBufferSize(seconds int) int {
 	return SampleRate * BytesPerFrame * seconds
 }
@@ -1,6 +1,10 @@
 package buffer
 
-import "sync"
+import (
+	"io"
+	"slices"
+	"sync"
+)
 
 // TODO: MUTEX BURDA GEREKSİZ OVERHEAD VEYA KİLİTLEME YARATIYOR MU İYİ DÜŞÜN.
 
@@ -10,9 +14,16 @@ type Buffer struct {
 	head int // Absolute position
 	tail int // Absolute position
 	size int
+	taps []*tap
 	mu   sync.Mutex
 }
 
+// tap is a writer added by SnapshotAndTap. Taps are told apart by pointer,
+// so any writer can be tapped, comparable or not.
+type tap struct {
+	w io.Writer
+}
+
 func New(size int) *Buffer {
 	return &Buffer{
 		buf:  make([]byte, size),
@@ -26,6 +37,12 @@ func (b *Buffer) Write(p []byte) (int, error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	// A tap that fails is removed, so it never gets data with a gap
+	b.taps = slices.DeleteFunc(b.taps, func(t *tap) bool {
+		_, err := t.w.Write(p)
+		return err != nil
+	})
+
 	n := len(p)
 	if n > b.size {
 		// If writing more than size, just write the last 'size' bytes
@@ -86,6 +103,37 @@ func (b *Buffer) Snapshot() []byte {
 	return result
 }
 
+// SnapshotAndTap returns a copy of the valid data in the buffer and
+// forwards every subsequent Write to w until the returned untap func is
+// called or w returns an error. Both happen under the same lock, so the
+// snapshot and the tapped data join without gaps or duplicates. w is called
+// with the buffer locked and must not block.
+func (b *Buffer) SnapshotAndTap(w io.Writer) ([]byte, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var result []byte
+	dataLen := b.head - b.tail
+	if dataLen > 0 {
+		result = make([]byte, dataLen)
+		for i := 0; i < dataLen; i++ {
+			result[i] = b.buf[(b.tail+i)%b.size]
+		}
+	}
+
+	t := &tap{w: w}
+	b.taps = append(b.taps, t)
+
+	untap := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if i := slices.Index(b.taps, t); i >= 0 {
+			b.taps = slices.Delete(b.taps, i, i+1)
+		}
+	}
+	return result, untap
+}
+
 func (b *Buffer) Clear() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -0,0 +1,141 @@
+package buffer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestSnapshotAndTap(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   []string // written before the tap
+		after    []string // written while tapped
+		wantSnap string
+	}{
+		{name: "empty", after: []string{"ab"}, wantSnap: ""},
+		{name: "partly filled", before: []string{"abc"}, after: []string{"de", "f"}, wantSnap: "abc"},
+		{name: "wrapped", before: []string{"abcde", "fghij", "k"}, after: []string{"lm"}, wantSnap: "defghijk"},
+		{name: "tapped write larger than the buffer", before: []string{"abc"}, after: []string{"0123456789"}, wantSnap: "abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New(8)
+			for _, s := range tt.before {
+				b.Write([]byte(s))
+			}
+
+			var tail bytes.Buffer
+			snap, untap := b.SnapshotAndTap(&tail)
+			defer untap()
+			for _, s := range tt.after {
+				b.Write([]byte(s))
+			}
+
+			if string(snap) != tt.wantSnap {
+				t.Errorf("snapshot = %q, want %q", snap, tt.wantSnap)
+			}
+			var want bytes.Buffer
+			for _, s := range tt.after {
+				want.WriteString(s)
+			}
+			if tail.String() != want.String() {
+				t.Errorf("tapped = %q, want %q", tail.String(), want.String())
+			}
+		})
+	}
+}
+
+// TestSnapshotAndTapConcurrent taps a buffer that a writer fills with a
+// counter and checks that snapshot and tap continue each other exactly
+func TestSnapshotAndTapConcurrent(t *testing.T) {
+	const writes = 20000
+	b := New(4 * 64) // wraps many times, always at a counter boundary
+
+	var tail bytes.Buffer
+	var snap []byte
+	var untap func()
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		for i := range uint32(writes) {
+			b.Write(binary.BigEndian.AppendUint32(nil, i))
+		}
+	})
+	wg.Go(func() {
+		for b.Len() < b.Size() {
+		}
+		snap, untap = b.SnapshotAndTap(&tail)
+	})
+	wg.Wait()
+	untap()
+
+	data := append(snap, tail.Bytes()...)
+	if len(data) == 0 || len(data)%4 != 0 {
+		t.Fatalf("joined %d bytes, want whole counters", len(data))
+	}
+	first := binary.BigEndian.Uint32(data)
+	for i := 0; i < len(data); i += 4 {
+		if got, want := binary.BigEndian.Uint32(data[i:]), first+uint32(i/4); got != want {
+			t.Fatalf("counter %d at byte %d, want %d (snapshot was %d bytes)", got, i, want, len(snap))
+		}
+	}
+	if last := binary.BigEndian.Uint32(data[len(data)-4:]); last != writes-1 {
+		t.Errorf("last counter = %d, want %d", last, writes-1)
+	}
+}
+
+type failingWriter struct{ calls int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.calls++
+	return 0, errors.New("full")
+}
+
+func TestUntap(t *testing.T) {
+	b := New(8)
+
+	var kept, untapped bytes.Buffer
+	_, untapKept := b.SnapshotAndTap(&kept)
+	defer untapKept()
+	_, untap := b.SnapshotAndTap(&untapped)
+	failing := &failingWriter{}
+	b.SnapshotAndTap(failing)
+
+	b.Write([]byte("ab"))
+	untap()
+	b.Write([]byte("cd"))
+
+	if kept.String() != "abcd" {
+		t.Errorf("remaining tap got %q, want abcd", kept.String())
+	}
+	if untapped.String() != "ab" {
+		t.Errorf("untapped writer got %q, want ab", untapped.String())
+	}
+	if failing.calls != 1 {
+		t.Errorf("failing tap called %d times, want 1", failing.calls)
+	}
+	untap() // a second untap is harmless
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func TestUntapUncomparableWriter(t *testing.T) {
+	b := New(8)
+	var got []byte
+	_, untap := b.SnapshotAndTap(writerFunc(func(p []byte) (int, error) {
+		got = append(got, p...)
+		return len(p), nil
+	}))
+
+	b.Write([]byte("ab"))
+	untap()
+	b.Write([]byte("cd"))
+	if string(got) != "ab" {
+		t.Errorf("tapped = %q, want ab", got)
+	}
+}
@@ -0,0 +1,212 @@
+package capture
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AnimatedOptions configures a GIF or animated WebP export
+type AnimatedOptions struct {
+	Format   string  `json:"format"`   // "gif" or "webp"
+	StartSec float64 `json:"startSec"` // negative = seconds before the end
+	Duration float64 `json:"duration"` // seconds, 0 = until the end
+	Width    int     `json:"width"`    // output width, height keeps aspect ratio
+	FPS      int     `json:"fps"`
+	Loop     int     `json:"loop"` // 0 = forever, -1 = play once, n = repeat n times
+}
+
+// DefaultAnimatedOptions returns settings suited for short reactions
+func DefaultAnimatedOptions() AnimatedOptions {
+	return AnimatedOptions{
+		Format:   "gif",
+		StartSec: -5,
+		Duration: 5,
+		Width:    480,
+		FPS:      15,
+		Loop:     0,
+	}
+}
+
+func (o *AnimatedOptions) validate() error {
+	if o.Format != "gif" && o.Format != "webp" {
+		return fmt.Errorf("unsupported animated format: %s", o.Format)
+	}
+	if o.Width <= 0 {
+		return fmt.Errorf("width must be positive")
+	}
+	if o.FPS <= 0 || o.FPS > 60 {
+		return fmt.Errorf("FPS must be between 1 and 60")
+	}
+	if o.Duration < 0 {
+		return fmt.Errorf("duration must not be negative")
+	}
+	return nil
+}
+
+// ExportAnimated converts a time range of an existing clip into an
+// optimized GIF (two-pass palette) or animated WebP.
+func (s *Saver) ExportAnimated(inputPath string, opts AnimatedOptions, onProgress func(ExportProgress)) (string, error) {
+	if err := opts.validate(); err != nil {
+		return "", err
+	}
+
+	absIn, err := filepath.Abs(inputPath)
+	if err != nil {
+		return "", err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(absIn), filepath.Ext(absIn))
+	outPath := uniquePath(filepath.Join(s.outputDir, base+"."+opts.Format))
+	if err := s.encodeAnimated(absIn, outPath, opts, onProgress); err != nil {
+		return "", err
+	}
+	return outPath, nil
+}
+
+// ExportAnimatedFromBuffer writes the live buffer to a temp file and exports
+// the requested range from it, without saving a full clip.
+func (s *Saver) ExportAnimatedFromBuffer(src Snapshotter, opts AnimatedOptions, onProgress func(ExportProgress)) (string, error) {
+	if err := opts.validate(); err != nil {
+		return "", err
+	}
+
+	data := src.Snapshot()
+	if len(data) == 0 {
+		return "", fmt.Errorf("buffer is empty")
+	}
+
+	name := fmt.Sprintf("clip_%s", time.Now().Format("20060102_150405"))
+	tmpPath := filepath.Join(os.TempDir(), "rewind_"+name+".ts")
+	if err := s.writeData(tmpPath, data); err != nil {
+		return "", fmt.Errorf("failed to write buffer: %w", err)
+	}
+	defer os.Remove(tmpPath)
+
+	outPath := uniquePath(filepath.Join(s.outputDir, name+"."+opts.Format))
+	if err := s.encodeAnimated(tmpPath, outPath, opts, onProgress); err != nil {
+		return "", err
+	}
+	return outPath, nil
+}
+
+func (s *Saver) encodeAnimated(inPath, outPath string, opts AnimatedOptions, onProgress func(ExportProgress)) error {
+	inputArgs := []string{"-y"}
+	if opts.StartSec < 0 {
+		inputArgs = append(inputArgs, "-sseof", formatSeconds(opts.StartSec))
+	} else if opts.StartSec > 0 {
+		inputArgs = append(inputArgs, "-ss", formatSeconds(opts.StartSec))
+	}
+	if opts.Duration > 0 {
+		inputArgs = append(inputArgs, "-t", formatSeconds(opts.Duration))
+	}
+	inputArgs = append(inputArgs, "-i", inPath)
+
+	total := s.animatedLength(inPath, opts)
+	progress := ExportProgress{Input: inPath, Output: outPath, Preset: opts.Format}
+	report := func(pass, passes int, done time.Duration) {
+		if onProgress == nil {
+			return
+		}
+		frac := 0.0
+		if total > 0 {
+			frac = min(done.Seconds()/total.Seconds(), 1)
+		}
+		progress.Pass = pass
+		progress.Percent = (float64(pass-1) + frac) * 100 / float64(passes)
+		onProgress(progress)
+	}
+
+	filters := fmt.Sprintf("fps=%d,scale=%d:-1:flags=lanczos", opts.FPS, opts.Width)
+
+	if opts.Format == "gif" {
+		palette := filepath.Join(os.TempDir(), fmt.Sprintf("rewind_palette_%d.png", time.Now().UnixNano()))
+		defer os.Remove(palette)
+
+		pass1 := append(append([]string{}, inputArgs...),
+			"-vf", filters+",palettegen=stats_mode=diff",
+			palette,
+		)
+		if err := s.runWithProgress(pass1, func(d time.Duration) { report(1, 2, d) }); err != nil {
+			return fmt.Errorf("palette generation failed: %w", err)
+		}
+
+		pass2 := append(append([]string{}, inputArgs...),
+			"-i", palette,
+			"-lavfi", filters+" [x]; [x][1:v] paletteuse=dither=bayer:bayer_scale=5:diff_mode=rectangle",
+			"-loop", strconv.Itoa(opts.Loop),
+			outPath,
+		)
+		if err := s.runWithProgress(pass2, func(d time.Duration) { report(2, 2, d) }); err != nil {
+			os.Remove(outPath)
+			return fmt.Errorf("gif encoding failed: %w", err)
+		}
+	} else {
+		args := append(append([]string{}, inputArgs...),
+			"-vf", filters,
+			"-c:v", "libwebp",
+			"-lossless", "0",
+			"-q:v", "70",
+			"-preset", "picture",
+			"-loop", strconv.Itoa(webpLoop(opts.Loop)),
+			"-an",
+			outPath,
+		)
+		if err := s.runWithProgress(args, func(d time.Duration) { report(1, 1, d) }); err != nil {
+			os.Remove(outPath)
+			return fmt.Errorf("webp encoding failed: %w", err)
+		}
+	}
+
+	if onProgress != nil {
+		progress.Percent = 100
+		progress.Done = true
+		onProgress(progress)
+	}
+
+	slog.Info("animated export finished", "input", inPath, "output", outPath, "format", opts.Format)
+	return nil
+}
+
+// animatedLength returns how much of the input the export covers, for
+// progress. The input is probed when the range runs to its end; 0 means
+// unknown.
+func (s *Saver) animatedLength(inPath string, opts AnimatedOptions) time.Duration {
+	seconds := func(sec float64) time.Duration { return time.Duration(sec * float64(time.Second)) }
+
+	switch {
+	case opts.StartSec < 0 && opts.Duration > 0:
+		return seconds(min(-opts.StartSec, opts.Duration))
+	case opts.StartSec < 0:
+		return seconds(-opts.StartSec)
+	case opts.Duration > 0:
+		return seconds(opts.Duration)
+	}
+
+	length, err := s.ProbeDuration(inPath)
+	if err != nil {
+		slog.Debug("failed to probe export length", "path", inPath, "error", err)
+		return 0
+	}
+	return max(length-seconds(opts.StartSec), 0)
+}
+
+// webpLoop maps Loop to the loop count of the WebP muxer, which counts
+// plays rather than repeats: 0 = forever, 1 = once
+func webpLoop(loop int) int {
+	switch {
+	case loop < 0:
+		return 1
+	case loop == 0:
+		return 0
+	}
+	return loop + 1
+}
+
+func formatSeconds(sec float64) string {
+	return strconv.FormatFloat(sec, 'f', 3, 64)
+}
@@ -0,0 +1,20 @@
+package capture
+
+import "testing"
+
+func TestWebpLoop(t *testing.T) {
+	tests := []struct {
+		loop, want int
+	}{
+		{0, 0},  // forever
+		{-1, 1}, // play once
+		{1, 2},
+		{5, 6},
+	}
+
+	for _, tt := range tests {
+		if got := webpLoop(tt.loop); got != tt.want {
+			t.Errorf("webpLoop(%d) = %d, want %d", tt.loop, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package capture
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+// AudioTrack is one labeled PCM source (f32le, 48 kHz, stereo)
+type AudioTrack struct {
+	Label  string
+	Source Tapper
+}
+
+// MixedTrackLabel is the title of the optional pre-mixed default track
+const MixedTrackLabel = "Mixed"
+
+// legacyAudioFile is the single mixed PCM file of older raw folders
+const legacyAudioFile = "audio.pcm"
+
+// pcmData is a snapshot of one audio track
+type pcmData struct {
+	label string
+	data  []byte
+}
+
+// pcmFile is an audio track written to disk
+type pcmFile struct {
+	label string
+	path  string
+}
+
+// snapshotTracks copies the current contents of all tracks
+func snapshotTracks(tracks []AudioTrack) []pcmData {
+	var out []pcmData
+	for _, t := range tracks {
+		if data := t.Source.Snapshot(); len(data) > 0 {
+			out = append(out, pcmData{label: t.Label, data: data})
+		}
+	}
+	return out
+}
+
+// pcmBytesPerSecond matches the format in pcmInputArgs: 48kHz stereo f32le
+const pcmBytesPerSecond = 48000 * 2 * 4
+
+// trimTracks keeps the last seconds of every track, so the audio ends
+// together with the video when a clip is shorter than the buffer
+func trimTracks(tracks []pcmData, seconds int) []pcmData {
+	if seconds <= 0 {
+		return tracks
+	}
+	limit := seconds * pcmBytesPerSecond
+	for i := range tracks {
+		if len(tracks[i].data) > limit {
+			tracks[i].data = tracks[i].data[len(tracks[i].data)-limit:]
+		}
+	}
+	return tracks
+}
+
+// audioTrackFile returns the raw folder file name of a track
+func audioTrackFile(label string) string {
+	return "audio_" + strings.ToLower(label) + ".pcm"
+}
+
+// rawAudioFiles lists the PCM files of a raw clip folder, falling back to
+// the single mixed file of older folders
+func rawAudioFiles(folderPath string, metadata *ClipMetadata) []pcmFile {
+	if len(metadata.AudioTracks) > 0 {
+		files := make([]pcmFile, 0, len(metadata.AudioTracks))
+		for _, label := range metadata.AudioTracks {
+			files = append(files, pcmFile{label: label, path: filepath.Join(folderPath, audioTrackFile(label))})
+		}
+		return files
+	}
+	if metadata.HasAudio {
+		return []pcmFile{{label: MixedTrackLabel, path: filepath.Join(folderPath, legacyAudioFile)}}
+	}
+	return nil
+}
+
+// AudioSettings controls how PCM tracks are encoded into clips
+type AudioSettings struct {
+	Codec       string             `json:"codec"`           // "aac" or "opus"
+	BitrateKbps int                `json:"bitrateKbps"`     // per track
+	Mix         bool               `json:"mix"`             // add a pre-mixed default track
+	Normalize   bool               `json:"normalize"`       // EBU R128 two-pass loudnorm per track
+	TargetLUFS  float64            `json:"targetLufs"`      // integrated loudness target
+	Gains       map[string]float64 `json:"gains,omitempty"` // dB per track label
+}
+
+// DefaultAudioSettings returns the settings clips were always saved with
+func DefaultAudioSettings() AudioSettings {
+	return AudioSettings{
+		Codec:       "aac",
+		BitrateKbps: 192,
+		Mix:         true,
+		TargetLUFS:  -16,
+	}
+}
+
+// Validate checks the settings against what the encoders accept
+func (a AudioSettings) Validate() error {
+	if a.Codec != "aac" && a.Codec != "opus" {
+		return fmt.Errorf("unsupported audio codec: %s", a.Codec)
+	}
+	if a.BitrateKbps < 32 || a.BitrateKbps > 512 {
+		return fmt.Errorf("audio bitrate must be between 32 and 512 kbps")
+	}
+	if a.Normalize && (a.TargetLUFS < -70 || a.TargetLUFS > -5) {
+		return fmt.Errorf("loudness target must be between -70 and -5 LUFS")
+	}
+	for label, gain := range a.Gains {
+		if gain < -60 || gain > 30 {
+			return fmt.Errorf("gain for %s must be between -60 and +30 dB", label)
+		}
+	}
+	return nil
+}
+
+// encoderArgs returns the audio encoder args for all output tracks
+func (a AudioSettings) encoderArgs() []string {
+	codec := "aac"
+	if a.Codec == "opus" {
+		codec = "libopus"
+	}
+	kbps := a.BitrateKbps
+	if kbps <= 0 {
+		kbps = 192
+	}
+	return []string{"-c:a", codec, "-b:a", fmt.Sprintf("%dk", kbps)}
+}
+
+// trackFilter returns the gain and loudness filters for one track, or
+// "anull" when nothing has to be changed. measure is nil when the track
+// should not be normalized.
+func (a AudioSettings) trackFilter(label string, measure *loudnessStats) string {
+	// Normalize first, the gain then sets the level relative to the target
+	var filters []string
+	if measure != nil {
+		filters = append(filters, measure.secondPass(a.TargetLUFS), "aresample=48000")
+	}
+	if gain := a.Gains[label]; gain != 0 {
+		filters = append(filters, fmt.Sprintf("volume=%sdB", formatSeconds(gain)))
+	}
+	if len(filters) == 0 {
+		return "anull"
+	}
+	return strings.Join(filters, ",")
+}
+
+// audioMergeArgs returns the ffmpeg input and output args that add the PCM
+// files as labeled tracks next to video input 0. With Mix set and more than
+// one file, a pre-mixed track is added first and marked as default. Further
+// inputs go between the two.
+func (s *Saver) audioMergeArgs(files []pcmFile, audio AudioSettings) (inputs, args []string) {
+	for _, f := range files {
+		inputs = append(inputs, pcmInputArgs(f.path)...)
+	}
+
+	// Each track gets its own gain and loudness correction; the mix is made
+	// from the corrected tracks
+	mix := audio.Mix && len(files) > 1
+	var graph []string
+	for i, f := range files {
+		var measure *loudnessStats
+		if audio.Normalize {
+			m, err := s.measureLoudness(pcmInputArgs(f.path), audio)
+			if err != nil {
+				slog.Warn("loudness measurement failed, track not normalized", "track", f.label, "error", err)
+			} else {
+				measure = m
+			}
+		}
+
+		chain := fmt.Sprintf("[%d:a]%s", i+1, audio.trackFilter(f.label, measure))
+		if mix {
+			chain += fmt.Sprintf(",asplit=2[t%d][m%d]", i, i)
+		} else {
+			chain += fmt.Sprintf("[t%d]", i)
+		}
+		graph = append(graph, chain)
+	}
+
+	labels := make([]string, 0, len(files)+1)
+	args = append(args, "-map", "0:v")
+	if mix {
+		var inputs strings.Builder
+		for i := range files {
+			fmt.Fprintf(&inputs, "[m%d]", i)
+		}
+		graph = append(graph, fmt.Sprintf("%samix=inputs=%d:duration=longest:normalize=0[mix]", inputs.String(), len(files)))
+		labels = append(labels, MixedTrackLabel)
+	}
+
+	args = append(args, "-filter_complex", strings.Join(graph, ";"))
+	if mix {
+		args = append(args, "-map", "[mix]")
+	}
+	for i, f := range files {
+		args = append(args, "-map", fmt.Sprintf("[t%d]", i))
+		labels = append(labels, f.label)
+	}
+
+	args = append(args, "-c:v", "copy")
+	args = append(args, audio.encoderArgs()...)
+	for i, label := range labels {
+		disposition := "0"
+		if i == 0 {
+			disposition = "default"
+		}
+		args = append(args,
+			fmt.Sprintf("-metadata:s:a:%d", i), "title="+label,
+			fmt.Sprintf("-metadata:s:a:%d", i), "handler_name="+label,
+			fmt.Sprintf("-disposition:a:%d", i), disposition,
+		)
+	}
+	return inputs, append(args, "-shortest")
+}
+
+func pcmInputArgs(path string) []string {
+	abs, _ := filepath.Abs(path)
+	return []string{"-f", "f32le", "-ar", "48000", "-ac", "2", "-i", abs}
+}
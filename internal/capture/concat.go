@@ -0,0 +1,252 @@
+package capture
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ConcatOptions configures how clips are joined into a highlight reel
+type ConcatOptions struct {
+	Name      string  `json:"name"`      // output name without extension, "" = highlights_<time>
+	Crossfade float64 `json:"crossfade"` // seconds between clips, 0 = hard cuts
+	Reencode  bool    `json:"reencode"`  // re-encode even if the clips could be stream-copied
+}
+
+// Concat joins clips in the given order into a new MP4. Clips with matching
+// codecs and resolution are stream-copied; otherwise, or with a crossfade,
+// everything is re-encoded to the format of the first clip.
+func (s *Saver) Concat(inputs []string, opts ConcatOptions, onProgress func(ExportProgress)) (string, error) {
+	if len(inputs) < 2 {
+		return "", fmt.Errorf("at least two clips are needed")
+	}
+	if opts.Crossfade < 0 {
+		return "", fmt.Errorf("crossfade must not be negative")
+	}
+
+	infos := make([]*MediaInfo, len(inputs))
+	for i, in := range inputs {
+		abs, err := filepath.Abs(in)
+		if err != nil {
+			return "", err
+		}
+		info, err := s.Probe(abs)
+		if err != nil {
+			return "", fmt.Errorf("failed to probe %s: %w", filepath.Base(in), err)
+		}
+		if info.VideoCodec == "" {
+			return "", fmt.Errorf("%s has no video stream", filepath.Base(in))
+		}
+		inputs[i], infos[i] = abs, info
+	}
+
+	var total time.Duration
+	shortest := infos[0].Duration
+	for _, info := range infos {
+		total += info.Duration
+		shortest = min(shortest, info.Duration)
+	}
+	fade := time.Duration(opts.Crossfade * float64(time.Second))
+	if fade > 0 && fade*2 > shortest {
+		return "", fmt.Errorf("crossfade is too long for the shortest clip")
+	}
+	total -= fade * time.Duration(len(inputs)-1)
+
+	name := opts.Name
+	if name == "" {
+		name = fmt.Sprintf("highlights_%s", time.Now().Format("20060102_150405"))
+	}
+	outPath := uniquePath(filepath.Join(s.outputDir, name+".mp4"))
+
+	metadata := &ClipMetadata{
+		DurationSec: int(math.Round(total.Seconds())),
+		CreatedAt:   time.Now(),
+	}
+	for _, in := range inputs {
+		metadata.Sources = append(metadata.Sources, s.sourceName(in))
+	}
+
+	progress := ExportProgress{Input: inputs[0], Output: outPath, Preset: "concat", Pass: 1}
+	onTime := func(d time.Duration) {
+		if onProgress == nil || total <= 0 {
+			return
+		}
+		progress.Percent = min(d.Seconds()/total.Seconds(), 1) * 100
+		onProgress(progress)
+	}
+
+	var args []string
+	copyStreams := !opts.Reencode && fade == 0 && streamsMatch(infos)
+	if copyStreams {
+		listPath, err := writeConcatList(inputs)
+		if err != nil {
+			return "", fmt.Errorf("failed to write concat list: %w", err)
+		}
+		defer os.Remove(listPath)
+
+		args = []string{"-y", "-f", "concat", "-safe", "0", "-i", listPath, "-map", "0", "-c", "copy"}
+		metadata.HasAudio = infos[0].AudioCount > 0
+	} else {
+		args = []string{"-y"}
+		for _, in := range inputs {
+			args = append(args, "-i", in)
+		}
+		graph, hasAudio := concatFilter(infos, fade)
+		args = append(args,
+			"-filter_complex", graph,
+			"-map", "[v]",
+			"-c:v", "libx264", "-crf", "20", "-preset", "medium", "-pix_fmt", "yuv420p",
+		)
+		if hasAudio {
+			args = append(args, "-map", "[a]", "-c:a", "aac", "-b:a", "192k")
+		}
+		metadata.HasAudio = hasAudio
+	}
+
+	first := infos[0]
+	metadata.Codec, metadata.Width, metadata.Height = first.VideoCodec, first.Width, first.Height
+	metadata.FPS = int(math.Round(first.FPS))
+	if !copyStreams {
+		metadata.Codec = "h264"
+	}
+
+	args = append(args, metadataArgs(metadata, "faststart")...)
+	args = append(args, "-f", "mp4", outPath+partSuffix)
+
+	if err := s.runWithProgress(args, onTime); err != nil {
+		os.Remove(outPath + partSuffix)
+		return "", fmt.Errorf("concat failed: %w", err)
+	}
+	if err := os.Rename(outPath+partSuffix, outPath); err != nil {
+		return "", err
+	}
+
+	if err := s.writeMetadata(MetadataPath(outPath), metadata); err != nil {
+		slog.Error("failed to save metadata", "error", err)
+	}
+
+	if onProgress != nil {
+		progress.Percent = 100
+		progress.Done = true
+		onProgress(progress)
+	}
+
+	slog.Info("clips concatenated", "output", outPath, "clips", len(inputs), "streamCopy", copyStreams)
+	return outPath, nil
+}
+
+// sourceName returns how a highlight reel refers to one of its clips
+func (s *Saver) sourceName(clipPath string) string {
+	root, err := filepath.Abs(s.outputDir)
+	if err != nil {
+		return filepath.ToSlash(clipPath)
+	}
+	rel, err := filepath.Rel(root, clipPath)
+	if err != nil || !filepath.IsLocal(rel) {
+		return filepath.ToSlash(clipPath)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// streamsMatch reports whether all clips can be joined without re-encoding
+func streamsMatch(infos []*MediaInfo) bool {
+	first := infos[0]
+	for _, info := range infos[1:] {
+		if info.VideoCodec != first.VideoCodec ||
+			info.Width != first.Width || info.Height != first.Height ||
+			math.Abs(info.FPS-first.FPS) > 0.01 ||
+			info.AudioCodec != first.AudioCodec || info.AudioCount != first.AudioCount {
+			return false
+		}
+	}
+	return true
+}
+
+// writeConcatList writes an ffmpeg concat demuxer list of the inputs
+func writeConcatList(inputs []string) (string, error) {
+	var b strings.Builder
+	for _, in := range inputs {
+		fmt.Fprintf(&b, "file '%s'\n", strings.ReplaceAll(filepath.ToSlash(in), "'", `'\''`))
+	}
+
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("rewind_concat_%d.txt", time.Now().UnixNano()))
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// concatFilter builds a filter graph that scales every clip to the first
+// one's format and joins them, with crossfades when fade is set. Clips
+// without audio get silence if any other clip has audio.
+func concatFilter(infos []*MediaInfo, fade time.Duration) (string, bool) {
+	first := infos[0]
+	fps := first.FPS
+	if fps <= 0 {
+		fps = 30
+	}
+
+	hasAudio := false
+	for _, info := range infos {
+		if info.AudioCount > 0 {
+			hasAudio = true
+		}
+	}
+
+	var parts []string
+	for i, info := range infos {
+		parts = append(parts, fmt.Sprintf(
+			"[%d:v]scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=%s,format=yuv420p[v%d]",
+			i, first.Width, first.Height, first.Width, first.Height, formatSeconds(fps), i))
+
+		if !hasAudio {
+			continue
+		}
+		if info.AudioCount > 0 {
+			parts = append(parts, fmt.Sprintf("[%d:a:0]aresample=48000,aformat=channel_layouts=stereo[a%d]", i, i))
+		} else {
+			parts = append(parts, fmt.Sprintf("aevalsrc=0:channel_layout=stereo:sample_rate=48000:duration=%s[a%d]",
+				formatSeconds(info.Duration.Seconds()), i))
+		}
+	}
+
+	if fade <= 0 {
+		var inputs strings.Builder
+		for i := range infos {
+			fmt.Fprintf(&inputs, "[v%d]", i)
+			if hasAudio {
+				fmt.Fprintf(&inputs, "[a%d]", i)
+			}
+		}
+		audio, outputs := 0, "[v]"
+		if hasAudio {
+			audio, outputs = 1, "[v][a]"
+		}
+		parts = append(parts, fmt.Sprintf("%sconcat=n=%d:v=1:a=%d%s", inputs.String(), len(infos), audio, outputs))
+		return strings.Join(parts, ";"), hasAudio
+	}
+
+	// Chain xfade/acrossfade, each one starting fade before the end of
+	// everything joined so far
+	d := formatSeconds(fade.Seconds())
+	prevV, prevA := "[v0]", "[a0]"
+	var offset time.Duration
+	for i := 1; i < len(infos); i++ {
+		offset += infos[i-1].Duration - fade
+		outV, outA := fmt.Sprintf("[xv%d]", i), fmt.Sprintf("[xa%d]", i)
+		if i == len(infos)-1 {
+			outV, outA = "[v]", "[a]"
+		}
+		parts = append(parts, fmt.Sprintf("%s[v%d]xfade=transition=fade:duration=%s:offset=%s%s",
+			prevV, i, d, formatSeconds(offset.Seconds()), outV))
+		if hasAudio {
+			parts = append(parts, fmt.Sprintf("%s[a%d]acrossfade=d=%s%s", prevA, i, d, outA))
+		}
+		prevV, prevA = outV, outA
+	}
+	return strings.Join(parts, ";"), hasAudio
+}
@@ -0,0 +1,55 @@
+package capture
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSourceName(t *testing.T) {
+	root := t.TempDir()
+	s := &Saver{outputDir: root}
+	outside := filepath.Join(filepath.Dir(root), "elsewhere", "c.mp4")
+
+	tests := []struct {
+		path, want string
+	}{
+		{filepath.Join(root, "a.mp4"), "a.mp4"},
+		{filepath.Join(root, "Game", "2024-03", "b.mp4"), "Game/2024-03/b.mp4"},
+		{outside, filepath.ToSlash(outside)},
+	}
+
+	for _, tt := range tests {
+		if got := s.sourceName(tt.path); got != tt.want {
+			t.Errorf("sourceName(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMetadataArgsMovflags(t *testing.T) {
+	m := &ClipMetadata{Sources: []string{"a.mp4", "b.mp4"}}
+
+	tests := []struct {
+		movflags []string
+		want     string
+	}{
+		{nil, "+use_metadata_tags"},
+		{[]string{"faststart"}, "+faststart+use_metadata_tags"},
+	}
+
+	for _, tt := range tests {
+		args := metadataArgs(m, tt.movflags...)
+		var flags []string
+		for i, a := range args {
+			if a == "-movflags" {
+				flags = append(flags, args[i+1])
+			}
+		}
+		if !slices.Equal(flags, []string{tt.want}) {
+			t.Errorf("metadataArgs(%q) movflags = %q, want [%q]", tt.movflags, flags, tt.want)
+		}
+		if !slices.Contains(args, "rewind_sources=a.mp4; b.mp4") {
+			t.Errorf("metadataArgs(%q) = %q, missing sources", tt.movflags, args)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package capture
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	hiddenexec "rewind/internal/utils"
+)
+
+// ExportPreset describes how an existing clip is re-encoded for sharing
+type ExportPreset struct {
+	Name         string `json:"name"`
+	Label        string `json:"label"`
+	Container    string `json:"container"`    // "mp4" or "webm"
+	VideoCodec   string `json:"videoCodec"`   // ffmpeg encoder name
+	AudioCodec   string `json:"audioCodec"`   // ffmpeg encoder name
+	AudioKbps    int    `json:"audioKbps"`    // audio bitrate in kbit/s
+	MaxHeight    int    `json:"maxHeight"`    // 0 = keep source resolution
+	TargetSizeMB int    `json:"targetSizeMB"` // 0 = quality based, otherwise two-pass
+	CRF          int    `json:"crf"`          // used when TargetSizeMB is 0
+	Profile      string `json:"profile,omitempty"`
+}
+
+// ExportPresets are the built-in presets offered by ExportClip
+var ExportPresets = []ExportPreset{
+	{Name: "size-10mb", Label: "10 MB (chat)", Container: "mp4", VideoCodec: "libx264", AudioCodec: "aac", AudioKbps: 96, MaxHeight: 720, TargetSizeMB: 10},
+	{Name: "size-25mb", Label: "25 MB", Container: "mp4", VideoCodec: "libx264", AudioCodec: "aac", AudioKbps: 128, MaxHeight: 1080, TargetSizeMB: 25},
+	{Name: "size-50mb", Label: "50 MB", Container: "mp4", VideoCodec: "libx264", AudioCodec: "aac", AudioKbps: 160, MaxHeight: 1080, TargetSizeMB: 50},
+	{Name: "720p", Label: "720p", Container: "mp4", VideoCodec: "libx264", AudioCodec: "aac", AudioKbps: 160, MaxHeight: 720, CRF: 23},
+	{Name: "1080p", Label: "1080p", Container: "mp4", VideoCodec: "libx264", AudioCodec: "aac", AudioKbps: 192, MaxHeight: 1080, CRF: 21},
+	{Name: "webm-vp9", Label: "WebM (VP9)", Container: "webm", VideoCodec: "libvpx-vp9", AudioCodec: "libopus", AudioKbps: 128, CRF: 32},
+	{Name: "h264-baseline", Label: "H.264 Baseline (compatible)", Container: "mp4", VideoCodec: "libx264", AudioCodec: "aac", AudioKbps: 128, MaxHeight: 1080, CRF: 23, Profile: "baseline"},
+}
+
+// FindExportPreset returns the built-in preset with the given name
+func FindExportPreset(name string) (ExportPreset, bool) {
+	for _, p := range ExportPresets {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return ExportPreset{}, false
+}
+
+// ExportProgress reports how far an export has come
+type ExportProgress struct {
+	Input   string  `json:"input"`
+	Output  string  `json:"output"`
+	Preset  string  `json:"preset"`
+	Pass    int     `json:"pass"`
+	Percent float64 `json:"percent"` // 0-100 over all passes
+	Done    bool    `json:"done"`
+}
+
+// Export re-encodes an existing clip with the given preset and returns the
+// output path. audio optionally applies per-track gains and loudness
+// normalization; onProgress may be nil.
+func (s *Saver) Export(inputPath string, preset ExportPreset, audio *AudioSettings, onProgress func(ExportProgress)) (string, error) {
+	absIn, err := filepath.Abs(inputPath)
+	if err != nil {
+		return "", err
+	}
+
+	audioArgs, err := s.exportAudioArgs(absIn, audio)
+	if err != nil {
+		return "", err
+	}
+	audioArgs = append(audioArgs, preset.audioArgs()...)
+
+	duration, err := s.ProbeDuration(absIn)
+	if err != nil {
+		return "", fmt.Errorf("failed to probe duration: %w", err)
+	}
+
+	base := strings.TrimSuffix(filepath.Base(absIn), filepath.Ext(absIn))
+	outPath := uniquePath(filepath.Join(s.outputDir, fmt.Sprintf("%s_%s.%s", base, preset.Name, preset.Container)))
+
+	progress := ExportProgress{Input: absIn, Output: outPath, Preset: preset.Name}
+	report := func(pass, passes int, done time.Duration) {
+		if onProgress == nil {
+			return
+		}
+		frac := 0.0
+		if duration > 0 {
+			frac = done.Seconds() / duration.Seconds()
+		}
+		if frac > 1 {
+			frac = 1
+		}
+		progress.Pass = pass
+		progress.Percent = (float64(pass-1) + frac) * 100 / float64(passes)
+		onProgress(progress)
+	}
+
+	if preset.TargetSizeMB > 0 {
+		videoKbps := targetVideoKbps(preset.TargetSizeMB, preset.AudioKbps, duration)
+		if videoKbps <= 0 {
+			return "", fmt.Errorf("clip too long for %d MB", preset.TargetSizeMB)
+		}
+
+		passLog := filepath.Join(os.TempDir(), fmt.Sprintf("rewind_%s_%d", base, time.Now().UnixNano()))
+		defer cleanupPassLogs(passLog)
+
+		pass1 := append([]string{"-y", "-i", absIn}, preset.videoArgs(videoKbps)...)
+		pass1 = append(pass1, "-pass", "1", "-passlogfile", passLog, "-an", "-f", "null", os.DevNull)
+		if err := s.runWithProgress(pass1, func(d time.Duration) { report(1, 2, d) }); err != nil {
+			return "", fmt.Errorf("first pass failed: %w", err)
+		}
+
+		pass2 := append([]string{"-y", "-i", absIn}, preset.videoArgs(videoKbps)...)
+		pass2 = append(pass2, "-pass", "2", "-passlogfile", passLog)
+		pass2 = append(pass2, audioArgs...)
+		pass2 = append(pass2, outPath)
+		if err := s.runWithProgress(pass2, func(d time.Duration) { report(2, 2, d) }); err != nil {
+			os.Remove(outPath)
+			return "", fmt.Errorf("second pass failed: %w", err)
+		}
+	} else {
+		args := append([]string{"-y", "-i", absIn}, preset.videoArgs(0)...)
+		args = append(args, audioArgs...)
+		args = append(args, outPath)
+		if err := s.runWithProgress(args, func(d time.Duration) { report(1, 1, d) }); err != nil {
+			os.Remove(outPath)
+			return "", fmt.Errorf("export failed: %w", err)
+		}
+	}
+
+	if onProgress != nil {
+		progress.Percent = 100
+		progress.Done = true
+		onProgress(progress)
+	}
+
+	slog.Info("clip exported", "input", absIn, "output", outPath, "preset", preset.Name)
+	return outPath, nil
+}
+
+func (p ExportPreset) videoArgs(videoKbps int) []string {
+	args := []string{"-c:v", p.VideoCodec}
+
+	if p.MaxHeight > 0 {
+		// Only downscale, keep aspect ratio and even width
+		args = append(args, "-vf", fmt.Sprintf("scale=-2:'min(%d,ih)'", p.MaxHeight))
+	}
+
+	if videoKbps > 0 {
+		rate := fmt.Sprintf("%dk", videoKbps)
+		args = append(args, "-b:v", rate, "-maxrate", rate, "-bufsize", fmt.Sprintf("%dk", videoKbps*2))
+	} else if p.VideoCodec == "libvpx-vp9" {
+		args = append(args, "-crf", strconv.Itoa(p.CRF), "-b:v", "0", "-row-mt", "1")
+	} else {
+		args = append(args, "-crf", strconv.Itoa(p.CRF))
+	}
+
+	if p.VideoCodec == "libx264" {
+		args = append(args, "-preset", "medium", "-pix_fmt", "yuv420p")
+	}
+	if p.Profile != "" {
+		args = append(args, "-profile:v", p.Profile)
+	}
+	if p.Container == "mp4" {
+		args = append(args, "-movflags", "+faststart")
+	}
+	return args
+}
+
+func (p ExportPreset) audioArgs() []string {
+	return []string{"-c:a", p.AudioCodec, "-b:a", fmt.Sprintf("%dk", p.AudioKbps)}
+}
+
+// targetVideoKbps computes the video bitrate that fits the clip into
+// sizeMB, leaving room for audio and container overhead.
+func targetVideoKbps(sizeMB, audioKbps int, duration time.Duration) int {
+	if duration <= 0 {
+		return 0
+	}
+	totalKbits := float64(sizeMB) * 1024 * 1024 * 8 / 1000 * 0.97
+	return int(totalKbits/duration.Seconds()) - audioKbps
+}
+
+// runWithProgress runs ffmpeg and calls onTime with the encoded position
+func (s *Saver) runWithProgress(args []string, onTime func(time.Duration)) error {
+	args = append([]string{"-hide_banner", "-nostats", "-progress", "pipe:1"}, args...)
+	cmd := hiddenexec.Command(s.ffmpegPath, args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok || key != "out_time_us" {
+			continue
+		}
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil && onTime != nil {
+			onTime(time.Duration(us) * time.Microsecond)
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		slog.Error("ffmpeg failed", "error", err, "output", lastLines(stderr.String(), 5))
+		return err
+	}
+	return nil
+}
+
+// uniquePath appends a counter to path until it does not exist
+func uniquePath(path string) string {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s_%d%s", base, i, ext)
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+func cleanupPassLogs(prefix string) {
+	matches, _ := filepath.Glob(prefix + "*")
+	for _, m := range matches {
+		os.Remove(m)
+	}
+}
+
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,79 @@
+package capture
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// Tapper is a source that can hand out its current contents and keep
+// streaming new writes to w until untapped.
+type Tapper interface {
+	Snapshotter
+	SnapshotAndTap(w io.Writer) ([]byte, func())
+}
+
+// SaveExtended saves the buffered past together with live data that keeps
+// arriving until stop is closed. The result is written as one clip through
+// the same pipeline as SaveWithAudio.
+func (s *Saver) SaveExtended(videoSrc Tapper, audioTracks []AudioTrack, opts *SaveOptions, stop <-chan struct{}) error {
+	var videoTail bytes.Buffer
+
+	videoData, untapVideo := videoSrc.SnapshotAndTap(&videoTail)
+	if len(videoData) == 0 {
+		untapVideo()
+		return fmt.Errorf("buffer is empty")
+	}
+
+	type tappedTrack struct {
+		label string
+		data  []byte
+		tail  *bytes.Buffer
+		untap func()
+	}
+	tapped := make([]tappedTrack, 0, len(audioTracks))
+	for _, t := range audioTracks {
+		tail := &bytes.Buffer{}
+		data, untap := t.Source.SnapshotAndTap(tail)
+		tapped = append(tapped, tappedTrack{label: t.Label, data: data, tail: tail, untap: untap})
+	}
+
+	started := time.Now()
+	slog.Info("extended save started", "filename", opts.Filename)
+
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		<-stop
+		untapVideo()
+		for _, t := range tapped {
+			t.untap()
+		}
+
+		elapsed := time.Since(started)
+		videoData = append(videoData, videoTail.Bytes()...)
+		videoTail.Reset()
+
+		var audioData []pcmData
+		for _, t := range tapped {
+			data := append(t.data, t.tail.Bytes()...)
+			if len(data) > 0 {
+				audioData = append(audioData, pcmData{label: t.label, data: data})
+			}
+		}
+
+		if opts.DurationSec > 0 {
+			opts.DurationSec += int(elapsed.Round(time.Second).Seconds())
+		}
+
+		audioData = trimTracks(audioData, opts.DurationSec)
+		opts.addChapters(time.Now())
+
+		slog.Info("extended save capturing finished", "filename", opts.Filename, "after", elapsed)
+		s.processSaveWithAudio(videoData, audioData, opts)
+	}()
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package capture
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"rewind/internal/buffer"
+)
+
+func TestSaveExtended(t *testing.T) {
+	s := NewSaver("", t.TempDir())
+	done := make(chan string, 1)
+	s.OnComplete = func(path string, err error) {
+		if err != nil {
+			t.Errorf("save error = %v", err)
+		}
+		done <- path
+	}
+
+	video := buffer.New(8)
+	video.Write([]byte("abcdefghij")) // wraps, keeps cdefghij
+	mic := buffer.New(16)
+	mic.Write([]byte("1234"))
+
+	opts := DefaultSaveOptions("clip")
+	opts.ConvertToMP4 = false
+	stop := make(chan struct{})
+	if err := s.SaveExtended(video, []AudioTrack{{Label: "Mic", Source: mic}}, opts, stop); err != nil {
+		t.Fatalf("SaveExtended() error = %v", err)
+	}
+
+	// Live data joins the buffered past until stop is closed
+	video.Write([]byte("klm"))
+	mic.Write([]byte("56"))
+	close(stop)
+	s.Wait()
+	video.Write([]byte("nop"))
+
+	dir := <-done
+	tests := []struct {
+		file string
+		want string
+	}{
+		{file: "video.ts", want: "cdefghijklm"},
+		{file: audioTrackFile("Mic"), want: "123456"},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile(filepath.Join(dir, tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("%s = %q, want %q", tt.file, data, tt.want)
+		}
+	}
+}
+
+func TestSaveExtendedEmptyBuffer(t *testing.T) {
+	s := NewSaver("", t.TempDir())
+	video := buffer.New(8)
+
+	if err := s.SaveExtended(video, nil, DefaultSaveOptions("clip"), make(chan struct{})); err == nil {
+		t.Fatal("SaveExtended() of an empty buffer succeeded")
+	}
+}
@@ -0,0 +1,355 @@
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"rewind/internal/utils"
+)
+
+const (
+	// InflightDirName holds clips that are still being written, one raw
+	// folder per save
+	InflightDirName = ".inflight"
+
+	// journalFile marks a folder in the in-flight dir as a pending save
+	journalFile = "journal.json"
+
+	// partSuffix marks files that are still being written
+	partSuffix = utils.PartSuffix
+)
+
+// saveJournal records what a pending save was going to produce, so that an
+// interrupted save can be finished on the next start
+type saveJournal struct {
+	Filename     string        `json:"filename"`
+	ConvertToMP4 bool          `json:"convertToMP4"`
+	Audio        AudioSettings `json:"audio"`
+	DurationSec  int           `json:"durationSec"`
+	AudioTracks  []string      `json:"audioTracks,omitempty"`
+	StartedAt    time.Time     `json:"startedAt"`
+	Metadata     *ClipMetadata `json:"metadata,omitempty"`
+}
+
+// RecoveryReport lists what Recover found in the output dir
+type RecoveryReport struct {
+	Recovered []string `json:"recovered"` // final clip paths
+	Failed    []string `json:"failed"`    // leftovers that could not be recovered
+	Discarded int      `json:"discarded"` // empty or unusable leftovers removed
+}
+
+// Empty reports whether nothing was left over
+func (r *RecoveryReport) Empty() bool {
+	return len(r.Recovered) == 0 && len(r.Failed) == 0 && r.Discarded == 0
+}
+
+// beginSave creates the in-flight folder of a save and its journal
+func (s *Saver) beginSave(opts *SaveOptions, audioData []pcmData) (string, error) {
+	workDir := s.inflightDir(opts.Filename)
+	if err := os.MkdirAll(workDir, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	j := saveJournal{
+		Filename:     opts.Filename,
+		ConvertToMP4: opts.ConvertToMP4,
+		Audio:        opts.Audio,
+		DurationSec:  opts.DurationSec,
+		StartedAt:    time.Now(),
+		Metadata:     opts.Metadata,
+	}
+	for _, track := range audioData {
+		j.AudioTracks = append(j.AudioTracks, track.label)
+	}
+
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := utils.WriteFileAtomic(filepath.Join(workDir, journalFile), data); err != nil {
+		os.RemoveAll(workDir)
+		return "", err
+	}
+	return workDir, nil
+}
+
+// commitRaw drops the journal and moves a finished in-flight folder into
+// the output dir as a raw clip
+func (s *Saver) commitRaw(workDir, filename string) (string, error) {
+	os.Remove(filepath.Join(workDir, journalFile))
+
+	clipDir := uniquePath(filepath.Join(s.outputDir, filename))
+	if err := os.MkdirAll(filepath.Dir(clipDir), os.ModePerm); err != nil {
+		return "", err
+	}
+	if err := os.Rename(workDir, clipDir); err != nil {
+		return "", fmt.Errorf("failed to move raw clip into place: %w", err)
+	}
+	return clipDir, nil
+}
+
+// Recover finishes saves that were interrupted before the given time:
+// in-flight folders are converted or kept as raw clips, and TS/PCM pairs
+// left in the output dir by older versions are merged.
+func (s *Saver) Recover(before time.Time) *RecoveryReport {
+	report := &RecoveryReport{}
+	s.recoverInflight(before, report)
+	s.recoverLegacy(before, report)
+
+	if !report.Empty() {
+		slog.Info("clip recovery finished",
+			"recovered", len(report.Recovered),
+			"failed", len(report.Failed),
+			"discarded", report.Discarded,
+		)
+	}
+	return report
+}
+
+func (s *Saver) recoverInflight(before time.Time, report *RecoveryReport) {
+	inflightDir := filepath.Join(s.outputDir, InflightDirName)
+	entries, err := os.ReadDir(inflightDir)
+	if err != nil {
+		return
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		workDir := filepath.Join(inflightDir, e.Name())
+
+		j, err := readJournal(workDir)
+		if err != nil {
+			// The journal is written first; without it nothing was saved
+			if info, err := e.Info(); err == nil && info.ModTime().Before(before) {
+				os.RemoveAll(workDir)
+				report.Discarded++
+			}
+			continue
+		}
+		if !j.StartedAt.Before(before) {
+			continue
+		}
+
+		path, err := s.recoverSave(workDir, j)
+		if err != nil {
+			slog.Warn("failed to recover clip", "dir", workDir, "error", err)
+			report.Failed = append(report.Failed, workDir)
+			continue
+		}
+		if path == "" {
+			report.Discarded++
+			continue
+		}
+		slog.Info("recovered interrupted clip", "path", path)
+		report.Recovered = append(report.Recovered, path)
+	}
+}
+
+// recoverSave finishes one in-flight save. It returns "" when there was no
+// usable video to recover.
+func (s *Saver) recoverSave(workDir string, j *saveJournal) (string, error) {
+	info, err := os.Stat(filepath.Join(workDir, "video.ts"))
+	if err != nil || info.Size() == 0 {
+		os.RemoveAll(workDir)
+		return "", nil
+	}
+
+	metadata, err := ReadMetadata(workDir)
+	if err != nil {
+		// Interrupted before the metadata was written, rebuild it from the
+		// journal and the tracks that made it to disk
+		metadata = &ClipMetadata{}
+		if j.Metadata != nil {
+			*metadata = *j.Metadata
+		}
+		metadata.DurationSec = j.DurationSec
+		metadata.CreatedAt = j.StartedAt
+		metadata.AudioTracks = nil
+		for _, label := range j.AudioTracks {
+			if _, err := os.Stat(filepath.Join(workDir, audioTrackFile(label))); err == nil {
+				metadata.AudioTracks = append(metadata.AudioTracks, label)
+			}
+		}
+		metadata.HasAudio = len(metadata.AudioTracks) > 0
+
+		if err := s.writeMetadata(filepath.Join(workDir, rawMetadataFile), metadata); err != nil {
+			return "", err
+		}
+	}
+
+	if j.ConvertToMP4 {
+		mp4Path := filepath.Join(s.outputDir, j.Filename+".mp4")
+		if err := os.MkdirAll(filepath.Dir(mp4Path), os.ModePerm); err != nil {
+			return "", err
+		}
+		mp4Path, err := s.convertFolder(workDir, mp4Path, metadata, j.Audio)
+		if err == nil {
+			s.verifyClip(mp4Path, workDir, metadata)
+			if err := s.writeMetadata(MetadataPath(mp4Path), metadata); err != nil {
+				slog.Warn("failed to save metadata", "error", err)
+			}
+			os.RemoveAll(workDir)
+			return mp4Path, nil
+		}
+		slog.Warn("conversion of interrupted clip failed, keeping raw clip", "dir", workDir, "error", err)
+	}
+
+	return s.commitRaw(workDir, j.Filename)
+}
+
+func readJournal(workDir string) (*saveJournal, error) {
+	data, err := os.ReadFile(filepath.Join(workDir, journalFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var j saveJournal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// legacyTrackLabels are the audio tracks older versions wrote as
+// clip_X_<track>.pcm next to the TS file (audio.TrackMic, audio.TrackSystem)
+var legacyTrackLabels = []string{"Mic", "System"}
+
+// recoverLegacy merges clip_X.ts files anywhere in the output dir that
+// still have PCM audio next to them and removes the saver's stale partial
+// files
+func (s *Saver) recoverLegacy(before time.Time, report *RecoveryReport) {
+	filepath.WalkDir(s.outputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d != nil && d.IsDir() && path != s.outputDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			// .inflight, .trash, .sources and other hidden folders are
+			// handled by their owners
+			if path != s.outputDir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || !info.ModTime().Before(before) {
+			return nil
+		}
+		s.recoverLegacyFile(path, info.ModTime(), report)
+		return nil
+	})
+}
+
+// recoverLegacyFile handles one file found by recoverLegacy
+func (s *Saver) recoverLegacyFile(path string, modTime time.Time, report *RecoveryReport) {
+	name := filepath.Base(path)
+	dir := filepath.Dir(path)
+
+	if isSaverPart(name) {
+		os.Remove(path)
+		report.Discarded++
+		return
+	}
+	if filepath.Ext(name) != ".ts" {
+		return
+	}
+
+	base := strings.TrimSuffix(name, ".ts")
+	pcmFiles := legacyPCMFiles(dir, base)
+	if len(pcmFiles) == 0 {
+		// Plain .ts clips are listed as clips, leave them alone
+		return
+	}
+
+	mp4Path := filepath.Join(dir, base+".mp4")
+	if _, err := s.Probe(mp4Path); err == nil {
+		// The merge finished, only the cleanup was interrupted
+		removeLegacyFiles(path, pcmFiles)
+		report.Discarded++
+		return
+	}
+
+	mp4Path, err := s.mergeLegacy(path, pcmFiles, mp4Path, modTime)
+	if err != nil {
+		slog.Warn("failed to recover clip", "path", path, "error", err)
+		report.Failed = append(report.Failed, path)
+		return
+	}
+	removeLegacyFiles(path, pcmFiles)
+	slog.Info("recovered interrupted clip", "path", mp4Path)
+	report.Recovered = append(report.Recovered, mp4Path)
+}
+
+// isSaverPart reports whether name is a partial file the saver writes: an
+// MP4 being converted or a metadata sidecar being replaced. Other partial
+// files, e.g. browser downloads in a shared folder, are not ours to remove.
+func isSaverPart(name string) bool {
+	base, ok := strings.CutSuffix(name, partSuffix)
+	if !ok {
+		return false
+	}
+	ext := filepath.Ext(base)
+	return ext == ".mp4" || ext == ".json"
+}
+
+// legacyPCMFiles finds base.pcm and base_<track>.pcm next to a TS file.
+// Only known track labels count, so the files of clip_1_2 are never taken
+// for tracks of clip_1.
+func legacyPCMFiles(dir, base string) []pcmFile {
+	var files []pcmFile
+	if _, err := os.Stat(filepath.Join(dir, base+".pcm")); err == nil {
+		files = append(files, pcmFile{label: MixedTrackLabel, path: filepath.Join(dir, base+".pcm")})
+	}
+
+	for _, label := range legacyTrackLabels {
+		path := filepath.Join(dir, base+"_"+strings.ToLower(label)+".pcm")
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, pcmFile{label: label, path: path})
+		}
+	}
+	return files
+}
+
+// mergeLegacy merges a TS file and its PCM tracks without trimming, since
+// the intended duration was not recorded. It returns the path written.
+func (s *Saver) mergeLegacy(tsPath string, pcmFiles []pcmFile, mp4Path string, createdAt time.Time) (string, error) {
+	metadata := &ClipMetadata{HasAudio: true, CreatedAt: createdAt}
+	for _, f := range pcmFiles {
+		metadata.AudioTracks = append(metadata.AudioTracks, f.label)
+	}
+
+	absTs, _ := filepath.Abs(tsPath)
+	args := []string{"-y", "-i", absTs}
+	audio := DefaultAudioSettings()
+	audio.Mix = len(pcmFiles) > 1
+	inputs, output := s.audioMergeArgs(pcmFiles, audio)
+	args = append(append(args, inputs...), output...)
+	args = append(args, metadataArgs(metadata)...)
+	mp4Path, err := s.runToFile(args, mp4Path)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.writeMetadata(MetadataPath(mp4Path), metadata); err != nil {
+		slog.Warn("failed to save metadata", "error", err)
+	}
+	return mp4Path, nil
+}
+
+func removeLegacyFiles(tsPath string, pcmFiles []pcmFile) {
+	os.Remove(tsPath)
+	for _, f := range pcmFiles {
+		os.Remove(f.path)
+	}
+}
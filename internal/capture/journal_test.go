@@ -0,0 +1,81 @@
+package capture
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLegacyPCMFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"clip_1.ts", "clip_1.pcm", "clip_1_mic.pcm", "clip_1_system.pcm",
+		"clip_1_2.ts", "clip_1_2.pcm", "clip_1_2_mic.pcm",
+		"clip_1_notes.pcm",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		base string
+		want []pcmFile
+	}{
+		{"clip_1", []pcmFile{
+			{label: MixedTrackLabel, path: filepath.Join(dir, "clip_1.pcm")},
+			{label: "Mic", path: filepath.Join(dir, "clip_1_mic.pcm")},
+			{label: "System", path: filepath.Join(dir, "clip_1_system.pcm")},
+		}},
+		{"clip_1_2", []pcmFile{
+			{label: MixedTrackLabel, path: filepath.Join(dir, "clip_1_2.pcm")},
+			{label: "Mic", path: filepath.Join(dir, "clip_1_2_mic.pcm")},
+		}},
+		{"clip_3", nil},
+	}
+
+	for _, tt := range tests {
+		if got := legacyPCMFiles(dir, tt.base); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("legacyPCMFiles(%q) = %v, want %v", tt.base, got, tt.want)
+		}
+	}
+}
+
+func TestRecoverLegacyKeepsForeignPartFiles(t *testing.T) {
+	dir := t.TempDir()
+	raw := filepath.Join(dir, "games", "clip_2")
+	if err := os.MkdirAll(raw, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]bool{ // name: removed by recovery
+		"clip_1.mp4" + partSuffix:                      true,
+		"clip_1.mp4.json" + partSuffix:                 true,
+		"games/clip_2/" + rawMetadataFile + partSuffix: true,
+		"holiday.mkv" + partSuffix:                     false,
+		"setup.exe" + partSuffix:                       false,
+		"notes" + partSuffix:                           false,
+		"clip_3.mp4":                                   false,
+	}
+	for name := range files {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewSaver("", dir)
+	report := &RecoveryReport{}
+	s.recoverLegacy(time.Now().Add(time.Minute), report)
+
+	for name, removed := range files {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if gone := os.IsNotExist(err); gone != removed {
+			t.Errorf("%s removed = %v, want %v", name, gone, removed)
+		}
+	}
+	if report.Discarded != 3 {
+		t.Errorf("discarded = %d, want 3", report.Discarded)
+	}
+}
@@ -0,0 +1,145 @@
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	hiddenexec "rewind/internal/utils"
+)
+
+const (
+	loudnessTruePeak = -1.5
+	loudnessRange    = 11
+)
+
+// loudnessStats is what the first loudnorm pass measures
+type loudnessStats struct {
+	InputI      string `json:"input_i"`
+	InputTP     string `json:"input_tp"`
+	InputLRA    string `json:"input_lra"`
+	InputThresh string `json:"input_thresh"`
+	Offset      string `json:"target_offset"`
+}
+
+// firstPassFilter is the measuring loudnorm filter
+func firstPassFilter(target float64) string {
+	return fmt.Sprintf("loudnorm=I=%s:TP=%s:LRA=%d:print_format=json",
+		formatSeconds(target), formatSeconds(loudnessTruePeak), loudnessRange)
+}
+
+// secondPass returns the loudnorm filter that applies the measurement
+// linearly, so dynamics are kept
+func (m *loudnessStats) secondPass(target float64) string {
+	return fmt.Sprintf("loudnorm=I=%s:TP=%s:LRA=%d:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+		formatSeconds(target), formatSeconds(loudnessTruePeak), loudnessRange,
+		m.InputI, m.InputTP, m.InputLRA, m.InputThresh, m.Offset)
+}
+
+// measureLoudness runs the first loudnorm pass over the first audio stream
+// of the given input
+func (s *Saver) measureLoudness(inputArgs []string, audio AudioSettings) (*loudnessStats, error) {
+	return s.measureFiltered(inputArgs, "[0:a:0]", audio.TargetLUFS)
+}
+
+// measureFiltered measures the output of a filter graph prefix. graph is
+// either an input pad like "[0:a:0]" or a graph ending in an unlabeled
+// output.
+func (s *Saver) measureFiltered(inputArgs []string, graph string, target float64) (*loudnessStats, error) {
+	sep := ""
+	if !strings.HasSuffix(graph, "]") {
+		sep = ","
+	}
+
+	args := append([]string{"-hide_banner", "-nostats"}, inputArgs...)
+	args = append(args, "-filter_complex", graph+sep+firstPassFilter(target), "-f", "null", "-")
+
+	out, err := hiddenexec.Command(s.ffmpegPath, args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, lastLines(string(out), 2))
+	}
+
+	// The JSON block is the last thing loudnorm prints
+	text := string(out)
+	start := strings.LastIndex(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no loudnorm output")
+	}
+
+	var m loudnessStats
+	if err := json.Unmarshal([]byte(text[start:end+1]), &m); err != nil {
+		return nil, fmt.Errorf("invalid loudnorm output: %w", err)
+	}
+	if m.InputI == "" || m.InputI == "-inf" {
+		return nil, fmt.Errorf("track is silent")
+	}
+	return &m, nil
+}
+
+// audioStreamTitles returns the titles of the audio streams of a clip, in
+// stream order
+func (s *Saver) audioStreamTitles(path string) ([]string, error) {
+	info, err := s.Probe(path)
+	if err != nil {
+		return nil, err
+	}
+	return info.AudioTitles, nil
+}
+
+// exportAudioArgs returns filter and map args that apply per-track gains
+// and two-pass loudness normalization to a clip's audio, mixing separate
+// tracks into one. It returns nil when the audio can be used as is.
+func (s *Saver) exportAudioArgs(absIn string, audio *AudioSettings) ([]string, error) {
+	if audio == nil || (!audio.Normalize && len(audio.Gains) == 0) {
+		return nil, nil
+	}
+
+	titles, err := s.audioStreamTitles(absIn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audio streams: %w", err)
+	}
+	if len(titles) == 0 {
+		return nil, nil
+	}
+
+	// Work from the separate tracks; the pre-mixed track is rebuilt
+	var streams []int
+	for i, title := range titles {
+		if title != MixedTrackLabel {
+			streams = append(streams, i)
+		}
+	}
+	if len(streams) == 0 {
+		streams = []int{0}
+	}
+
+	var parts []string
+	var inputs strings.Builder
+	for n, i := range streams {
+		chain := fmt.Sprintf("[0:a:%d]anull", i)
+		if gain := audio.Gains[titles[i]]; gain != 0 {
+			chain = fmt.Sprintf("[0:a:%d]volume=%sdB", i, formatSeconds(gain))
+		}
+		parts = append(parts, fmt.Sprintf("%s[e%d]", chain, n))
+		fmt.Fprintf(&inputs, "[e%d]", n)
+	}
+	if len(streams) > 1 {
+		parts = append(parts, fmt.Sprintf("%samix=inputs=%d:duration=longest:normalize=0", inputs.String(), len(streams)))
+	} else {
+		parts = append(parts, "[e0]anull")
+	}
+	graph := strings.Join(parts, ";")
+
+	if audio.Normalize {
+		m, err := s.measureFiltered([]string{"-i", absIn}, graph, audio.TargetLUFS)
+		if err != nil {
+			slog.Warn("loudness measurement failed, exporting without normalization", "error", err)
+		} else {
+			graph += "," + m.secondPass(audio.TargetLUFS) + ",aresample=48000"
+		}
+	}
+
+	return []string{"-filter_complex", graph + "[aout]", "-map", "0:v:0", "-map", "[aout]"}, nil
+}
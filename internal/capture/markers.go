@@ -0,0 +1,124 @@
+package capture
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxChapters is the most chapters an MP4 chapter list holds
+const maxChapters = 255
+
+// Marker flags a moment of the recording, with an optional label
+type Marker struct {
+	Time  time.Time `json:"time"`
+	Label string    `json:"label,omitempty"`
+}
+
+// Chapter is a marker placed on the timeline of a saved clip
+type Chapter struct {
+	StartSec float64 `json:"startSec"` // from the start of the clip
+	Title    string  `json:"title"`
+}
+
+// clipChapters returns the markers inside the clip that ends at end as
+// chapters. The clip covers durationSec seconds but never starts before
+// recordingStart.
+func clipChapters(markers []Marker, end, recordingStart time.Time, durationSec int) []Chapter {
+	start := recordingStart
+	if durationSec > 0 {
+		if s := end.Add(-time.Duration(durationSec) * time.Second); s.After(start) {
+			start = s
+		}
+	}
+
+	var chapters []Chapter
+	for _, m := range markers {
+		if m.Time.Before(start) || m.Time.After(end) {
+			continue
+		}
+		if len(chapters) == maxChapters {
+			break
+		}
+
+		title := strings.TrimSpace(m.Label)
+		if title == "" {
+			title = fmt.Sprintf("Marker %d", len(chapters)+1)
+		}
+		offset := m.Time.Sub(start).Seconds()
+		chapters = append(chapters, Chapter{StartSec: math.Round(offset*1000) / 1000, Title: title})
+	}
+	return chapters
+}
+
+// addChapters stores the markers inside the clip that ends at end in the
+// clip metadata
+func (o *SaveOptions) addChapters(end time.Time) {
+	if o.Markers == nil {
+		return
+	}
+
+	chapters := clipChapters(o.Markers(), end, o.RecordingStart, o.DurationSec)
+	if len(chapters) == 0 {
+		return
+	}
+	if o.Metadata == nil {
+		o.Metadata = &ClipMetadata{}
+	}
+	o.Metadata.Chapters = chapters
+}
+
+// writeChapterFile writes the chapters of m as an ffmpeg metadata file and
+// returns its path, or "" if there are none. Each chapter lasts until the
+// next one, the last until the end of the clip.
+func writeChapterFile(m *ClipMetadata) (string, error) {
+	if m == nil || len(m.Chapters) == 0 {
+		return "", nil
+	}
+
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for i, c := range m.Chapters {
+		start := int64(c.StartSec * 1000)
+		end := start + 1
+		if i+1 < len(m.Chapters) {
+			end = int64(m.Chapters[i+1].StartSec * 1000)
+		} else if m.DurationSec > 0 {
+			end = int64(m.DurationSec) * 1000
+		}
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n", start, max(end, start+1), escapeFFMetadata(c.Title))
+	}
+
+	f, err := os.CreateTemp("", "rewind-chapters-*.txt")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// escapeFFMetadata escapes the characters the ffmetadata format reserves
+func escapeFFMetadata(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '=', ';', '#', '\\':
+			b.WriteByte('\\')
+		case '\n', '\r':
+			b.WriteByte(' ')
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,168 @@
+package capture
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClipChapters(t *testing.T) {
+	t0 := time.Date(2024, 3, 5, 14, 0, 0, 0, time.UTC)
+	at := func(sec float64) time.Time { return t0.Add(time.Duration(sec * float64(time.Second))) }
+
+	markers := []Marker{
+		{Time: at(10)},
+		{Time: at(30)},
+		{Time: at(45.5), Label: "  Clutch  "},
+		{Time: at(51.23456)},
+		{Time: at(60)},
+		{Time: at(61), Label: "after"},
+	}
+
+	many := make([]Marker, 300)
+	for i := range many {
+		many[i] = Marker{Time: at(float64(i) / 10), Label: "m"}
+	}
+
+	tests := []struct {
+		name           string
+		markers        []Marker
+		end            time.Time
+		recordingStart time.Time
+		durationSec    int
+		want           []Chapter
+	}{
+		{
+			name:           "markers inside the clip",
+			markers:        markers,
+			end:            at(60),
+			recordingStart: t0,
+			durationSec:    30,
+			want: []Chapter{
+				{StartSec: 0, Title: "Marker 1"},
+				{StartSec: 15.5, Title: "Clutch"},
+				{StartSec: 21.235, Title: "Marker 3"},
+				{StartSec: 30, Title: "Marker 4"},
+			},
+		},
+		{
+			name:           "no duration starts at the recording",
+			markers:        markers[:3],
+			end:            at(60),
+			recordingStart: at(20),
+			want: []Chapter{
+				{StartSec: 10, Title: "Marker 1"},
+				{StartSec: 25.5, Title: "Clutch"},
+			},
+		},
+		{
+			name:           "clip longer than the recording",
+			markers:        markers,
+			end:            at(60),
+			recordingStart: at(50),
+			durationSec:    120,
+			want: []Chapter{
+				{StartSec: 1.235, Title: "Marker 1"},
+				{StartSec: 10, Title: "Marker 2"},
+			},
+		},
+		{
+			name:           "none inside",
+			markers:        markers,
+			end:            at(5),
+			recordingStart: t0,
+			durationSec:    5,
+		},
+		{
+			name:           "capped",
+			markers:        many,
+			end:            at(60),
+			recordingStart: t0,
+			want: func() []Chapter {
+				c := make([]Chapter, maxChapters)
+				for i := range c {
+					c[i] = Chapter{StartSec: float64(i) / 10, Title: "m"}
+				}
+				return c
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := clipChapters(tt.markers, tt.end, tt.recordingStart, tt.durationSec)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("clipChapters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteChapterFile(t *testing.T) {
+	tests := []struct {
+		name string
+		meta *ClipMetadata
+		want string // "" for no file
+	}{
+		{name: "nil metadata"},
+		{name: "no chapters", meta: &ClipMetadata{DurationSec: 30}},
+		{
+			name: "last chapter runs to the end",
+			meta: &ClipMetadata{DurationSec: 30, Chapters: []Chapter{{0, "Intro"}, {12.5, "a=b;c"}}},
+			want: ";FFMETADATA1\n" +
+				"[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=12500\ntitle=Intro\n" +
+				"[CHAPTER]\nTIMEBASE=1/1000\nSTART=12500\nEND=30000\ntitle=a\\=b\\;c\n",
+		},
+		{
+			name: "unknown duration and duplicate starts",
+			meta: &ClipMetadata{Chapters: []Chapter{{1, "one"}, {1, "two"}}},
+			want: ";FFMETADATA1\n" +
+				"[CHAPTER]\nTIMEBASE=1/1000\nSTART=1000\nEND=1001\ntitle=one\n" +
+				"[CHAPTER]\nTIMEBASE=1/1000\nSTART=1000\nEND=1001\ntitle=two\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := writeChapterFile(tt.meta)
+			if err != nil {
+				t.Fatalf("writeChapterFile() error = %v", err)
+			}
+			if tt.want == "" {
+				if path != "" {
+					os.Remove(path)
+					t.Fatalf("writeChapterFile() = %q, want no file", path)
+				}
+				return
+			}
+			defer os.Remove(path)
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("chapter file =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapeFFMetadata(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"a=b", `a\=b`},
+		{`;#\`, `\;\#\\`},
+		{"two\nlines\r", "two lines "},
+		{"Überraschung ☺", "Überraschung ☺"},
+	}
+
+	for _, tt := range tests {
+		if got := escapeFFMetadata(tt.in); got != tt.want {
+			t.Errorf("escapeFFMetadata(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"rewind/internal/utils"
+)
+
+// rawMetadataFile is the metadata file inside a raw clip folder
+const rawMetadataFile = "metadata.json"
+
+// ClipMetadata describes how a clip was recorded. It is stored in
+// metadata.json inside raw folders, and as a <file>.json sidecar plus MP4
+// tags for converted clips. The window title is only kept in the JSON.
+type ClipMetadata struct {
+	DurationSec int       `json:"durationSec"`
+	HasAudio    bool      `json:"hasAudio"`
+	CreatedAt   time.Time `json:"createdAt"`
+
+	// Video
+	Encoder string `json:"encoder,omitempty"`
+	Codec   string `json:"codec,omitempty"`
+	Width   int    `json:"width,omitempty"`
+	Height  int    `json:"height,omitempty"`
+	FPS     int    `json:"fps,omitempty"`
+	Bitrate string `json:"bitrate,omitempty"`
+	Display string `json:"display,omitempty"`
+
+	// Audio
+	AudioTracks       []string `json:"audioTracks,omitempty"` // labels, in file order
+	MicrophoneDevice  string   `json:"microphoneDevice,omitempty"`
+	MicVolume         int      `json:"micVolume,omitempty"`
+	SystemAudioDevice string   `json:"systemAudioDevice,omitempty"`
+	SysVolume         int      `json:"sysVolume,omitempty"`
+
+	// Health is the result of the last verification, nil = not verified
+	Health *Health `json:"health,omitempty"`
+
+	// Library flags; favorite or locked clips are kept by retention
+	Favorite bool `json:"favorite,omitempty"`
+	Locked   bool `json:"locked,omitempty"`
+
+	// User annotations, searchable in the library
+	Title string   `json:"title,omitempty"`
+	Notes string   `json:"notes,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+
+	// Chapters are the markers dropped while the clip was recorded
+	Chapters []Chapter `json:"chapters,omitempty"`
+
+	// Sources are the clips a highlight reel was made from, relative to the
+	// output dir with forward slashes. Clips from elsewhere are absolute.
+	Sources []string `json:"sources,omitempty"`
+
+	// Context
+	AppVersion    string `json:"appVersion,omitempty"`
+	ForegroundApp string `json:"foregroundApp,omitempty"`
+	WindowTitle   string `json:"windowTitle,omitempty"`
+}
+
+// MetadataPath returns where the metadata of a clip is stored
+func MetadataPath(clipPath string) string {
+	if info, err := os.Stat(clipPath); err == nil && info.IsDir() {
+		return filepath.Join(clipPath, rawMetadataFile)
+	}
+	return clipPath + ".json"
+}
+
+func (s *Saver) writeMetadata(path string, metadata *ClipMetadata) error {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(path, data)
+}
+
+// ReadMetadata reads the metadata of a raw clip folder or of a converted
+// clip's JSON sidecar
+func ReadMetadata(clipPath string) (*ClipMetadata, error) {
+	data, err := os.ReadFile(MetadataPath(clipPath))
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata ClipMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
+
+// UpdateMetadata changes the stored metadata of a clip. Clips without
+// metadata get a new sidecar.
+func UpdateMetadata(clipPath string, update func(*ClipMetadata)) error {
+	metadata, err := ReadMetadata(clipPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		metadata = &ClipMetadata{}
+		if info, err := os.Stat(clipPath); err == nil {
+			metadata.CreatedAt = info.ModTime()
+		}
+	}
+
+	update(metadata)
+
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(MetadataPath(clipPath), data)
+}
+
+// metadataTags returns the metadata as key/value pairs for MP4 tags. The
+// window title stays in the sidecar, since it often names private chats,
+// documents or tabs and the file may be shared.
+func metadataTags(m *ClipMetadata) [][2]string {
+	all := [][2]string{
+		{"rewind_version", m.AppVersion},
+		{"rewind_encoder", m.Encoder},
+		{"rewind_codec", m.Codec},
+		{"rewind_resolution", fmt.Sprintf("%dx%d", m.Width, m.Height)},
+		{"rewind_fps", strconv.Itoa(m.FPS)},
+		{"rewind_bitrate", m.Bitrate},
+		{"rewind_display", m.Display},
+	}
+	if m.MicrophoneDevice != "" {
+		all = append(all,
+			[2]string{"rewind_mic", m.MicrophoneDevice},
+			[2]string{"rewind_mic_volume", strconv.Itoa(m.MicVolume)})
+	}
+	if m.SystemAudioDevice != "" {
+		all = append(all,
+			[2]string{"rewind_system_audio", m.SystemAudioDevice},
+			[2]string{"rewind_system_volume", strconv.Itoa(m.SysVolume)})
+	}
+	all = append(all,
+		[2]string{"rewind_app", m.ForegroundApp},
+		[2]string{"rewind_sources", strings.Join(m.Sources, "; ")})
+
+	var tags [][2]string
+	for _, t := range all {
+		if t[1] != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// metadataArgs returns ffmpeg output args embedding the metadata as MP4
+// tags. ffmpeg keeps only the last -movflags, so other flags the output
+// needs are passed in.
+func metadataArgs(m *ClipMetadata, movflags ...string) []string {
+	if m == nil {
+		return nil
+	}
+
+	args := []string{
+		"-movflags", "+" + strings.Join(append(movflags, "use_metadata_tags"), "+"),
+		"-metadata", "creation_time=" + m.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	for _, t := range metadataTags(m) {
+		args = append(args, "-metadata", t[0]+"="+t[1])
+	}
+	return args
+}
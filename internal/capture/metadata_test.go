@@ -0,0 +1,80 @@
+package capture
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMetadataTags(t *testing.T) {
+	base := ClipMetadata{
+		AppVersion:    "1.2.0",
+		Width:         1920,
+		Height:        1080,
+		FPS:           60,
+		ForegroundApp: "game.exe",
+		WindowTitle:   "Chat with Alex - Messenger",
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*ClipMetadata)
+		want   [][2]string
+	}{
+		{
+			name: "no audio devices",
+			want: [][2]string{
+				{"rewind_version", "1.2.0"},
+				{"rewind_resolution", "1920x1080"},
+				{"rewind_fps", "60"},
+				{"rewind_app", "game.exe"},
+			},
+		},
+		{
+			name: "microphone only",
+			modify: func(m *ClipMetadata) {
+				m.MicrophoneDevice = "Headset"
+				m.MicVolume = 80
+				m.SysVolume = 100
+			},
+			want: [][2]string{
+				{"rewind_version", "1.2.0"},
+				{"rewind_resolution", "1920x1080"},
+				{"rewind_fps", "60"},
+				{"rewind_mic", "Headset"},
+				{"rewind_mic_volume", "80"},
+				{"rewind_app", "game.exe"},
+			},
+		},
+		{
+			name: "both devices",
+			modify: func(m *ClipMetadata) {
+				m.MicrophoneDevice = "Headset"
+				m.MicVolume = 80
+				m.SystemAudioDevice = "Speakers"
+				m.SysVolume = 0
+			},
+			want: [][2]string{
+				{"rewind_version", "1.2.0"},
+				{"rewind_resolution", "1920x1080"},
+				{"rewind_fps", "60"},
+				{"rewind_mic", "Headset"},
+				{"rewind_mic_volume", "80"},
+				{"rewind_system_audio", "Speakers"},
+				{"rewind_system_volume", "0"},
+				{"rewind_app", "game.exe"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := base
+			if tt.modify != nil {
+				tt.modify(&m)
+			}
+			if got := metadataTags(&m); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("metadataTags() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package capture
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultFilenameTemplate produces the classic clip_20060102_150405 names
+	DefaultFilenameTemplate = "clip_{date}_{time}"
+
+	maxNameLength = 100
+)
+
+// NameFields are the values filename and folder templates can refer to
+type NameFields struct {
+	Time    time.Time
+	Display string
+	Encoder string
+	App     string
+	Profile string
+}
+
+var templateTokenRe = regexp.MustCompile(`\{([a-z-]+)\}`)
+
+// templateTokens expand to sanitized values; {counter} is handled by ClipName
+var templateTokens = map[string]func(NameFields) string{
+	"date":    func(f NameFields) string { return f.Time.Format("20060102") },
+	"time":    func(f NameFields) string { return f.Time.Format("150405") },
+	"yyyy":    func(f NameFields) string { return f.Time.Format("2006") },
+	"mm":      func(f NameFields) string { return f.Time.Format("01") },
+	"dd":      func(f NameFields) string { return f.Time.Format("02") },
+	"yyyy-mm": func(f NameFields) string { return f.Time.Format("2006-01") },
+	"display": func(f NameFields) string { return f.Display },
+	"encoder": func(f NameFields) string { return f.Encoder },
+	"app":     func(f NameFields) string { return f.App },
+	"profile": func(f NameFields) string { return f.Profile },
+}
+
+// ValidateTemplate checks that a template only uses known tokens. Folder
+// templates may contain "/" to nest folders; filename templates may not.
+func ValidateTemplate(tmpl string, folder bool) error {
+	if !folder && strings.TrimSpace(tmpl) == "" {
+		return fmt.Errorf("filename template must not be empty")
+	}
+	if !folder && strings.ContainsAny(tmpl, `/\`) {
+		return fmt.Errorf("filename template must not contain path separators")
+	}
+	if folder && strings.Contains(tmpl, "{counter}") {
+		return fmt.Errorf("{counter} can only be used in the filename template")
+	}
+
+	for _, m := range templateTokenRe.FindAllStringSubmatch(tmpl, -1) {
+		if _, ok := templateTokens[m[1]]; !ok && m[1] != "counter" {
+			return fmt.Errorf("unknown template token: %s", m[0])
+		}
+	}
+	return nil
+}
+
+// expandTemplate replaces the tokens of tmpl; values are sanitized so they
+// can't introduce path separators
+func expandTemplate(tmpl string, f NameFields, counter int) string {
+	return templateTokenRe.ReplaceAllStringFunc(tmpl, func(tok string) string {
+		name := tok[1 : len(tok)-1]
+		if name == "counter" {
+			return strconv.Itoa(counter)
+		}
+		expand, ok := templateTokens[name]
+		if !ok {
+			return tok
+		}
+		value := SanitizeName(expand(f))
+		if value == "" {
+			return "unknown"
+		}
+		return value
+	})
+}
+
+// ClipName expands the templates into a clip path relative to the output
+// dir, without extension. The name doesn't collide with an existing clip,
+// raw folder or save in progress, and stays reserved until its save ends
+// or ReleaseName is called.
+func (s *Saver) ClipName(fileTmpl, folderTmpl string, f NameFields) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if fileTmpl == "" {
+		fileTmpl = DefaultFilenameTemplate
+	}
+
+	var folder string
+	for _, part := range strings.FieldsFunc(expandTemplate(folderTmpl, f, 0), isPathSeparator) {
+		if part = SanitizeName(part); part != "" {
+			folder = filepath.Join(folder, part)
+		}
+	}
+
+	// Templates with {counter} count up from 1, others get a suffix when taken
+	hasCounter := strings.Contains(fileTmpl, "{counter}")
+	for n := 1; ; n++ {
+		name := SanitizeName(expandTemplate(fileTmpl, f, n))
+		if name == "" {
+			name = "clip"
+		}
+		if !hasCounter && n > 1 {
+			name = fmt.Sprintf("%s_%d", name, n)
+		}
+
+		rel := filepath.Join(folder, name)
+		if !s.reserved[reservationKey(rel)] && !s.nameTaken(rel) {
+			if s.reserved == nil {
+				s.reserved = make(map[string]bool)
+			}
+			s.reserved[reservationKey(rel)] = true
+			return rel
+		}
+	}
+}
+
+// ReleaseName frees a name reserved by ClipName whose save never started
+// or has finished
+func (s *Saver) ReleaseName(rel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reserved, reservationKey(rel))
+}
+
+// reservationKey folds case, names differing only in case are the same
+// file on Windows
+func reservationKey(rel string) string {
+	return strings.ToLower(filepath.Clean(rel))
+}
+
+// nameTaken reports whether any output of a save named rel already exists
+func (s *Saver) nameTaken(rel string) bool {
+	base := filepath.Join(s.outputDir, rel)
+	for _, p := range []string{
+		base,
+		base + ".mp4",
+		base + ".mp4" + partSuffix,
+		s.inflightDir(rel),
+	} {
+		if _, err := os.Stat(p); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// inflightDir returns the in-flight folder of a save; nested names are
+// flattened so recovery only has to look one level deep
+func (s *Saver) inflightDir(rel string) string {
+	flat := strings.Join(strings.FieldsFunc(rel, isPathSeparator), "_")
+	return filepath.Join(s.outputDir, InflightDirName, flat)
+}
+
+func isPathSeparator(r rune) bool {
+	return r == '/' || r == '\\'
+}
+
+// SanitizeName makes s safe as a single file name on Windows and Linux
+func SanitizeName(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r < 32, strings.ContainsRune(`<>:"/\|?*`, r):
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	name := strings.Trim(b.String(), " .")
+	if runes := []rune(name); len(runes) > maxNameLength {
+		name = strings.TrimRight(string(runes[:maxNameLength]), " .")
+	}
+
+	// Reserved device names can't be used as file names on Windows
+	stem, _, _ := strings.Cut(name, ".")
+	switch strings.ToUpper(stem) {
+	case "CON", "PRN", "AUX", "NUL",
+		"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+		"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9":
+		name = "_" + name
+	}
+	return name
+}
@@ -0,0 +1,191 @@
+package capture
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    string
+		folder  bool
+		wantErr bool
+	}{
+		{name: "default", tmpl: DefaultFilenameTemplate},
+		{name: "counter", tmpl: "{app}_{counter}"},
+		{name: "literal text", tmpl: "highlight"},
+		{name: "uppercase braces are literal", tmpl: "{Date}"},
+		{name: "empty filename", tmpl: "", wantErr: true},
+		{name: "blank filename", tmpl: "   ", wantErr: true},
+		{name: "slash in filename", tmpl: "{app}/{date}", wantErr: true},
+		{name: "backslash in filename", tmpl: `{app}\{date}`, wantErr: true},
+		{name: "unknown token", tmpl: "{game}_{date}", wantErr: true},
+		{name: "empty folder", tmpl: "", folder: true},
+		{name: "nested folder", tmpl: "{app}/{yyyy-mm}", folder: true},
+		{name: "backslash folder", tmpl: `{yyyy}\{mm}`, folder: true},
+		{name: "counter in folder", tmpl: "{app}/{counter}", folder: true, wantErr: true},
+		{name: "unknown token in folder", tmpl: "{year}", folder: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTemplate(tt.tmpl, tt.folder)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTemplate(%q, %v) error = %v, wantErr %v", tt.tmpl, tt.folder, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Portal 2", "Portal 2"},
+		{"", ""},
+		{`a<b>c:d"e/f\g|h?i*j`, "a_b_c_d_e_f_g_h_i_j"},
+		{"tab\there", "tab_here"},
+		{"  .hidden. ", "hidden"},
+		{"..", ""},
+		{"CON", "_CON"},
+		{"com1.txt", "_com1.txt"},
+		{"Lpt9", "_Lpt9"},
+		{"CONSOLE", "CONSOLE"},
+		{strings.Repeat("ab", 60), strings.Repeat("ab", 50)},
+		{strings.Repeat("é", 150), strings.Repeat("é", 100)},
+		{strings.Repeat("a", 99) + " .b", strings.Repeat("a", 99)},
+	}
+
+	for _, tt := range tests {
+		if got := SanitizeName(tt.in); got != tt.want {
+			t.Errorf("SanitizeName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestClipName(t *testing.T) {
+	fields := NameFields{
+		Time:    time.Date(2024, 3, 5, 14, 7, 9, 0, time.Local),
+		Display: `\\.\DISPLAY1`,
+		Encoder: "h264_nvenc",
+		App:     "Half-Life: Alyx",
+	}
+
+	tests := []struct {
+		name       string
+		fileTmpl   string
+		folderTmpl string
+		fields     NameFields
+		existing   []string // relative paths created before naming
+		inflight   []string // names with a save in progress
+		want       string
+	}{
+		{
+			name:   "default template",
+			fields: fields,
+			want:   "clip_20240305_140709",
+		},
+		{
+			name:       "nested folder",
+			fileTmpl:   "{app}_{time}",
+			folderTmpl: "{app}/{yyyy-mm}",
+			fields:     fields,
+			want:       filepath.Join("Half-Life_ Alyx", "2024-03", "Half-Life_ Alyx_140709"),
+		},
+		{
+			name:       "folder can't climb out",
+			folderTmpl: "../{encoder}/./",
+			fields:     fields,
+			want:       filepath.Join("h264_nvenc", "clip_20240305_140709"),
+		},
+		{
+			name:     "separators in values",
+			fileTmpl: "{display}",
+			fields:   fields,
+			want:     "__._DISPLAY1",
+		},
+		{
+			name:     "empty values",
+			fileTmpl: "{app}_{profile}",
+			fields:   NameFields{Time: fields.Time},
+			want:     "unknown_unknown",
+		},
+		{
+			name:     "suffix when taken",
+			fields:   fields,
+			existing: []string{"clip_20240305_140709.mp4", "clip_20240305_140709_2"},
+			inflight: []string{"clip_20240305_140709_3"},
+			want:     "clip_20240305_140709_4",
+		},
+		{
+			name:     "partial file counts as taken",
+			fields:   fields,
+			existing: []string{"clip_20240305_140709.mp4" + partSuffix},
+			want:     "clip_20240305_140709_2",
+		},
+		{
+			name:     "counter counts up",
+			fileTmpl: "take_{counter}",
+			fields:   fields,
+			existing: []string{"take_1.mp4", "take_2.mp4"},
+			want:     "take_3",
+		},
+		{
+			name:       "counter per folder",
+			fileTmpl:   "take_{counter}",
+			folderTmpl: "{yyyy}",
+			fields:     fields,
+			existing:   []string{"take_1.mp4"},
+			want:       filepath.Join("2024", "take_1"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Saver{outputDir: t.TempDir()}
+			for _, rel := range tt.existing {
+				p := filepath.Join(s.outputDir, rel)
+				if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, rel := range tt.inflight {
+				if err := os.MkdirAll(s.inflightDir(rel), 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := s.ClipName(tt.fileTmpl, tt.folderTmpl, tt.fields); got != tt.want {
+				t.Errorf("ClipName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClipNameReserves(t *testing.T) {
+	s := &Saver{outputDir: t.TempDir()}
+	f := NameFields{Time: time.Date(2024, 3, 5, 14, 7, 9, 0, time.Local)}
+
+	first := s.ClipName("", "", f)
+	second := s.ClipName("", "", f)
+	if first == second {
+		t.Fatalf("ClipName() handed out %q twice", first)
+	}
+
+	// Names differing only in case are the same file on Windows
+	if got := s.ClipName("CLIP_{date}_{time}", "", f); got != "CLIP_20240305_140709_3" {
+		t.Errorf("ClipName() = %q, want CLIP_20240305_140709_3", got)
+	}
+
+	s.ReleaseName(first)
+	if got := s.ClipName("", "", f); got != first {
+		t.Errorf("ClipName() after release = %q, want %q", got, first)
+	}
+}
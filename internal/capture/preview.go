@@ -0,0 +1,226 @@
+package capture
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	hiddenexec "rewind/internal/utils"
+)
+
+const (
+	// PreviewDirName is the sidecar directory inside the output dir
+	PreviewDirName = ".previews"
+
+	posterFile = "poster.jpg"
+	spriteFile = "sprite.jpg"
+	indexFile  = "sprite.vtt"
+
+	posterWidth  = 480
+	spriteWidth  = 160
+	spriteCols   = 5
+	spriteRows   = 5
+	spriteFrames = spriteCols * spriteRows
+)
+
+// Previews holds the sidecar image paths of a clip
+type Previews struct {
+	Poster string `json:"poster"`
+	Sprite string `json:"sprite"`
+	Index  string `json:"index"`
+}
+
+// PreviewDir returns the sidecar directory used for a clip
+func PreviewDir(clipPath string) string {
+	return filepath.Join(filepath.Dir(clipPath), PreviewDirName, filepath.Base(clipPath))
+}
+
+// CachedPreviews returns the previews of a clip if they were already generated
+func CachedPreviews(clipPath string) (*Previews, bool) {
+	dir := PreviewDir(clipPath)
+	p := &Previews{
+		Poster: filepath.Join(dir, posterFile),
+		Sprite: filepath.Join(dir, spriteFile),
+		Index:  filepath.Join(dir, indexFile),
+	}
+	for _, f := range []string{p.Poster, p.Sprite, p.Index} {
+		if _, err := os.Stat(f); err != nil {
+			return nil, false
+		}
+	}
+	return p, true
+}
+
+// previewSource returns the video file to read frames from. Raw clip
+// folders keep their video in video.ts.
+func previewSource(clipPath string) string {
+	if info, err := os.Stat(clipPath); err == nil && info.IsDir() {
+		return filepath.Join(clipPath, "video.ts")
+	}
+	return clipPath
+}
+
+// GeneratePreviews renders a poster thumbnail and a sprite sheet with a
+// WebVTT index for a clip into its sidecar directory.
+func (s *Saver) GeneratePreviews(clipPath string) (*Previews, error) {
+	src := previewSource(clipPath)
+
+	info, err := s.Probe(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe clip: %w", err)
+	}
+	if info.Width == 0 || info.Height == 0 || info.Duration <= 0 {
+		return nil, fmt.Errorf("clip has no video stream")
+	}
+
+	dir := PreviewDir(clipPath)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	p := &Previews{
+		Poster: filepath.Join(dir, posterFile),
+		Sprite: filepath.Join(dir, spriteFile),
+		Index:  filepath.Join(dir, indexFile),
+	}
+
+	// Poster from a third into the clip, usually past any fade-in
+	posterAt := info.Duration / 3
+	args := []string{"-y",
+		"-ss", formatSeconds(posterAt.Seconds()),
+		"-i", src,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=%d:-2", posterWidth),
+		"-q:v", "3",
+		p.Poster,
+	}
+	if err := hiddenexec.Command(s.ffmpegPath, args...).Run(); err != nil {
+		return nil, fmt.Errorf("poster generation failed: %w", err)
+	}
+
+	// Sprite sheet with frames spread evenly over the whole clip
+	tileW := spriteWidth
+	tileH := (spriteWidth * info.Height / info.Width) &^ 1
+	rate := float64(spriteFrames) / info.Duration.Seconds()
+	args = []string{"-y",
+		"-i", src,
+		"-vf", fmt.Sprintf("fps=%s,scale=%d:%d,tile=%dx%d", formatSeconds(rate), tileW, tileH, spriteCols, spriteRows),
+		"-frames:v", "1",
+		"-q:v", "5",
+		p.Sprite,
+	}
+	if err := hiddenexec.Command(s.ffmpegPath, args...).Run(); err != nil {
+		return nil, fmt.Errorf("sprite generation failed: %w", err)
+	}
+
+	if err := writeSpriteIndex(p.Index, spriteFile, info.Duration, tileW, tileH); err != nil {
+		return nil, fmt.Errorf("sprite index failed: %w", err)
+	}
+
+	slog.Info("previews generated", "clip", clipPath)
+	return p, nil
+}
+
+// writeSpriteIndex writes a WebVTT file mapping time ranges to tiles
+func writeSpriteIndex(path, spriteName string, duration time.Duration, tileW, tileH int) error {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+
+	step := duration / spriteFrames
+	for i := 0; i < spriteFrames; i++ {
+		start := step * time.Duration(i)
+		end := start + step
+		x := (i % spriteCols) * tileW
+		y := (i / spriteCols) * tileH
+		fmt.Fprintf(&b, "%s --> %s\n%s#xywh=%d,%d,%d,%d\n\n",
+			vttTime(start), vttTime(end), spriteName, x, y, tileW, tileH)
+	}
+
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+func vttTime(d time.Duration) string {
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	s := int(d.Seconds()) % 60
+	ms := int(d.Milliseconds()) % 1000
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", h, m, s, ms)
+}
+
+// RemovePreviews deletes the sidecar directory of a clip
+func RemovePreviews(clipPath string) {
+	os.RemoveAll(PreviewDir(clipPath))
+}
+
+// PreviewQueue generates previews in the background, one clip at a time,
+// and skips clips that are already queued.
+type PreviewQueue struct {
+	saver  *Saver
+	jobs   chan string
+	queued map[string]bool
+	failed map[string]bool
+	mu     sync.Mutex
+
+	OnDone func(clipPath string)
+}
+
+func NewPreviewQueue(ffmpegPath string) *PreviewQueue {
+	q := &PreviewQueue{
+		saver:  &Saver{ffmpegPath: ffmpegPath},
+		jobs:   make(chan string, 256),
+		queued: make(map[string]bool),
+		failed: make(map[string]bool),
+	}
+	go q.loop()
+	return q
+}
+
+// Enqueue schedules preview generation; it never blocks. Clips that
+// failed before are not retried until forgotten.
+func (q *PreviewQueue) Enqueue(clipPath string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.queued[clipPath] || q.failed[clipPath] {
+		return
+	}
+
+	select {
+	case q.jobs <- clipPath:
+		q.queued[clipPath] = true
+	default:
+		slog.Debug("preview queue full, skipping", "clip", clipPath)
+	}
+}
+
+// Forget clears the failure of a clip so Enqueue tries it again. Call it
+// when the clip is rewritten, renamed or deleted.
+func (q *PreviewQueue) Forget(clipPath string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.failed, clipPath)
+}
+
+func (q *PreviewQueue) loop() {
+	for clipPath := range q.jobs {
+		_, err := q.saver.GeneratePreviews(clipPath)
+		if err != nil {
+			slog.Warn("failed to generate previews", "clip", clipPath, "error", err)
+		}
+
+		q.mu.Lock()
+		delete(q.queued, clipPath)
+		if err != nil {
+			q.failed[clipPath] = true
+		}
+		q.mu.Unlock()
+
+		if err == nil && q.OnDone != nil {
+			q.OnDone(clipPath)
+		}
+	}
+}
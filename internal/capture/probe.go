@@ -0,0 +1,112 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	hiddenexec "rewind/internal/utils"
+)
+
+// MediaInfo is what ffmpeg reports about a media file header
+type MediaInfo struct {
+	Duration   time.Duration
+	VideoCodec string
+	Width      int
+	Height     int
+	FPS        float64
+	AudioCodec string
+	AudioCount int // number of audio streams
+
+	// AudioTitles are the title tags of the audio streams, in stream order
+	AudioTitles []string
+}
+
+var (
+	durationRe   = regexp.MustCompile(`Duration: (\d+):(\d+):(\d+(?:\.\d+)?)`)
+	videoRe      = regexp.MustCompile(`Stream #\S+.*: Video: (\w+).*?, (\d{2,5})x(\d{2,5})`)
+	fpsRe        = regexp.MustCompile(`, (\d+(?:\.\d+)?) (?:fps|tbr)`)
+	audioCodecRe = regexp.MustCompile(`Stream #\S+.*: Audio: (\w+)`)
+	streamTypeRe = regexp.MustCompile(`^\s*Stream #\S+?: (\w+):`)
+	titleTagRe   = regexp.MustCompile(`^\s*title\s*: (.*)$`)
+)
+
+// errFFmpegMissing is returned when ffmpeg itself can't be run
+var errFFmpegMissing = errors.New("ffmpeg not available")
+
+// Probe reads basic stream information of a media file
+func (s *Saver) Probe(path string) (*MediaInfo, error) {
+	cmd := hiddenexec.Command(s.ffmpegPath, "-hide_banner", "-i", path)
+	// ffmpeg exits with an error when no output is given, the header is still printed
+	out, err := cmd.CombinedOutput()
+	if err != nil && (errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist)) {
+		return nil, fmt.Errorf("%w: %v", errFFmpegMissing, err)
+	}
+	text := string(out)
+
+	m := durationRe.FindStringSubmatch(text)
+	if m == nil {
+		return nil, fmt.Errorf("duration not found")
+	}
+
+	h, _ := strconv.Atoi(m[1])
+	mins, _ := strconv.Atoi(m[2])
+	sec, _ := strconv.ParseFloat(m[3], 64)
+	total := float64(h*3600+mins*60) + sec
+
+	info := &MediaInfo{Duration: time.Duration(total * float64(time.Second))}
+
+	if v := videoRe.FindStringSubmatch(text); v != nil {
+		info.VideoCodec = v[1]
+		info.Width, _ = strconv.Atoi(v[2])
+		info.Height, _ = strconv.Atoi(v[3])
+	}
+	if f := fpsRe.FindStringSubmatch(text); f != nil {
+		info.FPS, _ = strconv.ParseFloat(f[1], 64)
+	}
+	if a := audioCodecRe.FindAllStringSubmatch(text, -1); a != nil {
+		info.AudioCodec = a[0][1]
+		info.AudioCount = len(a)
+	}
+	info.AudioTitles = audioTitles(text)
+
+	return info, nil
+}
+
+// ProbeDuration reads the container duration of a media file
+func (s *Saver) ProbeDuration(path string) (time.Duration, error) {
+	info, err := s.Probe(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Duration, nil
+}
+
+// audioTitles collects the title tags from the metadata blocks that follow
+// the audio stream lines of ffmpeg's header output
+func audioTitles(header string) []string {
+	titles := []string{}
+	inAudio := false
+	for _, line := range strings.Split(header, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if m := streamTypeRe.FindStringSubmatch(line); m != nil {
+			inAudio = m[1] == "Audio"
+			if inAudio {
+				titles = append(titles, "")
+			}
+			continue
+		}
+		if !inAudio {
+			continue
+		}
+		if m := titleTagRe.FindStringSubmatch(line); m != nil && titles[len(titles)-1] == "" {
+			titles[len(titles)-1] = strings.TrimSpace(m[1])
+		}
+	}
+	return titles
+}
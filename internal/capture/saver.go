@@ -2,20 +2,33 @@ package capture
 
 import (
 	"bufio"
-	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math"
 	"os"
 	"path/filepath"
+	"rewind/internal/remux"
 	hiddenexec "rewind/internal/utils"
 	stdruntime "runtime"
 	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 type Saver struct {
 	ffmpegPath string
 	outputDir  string
+
+	// OnComplete is called once a clip has been written (or failed), with
+	// the final .mp4 file or raw folder path.
+	OnComplete func(path string, err error)
+
+	pending sync.WaitGroup // saves that have not finished writing
+
+	mu       sync.Mutex
+	reserved map[string]bool // names handed out by ClipName, until their save ends
 }
 
 func NewSaver(ffmpegPath, outputDir string) *Saver {
@@ -31,6 +44,22 @@ type SaveOptions struct {
 	ConvertToMP4 bool
 	DeleteTS     bool
 	DurationSec  int
+
+	// Audio controls how the separate audio tracks are encoded
+	Audio AudioSettings
+
+	// Metadata is the recording context; duration, audio and creation time
+	// are filled in by the saver
+	Metadata *ClipMetadata
+
+	// Markers returns the markers dropped during the recording. It is
+	// called once capturing has ended; markers inside the clip become
+	// chapters.
+	Markers func() []Marker
+
+	// RecordingStart is when the buffered recording began, clips never
+	// reach further back
+	RecordingStart time.Time
 }
 
 func DefaultSaveOptions(filename string) *SaveOptions {
@@ -38,16 +67,10 @@ func DefaultSaveOptions(filename string) *SaveOptions {
 		Filename:     filename,
 		ConvertToMP4: true,
 		DeleteTS:     true,
+		Audio:        DefaultAudioSettings(),
 	}
 }
 
-// ClipMetadata stores configuration used during recording for later conversion
-type ClipMetadata struct {
-	DurationSec int       `json:"durationSec"`
-	HasAudio    bool      `json:"hasAudio"`
-	CreatedAt   time.Time `json:"createdAt"`
-}
-
 type Snapshotter interface {
 	Snapshot() []byte
 }
@@ -56,93 +79,153 @@ func (s *Saver) Save(src Snapshotter, opts *SaveOptions) error {
 	return s.SaveWithAudio(src, nil, opts)
 }
 
-func (s *Saver) SaveWithAudio(videoSrc Snapshotter, audioSrc Snapshotter, opts *SaveOptions) error {
+func (s *Saver) SaveWithAudio(videoSrc Snapshotter, audioTracks []AudioTrack, opts *SaveOptions) error {
 	videoData := videoSrc.Snapshot()
 	if len(videoData) == 0 {
 		return fmt.Errorf("buffer is empty")
 	}
 
-	var audioData []byte
-	if audioSrc != nil {
-		audioData = audioSrc.Snapshot()
-	}
+	audioData := trimTracks(snapshotTracks(audioTracks), opts.DurationSec)
+	opts.addChapters(time.Now())
 
-	go s.processSaveWithAudio(videoData, audioData, opts)
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		s.processSaveWithAudio(videoData, audioData, opts)
+	}()
 	return nil
 }
 
-func (s *Saver) processSaveWithAudio(videoData, audioData []byte, opts *SaveOptions) {
-	// Mode 1: RAW Save (Create folder, save video and audio separately)
-	if !opts.ConvertToMP4 {
-		clipDir := filepath.Join(s.outputDir, opts.Filename)
-		if err := os.MkdirAll(clipDir, os.ModePerm); err != nil {
-			slog.Error("failed to create clip directory", "error", err)
-			return
-		}
+// Wait blocks until every started save has been written or has failed
+func (s *Saver) Wait() {
+	s.pending.Wait()
+}
 
-		// Save Video
-		videoPath := filepath.Join(clipDir, "video.ts")
-		if err := s.writeData(videoPath, videoData); err != nil {
-			slog.Error("failed to save raw video", "error", err)
-		}
+func (s *Saver) processSaveWithAudio(videoData []byte, audioData []pcmData, opts *SaveOptions) {
+	defer s.ReleaseName(opts.Filename)
 
-		// Free Video RAM immediately
-		videoData = nil
-		stdruntime.GC()
-		debug.FreeOSMemory()
+	path, err := s.writeClip(videoData, audioData, opts)
+	if err != nil {
+		slog.Error("clip save failed", "filename", opts.Filename, "error", err)
+	}
+	if s.OnComplete != nil {
+		s.OnComplete(path, err)
+	}
+}
 
-		// Save Audio
-		hasAudio := len(audioData) > 0
-		if hasAudio {
-			audioPath := filepath.Join(clipDir, "audio.pcm")
-			if err := s.writeData(audioPath, audioData); err != nil {
-				slog.Error("failed to save raw audio", "error", err)
-			}
-		}
+func (s *Saver) writeClip(videoData []byte, audioData []pcmData, opts *SaveOptions) (string, error) {
+	mp4Path := filepath.Join(s.outputDir, opts.Filename+".mp4")
+	if err := os.MkdirAll(filepath.Dir(mp4Path), os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create clip directory: %w", err)
+	}
 
-		// Save Metadata
-		metadata := ClipMetadata{
-			DurationSec: opts.DurationSec,
-			HasAudio:    hasAudio,
-			CreatedAt:   time.Now(),
-		}
-		metadataPath := filepath.Join(clipDir, "metadata.json")
-		if err := s.writeMetadata(metadataPath, &metadata); err != nil {
-			slog.Error("failed to save metadata", "error", err)
+	// Video-only clips are remuxed in-process, ffmpeg is the fallback
+	if opts.ConvertToMP4 && len(audioData) == 0 {
+		opts.Metadata = opts.clipMetadata(nil)
+		path, err := s.remuxNative(videoData, mp4Path, opts.DurationSec, opts.Metadata)
+		if err == nil {
+			opts.Metadata.Health = s.Verify(path, opts.Metadata)
+			if !opts.Metadata.Health.Broken() {
+				if err := s.writeMetadata(MetadataPath(path), opts.Metadata); err != nil {
+					slog.Error("failed to save metadata", "error", err)
+				}
+				slog.Info("clip saved", "path", path, "remux", "native")
+				return path, nil
+			}
+			err = fmt.Errorf("verification failed: %s", strings.Join(opts.Metadata.Health.Problems, "; "))
+			os.Remove(path)
 		}
+		slog.Warn("native remux failed, falling back to ffmpeg", "error", err)
+	}
 
-		slog.Info("raw clip saved", "dir", clipDir)
-		return
+	// Everything else is written as a raw folder inside the in-flight dir
+	// first, so a crash never leaves half-written clips in the output dir
+	workDir, err := s.beginSave(opts, audioData)
+	if err != nil {
+		return "", fmt.Errorf("failed to start save: %w", err)
 	}
 
-	// Mode 2: MP4 Conversion (Temp files -> FFmpeg -> MP4)
-	tsPath := filepath.Join(s.outputDir, opts.Filename+".ts")
-	if err := s.writeData(tsPath, videoData); err != nil {
-		slog.Error("failed to write video temp file", "error", err)
-		return
+	// Save Video
+	videoPath := filepath.Join(workDir, "video.ts")
+	if err := s.writeData(videoPath, videoData); err != nil {
+		os.RemoveAll(workDir)
+		return "", fmt.Errorf("failed to save raw video: %w", err)
 	}
 
+	// Free Video RAM immediately
 	videoData = nil
 	stdruntime.GC()
 	debug.FreeOSMemory()
 
-	var pcmPath string
-	if len(audioData) > 0 {
-		pcmPath = filepath.Join(s.outputDir, opts.Filename+".pcm")
-		if err := s.writeData(pcmPath, audioData); err != nil {
-			slog.Error("failed to write audio temp file", "error", err)
-			pcmPath = ""
+	// Save Audio, one file per track
+	var labels []string
+	for _, track := range audioData {
+		audioPath := filepath.Join(workDir, audioTrackFile(track.label))
+		if err := s.writeData(audioPath, track.data); err != nil {
+			slog.Error("failed to save raw audio", "track", track.label, "error", err)
+			continue
 		}
+		labels = append(labels, track.label)
+	}
+	if len(audioData) > 0 {
 		audioData = nil
 		stdruntime.GC()
 		debug.FreeOSMemory()
 	}
 
-	if pcmPath != "" {
-		s.mergeVideoAudio(tsPath, pcmPath, opts)
-	} else {
-		s.ConvertToMP4(tsPath, opts)
+	// Save Metadata
+	metadata := opts.clipMetadata(labels)
+	opts.Metadata = metadata
+	if err := s.writeMetadata(filepath.Join(workDir, rawMetadataFile), metadata); err != nil {
+		slog.Error("failed to save metadata", "error", err)
+	}
+
+	// Mode 1: RAW Save (the finished folder is moved into place)
+	if !opts.ConvertToMP4 {
+		clipDir, err := s.commitRaw(workDir, opts.Filename)
+		if err != nil {
+			return "", err
+		}
+		slog.Info("raw clip saved", "dir", clipDir)
+		return clipDir, nil
+	}
+
+	// Mode 2: MP4 Conversion (raw folder -> FFmpeg -> MP4)
+	mp4Path, err = s.convertFolder(workDir, mp4Path, metadata, opts.Audio)
+	if err != nil {
+		// Keep the recording as a raw clip that can be converted later
+		slog.Error("conversion failed, keeping raw clip", "filename", opts.Filename, "error", err)
+		return s.commitRaw(workDir, opts.Filename)
+	}
+
+	// A broken clip keeps its sources for RetryConversion
+	s.verifyClip(mp4Path, workDir, metadata)
+
+	if err := s.writeMetadata(MetadataPath(mp4Path), metadata); err != nil {
+		slog.Error("failed to save metadata", "error", err)
+	}
+	os.RemoveAll(workDir)
+
+	slog.Info("clip saved", "path", mp4Path, "audioTracks", len(labels))
+	return mp4Path, nil
+}
+
+// clipMetadata completes the recording context with save-time values
+func (o *SaveOptions) clipMetadata(audioTracks []string) *ClipMetadata {
+	var m ClipMetadata
+	if o.Metadata != nil {
+		m = *o.Metadata
+	}
+	m.DurationSec = o.DurationSec
+	// A recording younger than the requested duration yields a shorter
+	// clip, which verification must not take for lost frames
+	if !o.RecordingStart.IsZero() && m.DurationSec > 0 {
+		m.DurationSec = min(m.DurationSec, int(math.Ceil(time.Since(o.RecordingStart).Seconds())))
 	}
+	m.HasAudio = len(audioTracks) > 0
+	m.AudioTracks = audioTracks
+	m.CreatedAt = time.Now()
+	return &m
 }
 
 func (s *Saver) writeData(path string, data []byte) error {
@@ -163,44 +246,6 @@ func (s *Saver) writeData(path string, data []byte) error {
 	return nil
 }
 
-func (s *Saver) mergeVideoAudio(tsPath, pcmPath string, opts *SaveOptions) error {
-	mp4Path := filepath.Join(s.outputDir, opts.Filename+".mp4")
-	absTs, _ := filepath.Abs(tsPath)
-	absPcm, _ := filepath.Abs(pcmPath)
-	absMp4, _ := filepath.Abs(mp4Path)
-
-	inputArgs := []string{}
-	if opts.DurationSec > 0 {
-		inputArgs = append(inputArgs, "-sseof", fmt.Sprintf("-%d", opts.DurationSec))
-	}
-	inputArgs = append(inputArgs, "-i", absTs)
-
-	args := []string{"-y"}
-	args = append(args, inputArgs...)
-	args = append(args,
-		"-f", "f32le", "-ar", "48000", "-ac", "2", "-i", absPcm,
-		"-c:v", "copy",
-		"-c:a", "aac", "-b:a", "192k",
-		"-shortest",
-		absMp4,
-	)
-
-	cmd := hiddenexec.Command(s.ffmpegPath, args...)
-	if err := cmd.Run(); err != nil {
-		slog.Error("merge failed", "error", err)
-		return err
-	}
-
-	slog.Info("clip saved with audio", "path", mp4Path)
-
-	if opts.DeleteTS {
-		os.Remove(absTs)
-	}
-	os.Remove(absPcm)
-
-	return nil
-}
-
 func (s *Saver) ConvertToMP4(tsPath string, opts *SaveOptions) error {
 	mp4Path := filepath.Join(s.outputDir, opts.Filename+".mp4")
 	absTs, _ := filepath.Abs(tsPath)
@@ -210,10 +255,11 @@ func (s *Saver) ConvertToMP4(tsPath string, opts *SaveOptions) error {
 	if opts.DurationSec > 0 {
 		args = append(args, "-sseof", fmt.Sprintf("-%d", opts.DurationSec))
 	}
-	args = append(args, "-i", absTs, "-c", "copy", absMp4)
+	args = append(args, "-i", absTs, "-c", "copy")
+	args = append(args, metadataArgs(opts.Metadata)...)
 
-	cmd := hiddenexec.Command(s.ffmpegPath, args...)
-	if err := cmd.Run(); err != nil {
+	mp4Path, err := s.runToFile(args, absMp4)
+	if err != nil {
 		slog.Error("conversion failed", "error", err)
 		return err
 	}
@@ -225,46 +271,57 @@ func (s *Saver) ConvertToMP4(tsPath string, opts *SaveOptions) error {
 	return nil
 }
 
-func (s *Saver) writeMetadata(path string, metadata *ClipMetadata) error {
-	data, err := json.MarshalIndent(metadata, "", "  ")
+// ConvertRawFolder converts a raw clip folder to MP4
+func (s *Saver) ConvertRawFolder(folderPath string, deleteRaw bool, audio AudioSettings) error {
+	// Read metadata
+	metadata, err := ReadMetadata(folderPath)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to read metadata: %w", err)
 	}
-	return os.WriteFile(path, data, 0644)
-}
 
-// ReadMetadata reads metadata from a raw clip folder
-func ReadMetadata(folderPath string) (*ClipMetadata, error) {
-	metadataPath := filepath.Join(folderPath, "metadata.json")
-	data, err := os.ReadFile(metadataPath)
+	// The MP4 replaces the folder in place, which may be a subfolder; an
+	// existing clip of that name gets a suffix instead of being replaced
+	mp4Path, err := s.convertFolder(folderPath, filepath.Clean(folderPath)+".mp4", metadata, audio)
 	if err != nil {
-		return nil, err
+		slog.Error("raw folder conversion failed", "error", err)
+		return err
 	}
 
-	var metadata ClipMetadata
-	if err := json.Unmarshal(data, &metadata); err != nil {
-		return nil, err
+	// A broken conversion keeps the raw folder as its sources, where
+	// RetryConversion looks for them
+	metadata.Health = s.Verify(mp4Path, metadata)
+	if metadata.Health.Broken() {
+		slog.Error("converted clip failed verification", "path", mp4Path, "problems", metadata.Health.Problems)
+		if err := s.keepSources(mp4Path, folderPath); err != nil {
+			slog.Error("failed to keep clip sources", "path", mp4Path, "error", err)
+		}
+		deleteRaw = false
 	}
-	return &metadata, nil
-}
 
-// ConvertRawFolder converts a raw clip folder to MP4
-func (s *Saver) ConvertRawFolder(folderPath string, deleteRaw bool) error {
-	// Read metadata
-	metadata, err := ReadMetadata(folderPath)
-	if err != nil {
-		return fmt.Errorf("failed to read metadata: %w", err)
-	}
+	return s.finishRawConversion(folderPath, mp4Path, metadata, deleteRaw)
+}
 
-	folderName := filepath.Base(folderPath)
-	mp4Path := filepath.Join(s.outputDir, folderName+".mp4")
+// convertFolder writes the video and audio tracks of a raw folder layout to
+// mp4Path, trimmed to the metadata duration. It returns the path written,
+// see placeFile.
+func (s *Saver) convertFolder(folderPath, mp4Path string, metadata *ClipMetadata, audio AudioSettings) (string, error) {
 	absMp4, _ := filepath.Abs(mp4Path)
 
 	videoPath := filepath.Join(folderPath, "video.ts")
 	absVideo, _ := filepath.Abs(videoPath)
 
-	audioPath := filepath.Join(folderPath, "audio.pcm")
-	absAudio, _ := filepath.Abs(audioPath)
+	audioFiles := rawAudioFiles(folderPath, metadata)
+
+	// Video-only folders are remuxed in-process, ffmpeg is the fallback
+	if len(audioFiles) == 0 {
+		if data, err := os.ReadFile(absVideo); err == nil {
+			path, err := s.remuxNative(data, absMp4, metadata.DurationSec, metadata)
+			if err == nil {
+				return path, nil
+			}
+			slog.Warn("native remux failed, falling back to ffmpeg", "error", err)
+		}
+	}
 
 	args := []string{"-y"}
 
@@ -274,28 +331,64 @@ func (s *Saver) ConvertRawFolder(folderPath string, deleteRaw bool) error {
 	}
 	args = append(args, "-i", absVideo)
 
-	if metadata.HasAudio {
-		// Add audio input and merge
-		args = append(args,
-			"-f", "f32le", "-ar", "48000", "-ac", "2", "-i", absAudio,
-			"-c:v", "copy",
-			"-c:a", "aac", "-b:a", "192k",
-			"-shortest",
-			absMp4,
-		)
+	var inputs, output []string
+	if len(audioFiles) > 0 {
+		// Add audio inputs and merge
+		inputs, output = s.audioMergeArgs(audioFiles, audio)
 	} else {
 		// Video only
-		args = append(args, "-c", "copy", absMp4)
+		output = []string{"-c", "copy"}
+	}
+	args = append(args, inputs...)
+
+	// Chapters come from an ffmetadata file after the audio inputs
+	if chaptersPath, err := writeChapterFile(metadata); err != nil {
+		slog.Warn("failed to write chapters", "error", err)
+	} else if chaptersPath != "" {
+		defer os.Remove(chaptersPath)
+		args = append(args, "-f", "ffmetadata", "-i", chaptersPath)
+		output = append(output, "-map_chapters", strconv.Itoa(1+len(audioFiles)))
 	}
 
+	args = append(args, output...)
+	args = append(args, metadataArgs(metadata)...)
+
+	return s.runToFile(args, absMp4)
+}
+
+// runToFile runs ffmpeg with args writing MP4 into a temporary file next to
+// path, which is moved into place once ffmpeg has succeeded
+func (s *Saver) runToFile(args []string, path string) (string, error) {
+	partPath := path + partSuffix
+	args = append(args, "-f", "mp4", partPath)
+
 	cmd := hiddenexec.Command(s.ffmpegPath, args...)
 	if err := cmd.Run(); err != nil {
-		slog.Error("raw folder conversion failed", "error", err)
-		return err
+		os.Remove(partPath)
+		return "", err
 	}
+	return placeFile(partPath, path)
+}
 
+// placeFile renames a finished temporary file to path and returns the final
+// path. A file that appeared at path in the meantime is never replaced, the
+// new one gets a numbered suffix instead.
+func placeFile(partPath, path string) (string, error) {
+	final := uniquePath(path)
+	if err := os.Rename(partPath, final); err != nil {
+		os.Remove(partPath)
+		return "", err
+	}
+	return final, nil
+}
+
+func (s *Saver) finishRawConversion(folderPath, mp4Path string, metadata *ClipMetadata, deleteRaw bool) error {
 	slog.Info("raw folder converted to mp4", "folder", folderPath, "output", mp4Path)
 
+	if err := s.writeMetadata(MetadataPath(mp4Path), metadata); err != nil {
+		slog.Warn("failed to save metadata", "error", err)
+	}
+
 	// Delete raw folder if requested
 	if deleteRaw {
 		if err := os.RemoveAll(folderPath); err != nil {
@@ -305,3 +398,36 @@ func (s *Saver) ConvertRawFolder(folderPath string, deleteRaw bool) error {
 
 	return nil
 }
+
+// remuxNative converts the TS video to MP4 in-process, trimmed to the last
+// durationSec seconds at a keyframe. It returns the path written, see
+// placeFile.
+func (s *Saver) remuxNative(tsData []byte, mp4Path string, durationSec int, metadata *ClipMetadata) (string, error) {
+	partPath := mp4Path + partSuffix
+	f, err := os.Create(partPath)
+	if err != nil {
+		return "", err
+	}
+
+	opts := remux.Options{Duration: time.Duration(durationSec) * time.Second}
+	if metadata != nil {
+		opts.CreatedAt = metadata.CreatedAt
+		opts.Tags = metadataTags(metadata)
+		for _, c := range metadata.Chapters {
+			opts.Chapters = append(opts.Chapters, remux.Chapter{
+				Start: time.Duration(c.StartSec * float64(time.Second)),
+				Title: c.Title,
+			})
+		}
+	}
+
+	err = remux.TSToMP4(tsData, f, opts)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return "", err
+	}
+	return placeFile(partPath, mp4Path)
+}
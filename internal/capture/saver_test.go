@@ -0,0 +1,66 @@
+package capture
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPlaceFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "clip.mp4")
+
+	write := func(p, content string) {
+		t.Helper()
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(path+partSuffix, "first")
+	got, err := placeFile(path+partSuffix, path)
+	if err != nil || got != path {
+		t.Fatalf("placeFile() = %q, %v, want %q", got, err, path)
+	}
+
+	// A clip that took the name meanwhile is kept
+	write(path+partSuffix, "second")
+	got, err = placeFile(path+partSuffix, path)
+	if want := filepath.Join(dir, "clip_2.mp4"); err != nil || got != want {
+		t.Fatalf("placeFile() = %q, %v, want %q", got, err, want)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "first" {
+		t.Errorf("existing clip = %q, want it untouched", data)
+	}
+	if _, err := os.Stat(path + partSuffix); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+func TestClipMetadataDuration(t *testing.T) {
+	tests := []struct {
+		name        string
+		durationSec int
+		recording   time.Duration // how long ago recording started, 0 = unknown
+		want        int
+	}{
+		{name: "buffer full", durationSec: 30, recording: time.Hour, want: 30},
+		{name: "recording younger than the clip", durationSec: 30, recording: 10 * time.Second, want: 11},
+		{name: "start unknown", durationSec: 30, want: 30},
+		{name: "whole buffer", durationSec: 0, recording: 10 * time.Second, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultSaveOptions("clip")
+			opts.DurationSec = tt.durationSec
+			if tt.recording > 0 {
+				opts.RecordingStart = time.Now().Add(-tt.recording).Add(-time.Millisecond)
+			}
+			if got := opts.clipMetadata(nil).DurationSec; got != tt.want {
+				t.Errorf("DurationSec = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	hiddenexec "rewind/internal/utils"
+)
+
+const (
+	HealthOK     = "ok"
+	HealthBroken = "broken"
+
+	// HealthUnknown means the clip could not be checked, e.g. because
+	// ffmpeg is missing; the clip is treated as fine
+	HealthUnknown = "unknown"
+
+	// SourcesDirName keeps the TS/PCM sources of clips that failed
+	// verification, so the conversion can be retried
+	SourcesDirName = ".sources"
+
+	// gopProbeSeconds is decoded at the start and end of a clip, long
+	// enough to cover a full GOP at common keyframe intervals
+	gopProbeSeconds = 3
+
+	// minDurationRatio is the share of the expected duration a clip must
+	// reach; less means frames were lost, not just trimmed at a keyframe
+	minDurationRatio = 0.75
+)
+
+// Health is the result of verifying a clip
+type Health struct {
+	Status    string    `json:"status"` // "ok", "broken" or "unknown"
+	CheckedAt time.Time `json:"checkedAt"`
+	Duration  float64   `json:"duration"` // seconds, as reported by ffmpeg
+	Problems  []string  `json:"problems,omitempty"`
+}
+
+// OK reports whether the clip passed verification
+func (h *Health) OK() bool {
+	return h != nil && h.Status == HealthOK
+}
+
+// Broken reports whether verification found problems. A clip that could
+// not be checked is not broken.
+func (h *Health) Broken() bool {
+	return h != nil && h.Status == HealthBroken
+}
+
+// SourcesDir returns where the sources of a failed clip are kept
+func SourcesDir(clipPath string) string {
+	return filepath.Join(filepath.Dir(clipPath), SourcesDirName, filepath.Base(clipPath))
+}
+
+// Verify checks that a clip has the expected streams, a sane duration and
+// that its first and last GOP decode without errors. expect describes the
+// clip as it was saved; nil only checks the file itself.
+func (s *Saver) Verify(path string, expect *ClipMetadata) *Health {
+	h := &Health{Status: HealthOK, CheckedAt: time.Now()}
+	problem := func(format string, args ...any) {
+		h.Status = HealthBroken
+		h.Problems = append(h.Problems, fmt.Sprintf(format, args...))
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		problem("file not found")
+		return h
+	}
+	if info.Size() == 0 {
+		problem("file is empty")
+		return h
+	}
+
+	probe, err := s.Probe(path)
+	if errors.Is(err, errFFmpegMissing) {
+		h.Status = HealthUnknown
+		h.Problems = []string{err.Error()}
+		return h
+	}
+	if err != nil {
+		problem("unreadable: %v", err)
+		return h
+	}
+
+	h.Duration = probe.Duration.Seconds()
+	if h.Duration <= 0 {
+		problem("zero duration")
+	} else if expect != nil && tooShort(h.Duration, expect.DurationSec) {
+		problem("duration %.1fs is far short of the expected %ds", h.Duration, expect.DurationSec)
+	}
+
+	if probe.VideoCodec == "" {
+		problem("no video stream")
+		return h
+	}
+	if expect != nil && expect.HasAudio && probe.AudioCount == 0 {
+		problem("no audio stream")
+	}
+
+	// Decode the start and the end of the video
+	seconds := strconv.Itoa(gopProbeSeconds)
+	if err := s.decodeCheck("-t", seconds, "-i", path); err != "" {
+		problem("first GOP does not decode: %s", err)
+	}
+	if err := s.decodeCheck("-sseof", "-"+seconds, "-i", path); err != "" {
+		problem("last GOP does not decode: %s", err)
+	}
+
+	return h
+}
+
+// tooShort reports whether a clip of seconds falls far short of the
+// expected duration. 0 means the duration is unknown.
+func tooShort(seconds float64, expectSec int) bool {
+	return expectSec > 0 && seconds < float64(expectSec)*minDurationRatio
+}
+
+// decodeCheck decodes the first video stream of the given input and returns
+// the first decoder error, or "" if it decoded cleanly
+func (s *Saver) decodeCheck(inputArgs ...string) string {
+	args := append([]string{"-hide_banner", "-v", "error", "-xerror"}, inputArgs...)
+	args = append(args, "-map", "0:v:0", "-f", "null", "-")
+
+	out, err := hiddenexec.Command(s.ffmpegPath, args...).CombinedOutput()
+	if err != nil {
+		if msg := lastLines(string(out), 1); msg != "" {
+			return msg
+		}
+		return err.Error()
+	}
+	return ""
+}
+
+// verifyClip verifies a converted clip and stores the result in metadata.
+// When it is broken, the raw folder at workDir is kept as its sources.
+func (s *Saver) verifyClip(mp4Path, workDir string, metadata *ClipMetadata) {
+	metadata.Health = s.Verify(mp4Path, metadata)
+	if !metadata.Health.Broken() {
+		return
+	}
+
+	slog.Error("clip failed verification", "path", mp4Path, "problems", metadata.Health.Problems)
+	if err := s.keepSources(mp4Path, workDir); err != nil {
+		slog.Error("failed to keep clip sources", "path", mp4Path, "error", err)
+	}
+}
+
+// keepSources moves a raw folder to the sources dir of a clip
+func (s *Saver) keepSources(clipPath, folderPath string) error {
+	os.Remove(filepath.Join(folderPath, journalFile))
+
+	dst := SourcesDir(clipPath)
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	os.RemoveAll(dst)
+	return os.Rename(folderPath, dst)
+}
+
+// RetryConversion converts a broken clip again from its kept sources. The
+// sources are removed once the new clip passes verification.
+func (s *Saver) RetryConversion(clipPath string, audio AudioSettings) (*Health, error) {
+	sources := SourcesDir(clipPath)
+	metadata, err := ReadMetadata(sources)
+	if err != nil {
+		return nil, fmt.Errorf("no sources kept for this clip: %w", err)
+	}
+
+	out, err := s.convertFolder(sources, clipPath, metadata, audio)
+	if err != nil {
+		return nil, fmt.Errorf("conversion failed: %w", err)
+	}
+
+	// The new conversion lands next to the broken clip, which it replaces
+	if out != clipPath {
+		if err := os.Rename(out, clipPath); err != nil {
+			os.Remove(out)
+			return nil, fmt.Errorf("failed to replace clip: %w", err)
+		}
+	}
+
+	metadata.Health = s.Verify(clipPath, metadata)
+	if err := s.writeMetadata(MetadataPath(clipPath), metadata); err != nil {
+		slog.Warn("failed to save metadata", "error", err)
+	}
+
+	if metadata.Health.OK() {
+		os.RemoveAll(sources)
+		slog.Info("clip repaired", "path", clipPath)
+	}
+	return metadata.Health, nil
+}
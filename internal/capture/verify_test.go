@@ -0,0 +1,25 @@
+package capture
+
+import "testing"
+
+func TestTooShort(t *testing.T) {
+	tests := []struct {
+		seconds   float64
+		expectSec int
+		want      bool
+	}{
+		{seconds: 30, expectSec: 30},
+		{seconds: 31.5, expectSec: 30}, // starts at an earlier keyframe
+		{seconds: 28, expectSec: 30},
+		{seconds: 22.5, expectSec: 30},
+		{seconds: 22, expectSec: 30, want: true},
+		{seconds: 4, expectSec: 60, want: true},
+		{seconds: 4, expectSec: 0}, // unknown
+	}
+
+	for _, tt := range tests {
+		if got := tooShort(tt.seconds, tt.expectSec); got != tt.want {
+			t.Errorf("tooShort(%v, %d) = %v, want %v", tt.seconds, tt.expectSec, got, tt.want)
+		}
+	}
+}
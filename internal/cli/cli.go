@@ -0,0 +1,134 @@
+// Package cli runs the replay engine without the GUI, for build agents,
+// kiosks and shell scripts
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"rewind/internal/app"
+	"rewind/internal/logging"
+)
+
+// Exit codes
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// errUsage reports bad arguments; the command's usage is printed
+var errUsage = errors.New("invalid arguments")
+
+// env is what every command gets to work with
+type env struct {
+	app    *app.App
+	ffmpeg string
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command struct {
+	usage   string
+	summary string
+	run     func(e *env, args []string) error
+}
+
+var commands = map[string]command{
+	"record":   {"record [--profile NAME] [--save-on-exit]", "Run the replay buffer until interrupted", runRecord},
+	"save":     {"save [--duration SECONDS]", "Save a clip from the running instance", runSave},
+	"clips":    {"clips list [--json] [--search TEXT] [--tag TAG] [--favorites] [--sort KEY] [--limit N] | convert PATH... | delete PATH... | trash [--empty] | restore ID...", "Manage saved clips", runClips},
+	"devices":  {"devices", "List audio devices and displays", runDevices},
+	"encoders": {"encoders", "List available video encoders", runEncoders},
+	"config":   {"config get [KEY] | set KEY VALUE", "Show or change settings", runConfig},
+	"help":     {"help", "Show this help", nil},
+}
+
+// globalFlags are the flags Run accepts in front of the command
+var globalFlags = []string{"v", "v=true", "v=false"}
+
+// IsCommand reports whether the arguments select the headless mode. Global
+// flags may come before the command, as in "rewind -v record".
+func IsCommand(args []string) bool {
+	for _, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		if name != arg && slices.Contains(globalFlags, name) {
+			continue
+		}
+		_, ok := commands[name]
+		return ok || name == "h"
+	}
+	return false
+}
+
+// Run executes a headless command and returns the process exit code
+func Run(args []string, ffmpegPath string) int {
+	attachConsole()
+
+	e := &env{ffmpeg: ffmpegPath, stdout: os.Stdout, stderr: os.Stderr}
+
+	global := flag.NewFlagSet("rewind", flag.ContinueOnError)
+	global.SetOutput(io.Discard)
+	verbose := global.Bool("v", false, "log to stderr")
+	if err := global.Parse(args); err != nil || global.NArg() == 0 {
+		printUsage(e.stderr)
+		return exitUsage
+	}
+	args = global.Args()
+
+	name := strings.TrimLeft(args[0], "-")
+	cmd, ok := commands[name]
+	if !ok || cmd.run == nil {
+		printUsage(e.stdout)
+		if ok || name == "h" {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	var console io.Writer
+	if *verbose {
+		console = e.stderr
+	}
+	if err := logging.SetupWithConsole(logging.GetDefaultLogPath(), *verbose, console); err != nil {
+		log.Printf("Failed to setup logging: %v", err)
+	}
+	defer logging.Close()
+
+	e.app = app.New(ffmpegPath)
+
+	if err := cmd.run(e, args[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(e.stderr, "usage: rewind %s\n", cmd.usage)
+			return exitUsage
+		}
+		fmt.Fprintf(e.stderr, "rewind %s: %v\n", name, err)
+		return exitError
+	}
+	return exitOK
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: rewind [-v] COMMAND [ARGS]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Without a command, Rewind starts the desktop app.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].summary)
+		fmt.Fprintf(w, "  %-10s   rewind %s\n", "", commands[name].usage)
+	}
+}
@@ -0,0 +1,36 @@
+package cli
+
+import "testing"
+
+func TestIsCommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{nil, false},
+		{[]string{"record"}, true},
+		{[]string{"--save-clip"}, false},
+		{[]string{"-h"}, true},
+		{[]string{"-v", "record"}, true},
+		{[]string{"--v=true", "config", "get"}, true},
+		{[]string{"-v"}, false},
+		{[]string{"-v", "--save-clip", "--duration", "60"}, false},
+		{[]string{"v", "record"}, false},
+		{[]string{"--minimized"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsCommand(tt.args); got != tt.want {
+			t.Errorf("IsCommand(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestForwardStartsAppWithoutCommandFlags(t *testing.T) {
+	for _, args := range [][]string{nil, {"--minimized"}, {"--autostart", "extra"}} {
+		cmd, exit, done := Forward(args)
+		if done || exit != exitOK || !cmd.Empty() {
+			t.Errorf("Forward(%q) = %+v, %d, %v; want the app to start", args, cmd, exit, done)
+		}
+	}
+}
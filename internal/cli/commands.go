@@ -0,0 +1,434 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"rewind/internal/app"
+	"rewind/internal/hardware"
+	"rewind/internal/library"
+	"rewind/internal/utils"
+)
+
+// newFlags creates a flag set that reports errors through errUsage
+func newFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func runRecord(e *env, args []string) error {
+	fs := newFlags("record")
+	profile := fs.String("profile", "", "profile to activate before recording")
+	saveOnExit := fs.Bool("save-on-exit", false, "save a clip when interrupted")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return errUsage
+	}
+
+	if _, err := sendControl(nil); err == nil {
+		return fmt.Errorf("another Rewind instance is already running")
+	}
+
+	if err := e.app.Initialize(); err != nil {
+		return err
+	}
+	if *profile != "" {
+		if err := e.app.SwitchProfile(*profile); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := e.app.Start(); err != nil {
+		return err
+	}
+
+	control, err := StartControl(e.app)
+	if err != nil {
+		e.app.Stop()
+		return err
+	}
+	defer control.Close()
+
+	cfg := e.app.GetConfig()
+	fmt.Fprintf(e.stdout, "Recording the last %ds to %s. Run 'rewind save' to save a clip, Ctrl+C to stop.\n", cfg.RecordSeconds, cfg.OutputDir)
+
+	<-ctx.Done()
+	stop()
+
+	if *saveOnExit {
+		if name, err := e.app.SaveClip(); err != nil {
+			fmt.Fprintf(e.stderr, "failed to save clip: %v\n", err)
+		} else {
+			fmt.Fprintln(e.stdout, name)
+		}
+	}
+
+	if err := e.app.Stop(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(e.stdout, "Stopped, waiting for clips to be written...")
+	e.app.WaitForSaves()
+	return nil
+}
+
+func runSave(e *env, args []string) error {
+	fs := newFlags("save")
+	duration := fs.Int("duration", 0, "seconds to keep")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || *duration < 0 {
+		return errUsage
+	}
+
+	name, err := sendControl(app.Command{SaveClip: true, Duration: *duration}.Args())
+	if errors.Is(err, errNotRunning) {
+		return fmt.Errorf("%w, start one with 'rewind record'", err)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(e.stdout, name)
+	return nil
+}
+
+func runClips(e *env, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		var q library.Query
+		fs := newFlags("list")
+		asJSON := fs.Bool("json", false, "print JSON")
+		fs.StringVar(&q.Search, "search", "", "words to search for")
+		tag := fs.String("tag", "", "only clips with this tag")
+		fs.BoolVar(&q.Favorites, "favorites", false, "only favorites")
+		fs.StringVar(&q.SortBy, "sort", library.SortDate, "date, name, size or duration")
+		fs.IntVar(&q.Limit, "limit", 0, "maximum number of clips")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() > 0 {
+			return errUsage
+		}
+		if *tag != "" {
+			q.Tags = []string{*tag}
+		}
+		return listClips(e, q, *asJSON)
+	case "convert", "delete":
+		if len(args) < 2 {
+			return errUsage
+		}
+		outputDir := e.app.GetConfig().OutputDir
+		var failed int
+		for _, arg := range args[1:] {
+			path := resolveClip(arg, outputDir)
+
+			var err error
+			if args[0] == "convert" {
+				err = e.app.ConvertToMP4(path)
+			} else {
+				err = e.app.DeleteClip(path)
+			}
+			if err != nil {
+				fmt.Fprintf(e.stderr, "%s: %v\n", arg, err)
+				failed++
+				continue
+			}
+			fmt.Fprintln(e.stdout, path)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d clips failed", failed, len(args)-1)
+		}
+		return nil
+	case "trash":
+		fs := newFlags("trash")
+		empty := fs.Bool("empty", false, "permanently delete everything in the trash")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() > 0 {
+			return errUsage
+		}
+		if *empty {
+			return e.app.EmptyTrash()
+		}
+		return listTrash(e)
+	case "restore":
+		if len(args) < 2 {
+			return errUsage
+		}
+		var failed int
+		for _, id := range args[1:] {
+			path, err := e.app.RestoreClip(id)
+			if err != nil {
+				fmt.Fprintf(e.stderr, "%s: %v\n", id, err)
+				failed++
+				continue
+			}
+			fmt.Fprintln(e.stdout, path)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d clips failed", failed, len(args)-1)
+		}
+		return nil
+	default:
+		return errUsage
+	}
+}
+
+func listTrash(e *env) error {
+	items, err := e.app.GetTrash()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPATH\tSIZE\tDELETED")
+	for _, it := range items {
+		fmt.Fprintf(w, "%s\t%s\t%.1f MB\t%s\n", it.ID, it.OriginalPath, float64(it.Size)/1024/1024, it.DeletedAt.Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+// resolveClip accepts paths relative to the working directory or to the
+// output directory
+func resolveClip(arg, outputDir string) string {
+	if _, err := os.Stat(arg); err == nil {
+		if abs, err := filepath.Abs(arg); err == nil {
+			return abs
+		}
+		return arg
+	}
+	if abs, err := utils.ResolveAbsPath(arg, outputDir); err == nil {
+		return abs
+	}
+	return arg
+}
+
+func listClips(e *env, q library.Query, asJSON bool) error {
+	page, err := e.app.QueryClips(q)
+	if err != nil {
+		return err
+	}
+	clips := page.Clips
+
+	if asJSON {
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(clips)
+	}
+
+	w := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSIZE\tDURATION\tHEALTH\tMODIFIED")
+	for _, c := range clips {
+		name := c.Name
+		if c.Folder != "" {
+			name = filepath.Join(c.Folder, c.Name)
+		}
+		duration := "-"
+		if c.DurationSec > 0 {
+			duration = fmt.Sprintf("%ds", c.DurationSec)
+		}
+		health := c.Health
+		if health == "" {
+			health = "-"
+		}
+		fmt.Fprintf(w, "%s\t%.1f MB\t%s\t%s\t%s\n", name, float64(c.Size)/1024/1024, duration, health, c.ModTime.Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+func runDevices(e *env, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	fmt.Fprintln(e.stdout, "Microphones:")
+	for _, d := range e.app.GetInputDevices() {
+		fmt.Fprintf(e.stdout, "  %s\n", d)
+	}
+	fmt.Fprintln(e.stdout, "System audio:")
+	for _, d := range e.app.GetOutputDevices() {
+		fmt.Fprintf(e.stdout, "  %s\n", d)
+	}
+
+	hardware.FFmpegPath = e.ffmpeg
+	displays, err := hardware.DetectDisplays()
+	if err != nil {
+		return fmt.Errorf("failed to detect displays: %w", err)
+	}
+	fmt.Fprintln(e.stdout, "Displays:")
+	for _, d := range displays {
+		primary := ""
+		if d.IsPrimary {
+			primary = " (primary)"
+		}
+		fmt.Fprintf(e.stdout, "  %d: %s %dx%d@%dHz%s\n", d.Index, d.FriendlyName, d.Width, d.Height, d.RefreshRate, primary)
+	}
+	return nil
+}
+
+func runEncoders(e *env, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	hardware.FFmpegPath = e.ffmpeg
+	info, err := hardware.Detect()
+	if err != nil {
+		return fmt.Errorf("hardware detection failed: %w", err)
+	}
+
+	available := info.GetAvailableEncoders()
+	best := hardware.FindBestEncoder(available)
+
+	w := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCODEC\tDEVICE")
+	for _, enc := range available {
+		device := "CPU"
+		if gpu := info.GPUs.FindByIndex(enc.GPUIndex); gpu != nil {
+			device = gpu.Name
+		}
+		name := enc.Name
+		if best != nil && enc.Name == best.Name {
+			name += " *"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, enc.Codec, device)
+	}
+	return w.Flush()
+}
+
+func runConfig(e *env, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	cfg := e.app.GetConfig()
+	var doc map[string]any
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	switch {
+	case args[0] == "get" && len(args) <= 2:
+		var value any = doc
+		if len(args) == 2 {
+			v, ok := lookupKey(doc, args[1])
+			if !ok {
+				return fmt.Errorf("unknown setting: %s", args[1])
+			}
+			value = v
+		}
+		if s, ok := value.(string); ok {
+			fmt.Fprintln(e.stdout, s)
+			return nil
+		}
+		out, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(e.stdout, string(out))
+		return nil
+	case args[0] == "set" && len(args) == 3:
+		// The running instance would overwrite the file with its own config
+		if _, err := sendControl(nil); err == nil {
+			return fmt.Errorf("a Rewind instance is running, change the setting there or quit it first")
+		}
+
+		// Values are JSON when they parse as JSON, strings otherwise
+		var value any
+		if err := json.Unmarshal([]byte(args[2]), &value); err != nil {
+			value = args[2]
+		}
+		if err := setKey(doc, args[1], value); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		var updated app.Config
+		if err := json.Unmarshal(data, &updated); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", args[1], err)
+		}
+		if err := checkHardware(e, cfg, updated); err != nil {
+			return err
+		}
+		return e.app.SetConfig(updated)
+	default:
+		return errUsage
+	}
+}
+
+// checkHardware rejects a changed display or encoder this machine doesn't
+// have, as the app does once hardware is detected
+func checkHardware(e *env, old, cfg app.Config) error {
+	hardware.FFmpegPath = e.ffmpeg
+
+	if cfg.DisplayIndex != old.DisplayIndex {
+		displays, err := hardware.DetectDisplays()
+		if err != nil {
+			return fmt.Errorf("failed to detect displays: %w", err)
+		}
+		if displays.FindByIndex(cfg.DisplayIndex) == nil {
+			return fmt.Errorf("display not found: %d", cfg.DisplayIndex)
+		}
+	}
+
+	if cfg.EncoderName != "" && cfg.EncoderName != old.EncoderName {
+		info, err := hardware.Detect()
+		if err != nil {
+			return fmt.Errorf("hardware detection failed: %w", err)
+		}
+		if info.GetEncoder(cfg.EncoderName) == nil {
+			return fmt.Errorf("encoder not found: %s", cfg.EncoderName)
+		}
+	}
+	return nil
+}
+
+// lookupKey resolves a dotted key such as "audio.codec"
+func lookupKey(doc map[string]any, key string) (any, bool) {
+	var cur any = doc
+	for _, part := range strings.Split(key, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// setKey replaces the value of an existing dotted key
+func setKey(doc map[string]any, key string, value any) error {
+	parts := strings.Split(key, ".")
+	parent, ok := lookupKey(doc, strings.Join(parts[:len(parts)-1], "."))
+	if len(parts) == 1 {
+		parent, ok = doc, true
+	}
+	m, isMap := parent.(map[string]any)
+	if !ok || !isMap {
+		return fmt.Errorf("unknown setting: %s", key)
+	}
+	if _, exists := m[parts[len(parts)-1]]; !exists {
+		return fmt.Errorf("unknown setting: %s", key)
+	}
+	m[parts[len(parts)-1]] = value
+	return nil
+}
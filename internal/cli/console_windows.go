@@ -0,0 +1,33 @@
+//go:build windows
+
+package cli
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	kernel32          = syscall.NewLazyDLL("kernel32.dll")
+	procAttachConsole = kernel32.NewProc("AttachConsole")
+)
+
+const attachParentProcess = ^uintptr(0) // ATTACH_PARENT_PROCESS
+
+// attachConsole connects stdout and stderr to the console of the shell
+// that started us. The release build is a GUI executable, which gets no
+// console of its own.
+func attachConsole() {
+	if fi, _ := os.Stdout.Stat(); fi != nil {
+		return // already redirected to a file or pipe
+	}
+
+	if ret, _, _ := procAttachConsole.Call(attachParentProcess); ret == 0 {
+		return
+	}
+
+	if out, err := os.OpenFile("CONOUT$", os.O_WRONLY, 0); err == nil {
+		os.Stdout = out
+		os.Stderr = out
+	}
+}
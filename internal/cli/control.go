@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"rewind/internal/app"
+	"rewind/internal/utils"
+)
+
+// controlFileName advertises the control endpoint of the running instance,
+// either the desktop app or 'rewind record'
+const controlFileName = "control.json"
+
+// controlInfo is written to controlFileName while an instance runs
+type controlInfo struct {
+	Addr  string `json:"addr"`
+	Token string `json:"token"`
+	PID   int    `json:"pid"`
+}
+
+// controlRequest carries command flags as read by app.ParseCommand. No
+// flags just asks for the state.
+type controlRequest struct {
+	Token string   `json:"token"`
+	Args  []string `json:"args"`
+}
+
+type controlResponse struct {
+	OK     bool   `json:"ok"`
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func controlFilePath() (string, error) {
+	dir, err := utils.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, controlFileName), nil
+}
+
+// ControlServer accepts commands from other rewind processes on loopback
+type ControlServer struct {
+	ln    net.Listener
+	token string
+	path  string
+	app   *app.App
+}
+
+// StartControl listens on a random loopback port and advertises it
+func StartControl(a *app.App) (*ControlServer, error) {
+	path, err := controlFilePath()
+	if err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	s := &ControlServer{ln: ln, token: hex.EncodeToString(key), path: path, app: a}
+	data, _ := json.Marshal(controlInfo{Addr: ln.Addr().String(), Token: s.token, PID: os.Getpid()})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to write control file: %w", err)
+	}
+
+	go s.serve()
+	return s, nil
+}
+
+// Close stops listening and removes the control file
+func (s *ControlServer) Close() {
+	s.ln.Close()
+	os.Remove(s.path)
+}
+
+func (s *ControlServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *ControlServer) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	var req controlRequest
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		return
+	}
+
+	var resp controlResponse
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(s.token)) != 1 {
+		resp.Error = "invalid token"
+		json.NewEncoder(conn).Encode(resp)
+		return
+	}
+
+	cmd, err := app.ParseCommand(req.Args)
+	switch {
+	case err != nil:
+		resp.Error = err.Error()
+	case cmd.Empty():
+		state, _ := json.Marshal(s.app.GetState())
+		resp.OK, resp.Result = true, string(state)
+	default:
+		if resp.Result, err = s.app.RunCommand(cmd); err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.OK = true
+		}
+	}
+
+	slog.Info("control command", "args", req.Args, "ok", resp.OK, "error", resp.Error)
+	json.NewEncoder(conn).Encode(resp)
+}
+
+// errNotRunning means no instance answered on the control endpoint
+var errNotRunning = errors.New("no Rewind instance is running")
+
+// sendControl runs command flags in the running instance
+func sendControl(args []string) (string, error) {
+	path, err := controlFilePath()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", errNotRunning
+		}
+		return "", err
+	}
+	var info controlInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return "", fmt.Errorf("invalid control file: %w", err)
+	}
+
+	conn, err := net.DialTimeout("tcp", info.Addr, 5*time.Second)
+	if err != nil {
+		// Left behind by an instance that crashed
+		return "", errNotRunning
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	if err := json.NewEncoder(conn).Encode(controlRequest{Token: info.Token, Args: args}); err != nil {
+		return "", err
+	}
+
+	var resp controlResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	if !resp.OK {
+		return "", fmt.Errorf("%s", resp.Error)
+	}
+	return resp.Result, nil
+}
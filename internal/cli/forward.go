@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"rewind/internal/app"
+)
+
+// Forward handles command flags given to the desktop app, e.g. from a
+// shortcut running "Rewind.exe --save-clip --duration 60". When an instance
+// is running the command runs there and done is true; exit is the status
+// to exit with. Otherwise the caller should start the app and run cmd once
+// it is up. Arguments without a command flag always start the app.
+func Forward(args []string) (cmd app.Command, exit int, done bool) {
+	if !app.HasCommandFlag(args) {
+		return app.Command{}, exitOK, false
+	}
+
+	cmd, err := app.ParseCommand(args)
+	if err != nil {
+		attachConsole()
+		fmt.Fprintf(os.Stderr, "rewind: %v\n", err)
+		return cmd, exitUsage, true
+	}
+	if cmd.Empty() {
+		return cmd, exitOK, false
+	}
+
+	result, err := sendControl(args)
+	if errors.Is(err, errNotRunning) {
+		return cmd, exitOK, false
+	}
+
+	attachConsole()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rewind: %v\n", err)
+		return cmd, exitError, true
+	}
+	if result != "" {
+		fmt.Fprintln(os.Stdout, result)
+	}
+	return cmd, exitOK, true
+}
@@ -0,0 +1,128 @@
+// Package events is a typed publish/subscribe bus. Each subscriber receives
+// every event in publish order on its own goroutine, so publishers never
+// wait for handlers and handlers may call back into the publisher.
+package events
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// backlogWarning is how far a subscriber may fall behind before it is
+// logged. Events are never dropped; handlers that talk to slow clients must
+// buffer or drop on their own.
+const backlogWarning = 1024
+
+// Event is anything published on a Bus
+type Event interface {
+	// Topic names the event for the frontend and API clients
+	Topic() string
+}
+
+// subscriber queues events without limit, so nothing is lost while its
+// handler is busy
+type subscriber struct {
+	mu     sync.Mutex
+	queue  []Event
+	warned bool
+	wake   chan struct{} // signalled after a push
+	done   chan struct{}
+}
+
+func (s *subscriber) push(ev Event) {
+	s.mu.Lock()
+	s.queue = append(s.queue, ev)
+	if n := len(s.queue); n >= backlogWarning && !s.warned {
+		s.warned = true
+		slog.Warn("event subscriber is behind", "queued", n, "topic", ev.Topic())
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run calls fn for queued events until done is closed
+func (s *subscriber) run(fn func(Event)) {
+	for {
+		s.mu.Lock()
+		batch := s.queue
+		s.queue = nil
+		s.warned = false
+		s.mu.Unlock()
+
+		for _, ev := range batch {
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			fn(ev)
+		}
+		if len(batch) > 0 {
+			continue
+		}
+
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Bus delivers published events to every subscriber
+type Bus struct {
+	mu   sync.Mutex
+	subs map[*subscriber]struct{}
+}
+
+// NewBus creates a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*subscriber]struct{})}
+}
+
+// Subscribe calls fn for every event published from now on, until
+// unsubscribe is called
+func (b *Bus) Subscribe(fn func(Event)) (unsubscribe func()) {
+	s := &subscriber{
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	go s.run(fn)
+
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, s)
+			b.mu.Unlock()
+			close(s.done)
+		})
+	}
+}
+
+// Publish queues ev for every subscriber without waiting for any of them
+func (b *Bus) Publish(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subs {
+		s.push(ev)
+	}
+}
+
+// On subscribes fn to the events of type T only
+func On[T Event](b *Bus, fn func(T)) (unsubscribe func()) {
+	return b.Subscribe(func(ev Event) {
+		if e, ok := ev.(T); ok {
+			fn(e)
+		}
+	})
+}
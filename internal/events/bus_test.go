@@ -0,0 +1,130 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+type testEvent int
+
+func (testEvent) Topic() string { return "test" }
+
+type otherEvent string
+
+func (otherEvent) Topic() string { return "other" }
+
+// receive collects n events from ch, failing after a second
+func receive[T any](t *testing.T, ch <-chan T, n int) []T {
+	t.Helper()
+	var got []T
+	for range n {
+		select {
+		case ev := <-ch:
+			got = append(got, ev)
+		case <-time.After(time.Second):
+			t.Fatalf("received %d of %d events", len(got), n)
+		}
+	}
+	return got
+}
+
+func TestBusSlowSubscriberMissesNothing(t *testing.T) {
+	b := NewBus()
+
+	release := make(chan struct{})
+	got := make(chan Event, 3*backlogWarning)
+	b.Subscribe(func(ev Event) {
+		<-release
+		got <- ev
+	})
+
+	// Far more than the subscriber can take while it is blocked
+	const n = 3 * backlogWarning
+	published := make(chan struct{})
+	go func() {
+		for i := range n {
+			b.Publish(testEvent(i))
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Publish() waited for a blocked subscriber")
+	}
+
+	close(release)
+	for i, ev := range receive(t, got, n) {
+		if ev != testEvent(i) {
+			t.Fatalf("event %d = %v, want %d", i, ev, i)
+		}
+	}
+}
+
+func TestBusEverySubscriberGetsEveryEvent(t *testing.T) {
+	b := NewBus()
+	a, c := make(chan Event, 10), make(chan Event, 10)
+	b.Subscribe(func(ev Event) { a <- ev })
+	b.Subscribe(func(ev Event) { c <- ev })
+
+	for i := range 10 {
+		b.Publish(testEvent(i))
+	}
+	for _, ch := range []chan Event{a, c} {
+		for i, ev := range receive(t, ch, 10) {
+			if ev != testEvent(i) {
+				t.Errorf("event %d = %v, want %d", i, ev, i)
+			}
+		}
+	}
+}
+
+func TestBusHandlerMayPublish(t *testing.T) {
+	b := NewBus()
+	got := make(chan Event, 2)
+	b.Subscribe(func(ev Event) {
+		got <- ev
+		if ev == testEvent(1) {
+			b.Publish(testEvent(2))
+		}
+	})
+
+	b.Publish(testEvent(1))
+	if evs := receive(t, got, 2); evs[1] != testEvent(2) {
+		t.Errorf("events = %v", evs)
+	}
+}
+
+func TestOn(t *testing.T) {
+	b := NewBus()
+	got := make(chan otherEvent, 2)
+	On(b, func(ev otherEvent) { got <- ev })
+
+	b.Publish(testEvent(1))
+	b.Publish(otherEvent("a"))
+	b.Publish(testEvent(2))
+	b.Publish(otherEvent("b"))
+
+	if evs := receive(t, got, 2); evs[0] != "a" || evs[1] != "b" {
+		t.Errorf("events = %v, want [a b]", evs)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	b := NewBus()
+	got := make(chan Event, 10)
+	unsubscribe := b.Subscribe(func(ev Event) { got <- ev })
+
+	b.Publish(testEvent(1))
+	receive(t, got, 1)
+
+	unsubscribe()
+	unsubscribe() // safe to call twice
+	b.Publish(testEvent(2))
+
+	select {
+	case ev := <-got:
+		t.Errorf("received %v after unsubscribing", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,19 @@
+package foreground
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Window describes the application that owns the foreground window
+type Window struct {
+	PID     uint32 `json:"pid"`
+	ExePath string `json:"exePath"`
+	Title   string `json:"title"`
+}
+
+// ProcessName returns the executable name without extension, e.g. "valorant"
+func (w Window) ProcessName() string {
+	name := filepath.Base(w.ExePath)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
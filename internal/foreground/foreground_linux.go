@@ -0,0 +1,81 @@
+//go:build linux
+
+package foreground
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	windowIDRe = regexp.MustCompile(`window id # (0x[0-9a-fA-F]+)`)
+	pidRe      = regexp.MustCompile(`_NET_WM_PID\(CARDINAL\) = (\d+)`)
+	titleRe    = regexp.MustCompile(`_NET_WM_NAME\([^)]*\) = "(.*)"`)
+)
+
+// Current returns the window that currently has focus. It reads the
+// _NET_ACTIVE_WINDOW property of the X11 root window through xprop and
+// resolves the owning process through /proc.
+func Current() (Window, error) {
+	out, err := exec.Command("xprop", "-root", "_NET_ACTIVE_WINDOW").Output()
+	if err != nil {
+		return Window{}, fmt.Errorf("failed to query active window: %w", err)
+	}
+	m := windowIDRe.FindSubmatch(out)
+	if m == nil || string(m[1]) == "0x0" {
+		return Window{}, fmt.Errorf("no foreground window")
+	}
+
+	out, err = exec.Command("xprop", "-id", string(m[1]), "_NET_WM_PID", "_NET_WM_NAME").Output()
+	if err != nil {
+		return Window{}, fmt.Errorf("failed to query window properties: %w", err)
+	}
+
+	var w Window
+	if t := titleRe.FindSubmatch(out); t != nil {
+		w.Title = string(t[1])
+	}
+	p := pidRe.FindSubmatch(out)
+	if p == nil {
+		return w, fmt.Errorf("failed to get window process")
+	}
+	pid, _ := strconv.ParseUint(string(p[1]), 10, 32)
+	w.PID = uint32(pid)
+
+	exe, err := os.Readlink(filepath.Join("/proc", string(p[1]), "exe"))
+	if err != nil {
+		return w, fmt.Errorf("failed to resolve process executable: %w", err)
+	}
+	w.ExePath = exe
+
+	return w, nil
+}
+
+// Processes returns the names of all running processes
+func Processes() ([]string, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read processes: %w", err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		// comm is truncated to 15 characters, prefer the executable
+		if exe, err := os.Readlink(filepath.Join("/proc", e.Name(), "exe")); err == nil {
+			names = append(names, Window{ExePath: exe}.ProcessName())
+			continue
+		}
+		if comm, err := os.ReadFile(filepath.Join("/proc", e.Name(), "comm")); err == nil {
+			names = append(names, strings.TrimSpace(string(comm)))
+		}
+	}
+	return names, nil
+}
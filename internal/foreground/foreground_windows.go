@@ -0,0 +1,81 @@
+//go:build windows
+
+package foreground
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	user32   = syscall.NewLazyDLL("user32.dll")
+	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	procGetForegroundWindow        = user32.NewProc("GetForegroundWindow")
+	procGetWindowTextW             = user32.NewProc("GetWindowTextW")
+	procGetWindowThreadProcessId   = user32.NewProc("GetWindowThreadProcessId")
+	procQueryFullProcessImageNameW = kernel32.NewProc("QueryFullProcessImageNameW")
+)
+
+const processQueryLimitedInformation = 0x1000
+
+// Processes returns the names of all running processes, without extension
+func Processes() ([]string, error) {
+	snap, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot processes: %w", err)
+	}
+	defer syscall.CloseHandle(snap)
+
+	var entry syscall.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	if err := syscall.Process32First(snap, &entry); err != nil {
+		return nil, fmt.Errorf("failed to read processes: %w", err)
+	}
+
+	var names []string
+	for {
+		exe := syscall.UTF16ToString(entry.ExeFile[:])
+		names = append(names, Window{ExePath: exe}.ProcessName())
+		if err := syscall.Process32Next(snap, &entry); err != nil {
+			break
+		}
+	}
+	return names, nil
+}
+
+// Current returns the window that currently has focus
+func Current() (Window, error) {
+	hwnd, _, _ := procGetForegroundWindow.Call()
+	if hwnd == 0 {
+		return Window{}, fmt.Errorf("no foreground window")
+	}
+
+	var w Window
+
+	title := make([]uint16, 512)
+	n, _, _ := procGetWindowTextW.Call(hwnd, uintptr(unsafe.Pointer(&title[0])), uintptr(len(title)))
+	w.Title = syscall.UTF16ToString(title[:n])
+
+	procGetWindowThreadProcessId.Call(hwnd, uintptr(unsafe.Pointer(&w.PID)))
+	if w.PID == 0 {
+		return w, fmt.Errorf("failed to get window process")
+	}
+
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, w.PID)
+	if err != nil {
+		return w, fmt.Errorf("failed to open process: %w", err)
+	}
+	defer syscall.CloseHandle(h)
+
+	path := make([]uint16, syscall.MAX_PATH)
+	size := uint32(len(path))
+	ret, _, err := procQueryFullProcessImageNameW.Call(uintptr(h), 0, uintptr(unsafe.Pointer(&path[0])), uintptr(unsafe.Pointer(&size)))
+	if ret == 0 {
+		return w, fmt.Errorf("failed to query process image: %w", err)
+	}
+	w.ExePath = syscall.UTF16ToString(path[:size])
+
+	return w, nil
+}
@@ -0,0 +1,257 @@
+package foreground
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rule applies a profile while a matching window has focus
+type Rule struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Process string `json:"process,omitempty"` // glob on the process name, e.g. "cs2" or "*valorant*"
+	Title   string `json:"title,omitempty"`   // substring of the window title
+	Profile string `json:"profile,omitempty"` // profile to apply, "" = keep the current one
+
+	// AutoRecord starts recording while the process runs, whether or not it
+	// has focus, and stops it when the process exits. Requires Process.
+	AutoRecord bool `json:"autoRecord,omitempty"`
+}
+
+// Validate checks that the rule can match something
+func (r Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule name must not be empty")
+	}
+	if r.Process == "" && r.Title == "" {
+		return fmt.Errorf("rule %q: process or title is required", r.Name)
+	}
+	if _, err := filepath.Match(strings.ToLower(r.Process), ""); err != nil {
+		return fmt.Errorf("rule %q: invalid process pattern: %w", r.Name, err)
+	}
+	if r.AutoRecord && r.Process == "" {
+		return fmt.Errorf("rule %q: auto-record requires a process", r.Name)
+	}
+	return nil
+}
+
+// matchProcess reports whether a process name matches the rule's pattern
+func (r Rule) matchProcess(name string) bool {
+	ok, _ := filepath.Match(strings.ToLower(r.Process), strings.ToLower(name))
+	return ok
+}
+
+// Matches reports whether the window satisfies every condition of the rule
+func (r Rule) Matches(w Window) bool {
+	if r.Process != "" && !r.matchProcess(w.ProcessName()) {
+		return false
+	}
+	if r.Title != "" && !strings.Contains(strings.ToLower(w.Title), strings.ToLower(r.Title)) {
+		return false
+	}
+	return true
+}
+
+// Settings configures automatic profile switching
+type Settings struct {
+	Enabled        bool   `json:"enabled"`
+	DebounceSec    int    `json:"debounceSec"`              // how long a match must hold before it is applied
+	DefaultProfile string `json:"defaultProfile,omitempty"` // applied when no rule matches, "" = keep the current one
+	Rules          []Rule `json:"rules"`
+}
+
+// DefaultSettings returns the settings used when none are configured
+func DefaultSettings() Settings {
+	return Settings{DebounceSec: 3}
+}
+
+// Validate checks the settings and every rule
+func (s Settings) Validate() error {
+	if s.DebounceSec < 0 || s.DebounceSec > 600 {
+		return fmt.Errorf("debounce must be between 0 and 600 seconds")
+	}
+	for _, r := range s.Rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decision is the outcome of evaluating the rules
+type Decision struct {
+	Rule    string `json:"rule,omitempty"`    // matching focus rule, "" if none
+	Profile string `json:"profile,omitempty"` // profile to apply, "" = keep the current one
+	Game    string `json:"game,omitempty"`    // first running auto-record rule, "" if none
+	Window  Window `json:"window"`
+}
+
+// key identifies the parts of a decision that trigger actions
+func (d Decision) key() string {
+	return d.Rule + "\x00" + d.Profile + "\x00" + d.Game
+}
+
+// Evaluate applies the rules to the focused window and the running processes
+func (s Settings) Evaluate(w Window, processes []string) Decision {
+	d := Decision{Window: w, Profile: s.DefaultProfile}
+
+	for _, r := range s.Rules {
+		if r.Enabled && r.Matches(w) {
+			d.Rule = r.Name
+			d.Profile = r.Profile
+			break
+		}
+	}
+
+	for _, r := range s.Rules {
+		if !r.Enabled || !r.AutoRecord {
+			continue
+		}
+		for _, p := range processes {
+			if r.matchProcess(p) {
+				d.Game = r.Name
+				break
+			}
+		}
+		if d.Game != "" {
+			break
+		}
+	}
+
+	return d
+}
+
+// Watcher polls the foreground window and reports debounced decisions
+type Watcher struct {
+	Interval time.Duration
+
+	// OnChange is called from the watcher goroutine whenever a new
+	// decision has held for the debounce period
+	OnChange func(Decision)
+
+	// current and processes read the system, see Current and Processes
+	current   func() (Window, error)
+	processes func() ([]string, error)
+
+	mu       sync.Mutex
+	settings Settings
+	stop     chan struct{}
+
+	applied      *Decision
+	pending      string
+	pendingSince time.Time
+}
+
+// NewWatcher creates a stopped watcher
+func NewWatcher() *Watcher {
+	return &Watcher{Interval: time.Second, current: Current, processes: Processes}
+}
+
+// SetSettings replaces the rules. When they changed, the next decision is
+// reported even if it matches the previous one.
+func (w *Watcher) SetSettings(s Settings) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if reflect.DeepEqual(w.settings, s) {
+		return
+	}
+	w.settings = s
+	w.applied = nil
+	w.pending = ""
+}
+
+// Start begins polling. It does nothing if the watcher is running.
+func (w *Watcher) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stop != nil {
+		return
+	}
+	w.stop = make(chan struct{})
+	go w.run(w.stop)
+}
+
+// Stop ends polling. It does not wait, so a poll in progress may still
+// report its decision.
+func (w *Watcher) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stop == nil {
+		return
+	}
+	close(w.stop)
+	w.stop = nil
+	w.applied = nil
+	w.pending = ""
+}
+
+func (w *Watcher) run(stop chan struct{}) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.poll(time.Now())
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll evaluates the rules once and fires OnChange when a decision that
+// differs from the applied one has been stable for the debounce period
+func (w *Watcher) poll(now time.Time) {
+	w.mu.Lock()
+	settings := w.settings
+	w.mu.Unlock()
+
+	win, err := w.current()
+	if err != nil {
+		// Keep the current decision while nothing has focus, e.g. during
+		// a UAC prompt or while switching desktops
+		slog.Debug("failed to get foreground window", "error", err)
+		return
+	}
+
+	var processes []string
+	for _, r := range settings.Rules {
+		if r.Enabled && r.AutoRecord {
+			if processes, err = w.processes(); err != nil {
+				slog.Debug("failed to list processes", "error", err)
+			}
+			break
+		}
+	}
+
+	d := settings.Evaluate(win, processes)
+	key := d.key()
+
+	w.mu.Lock()
+	if w.applied != nil && w.applied.key() == key {
+		w.pending = ""
+		w.mu.Unlock()
+		return
+	}
+	if w.pending != key {
+		w.pending = key
+		w.pendingSince = now
+	}
+	debounce := time.Duration(settings.DebounceSec) * time.Second
+	if now.Sub(w.pendingSince) < debounce {
+		w.mu.Unlock()
+		return
+	}
+	w.applied = &d
+	w.pending = ""
+	w.mu.Unlock()
+
+	if w.OnChange != nil {
+		w.OnChange(d)
+	}
+}
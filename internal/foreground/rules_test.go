@@ -0,0 +1,201 @@
+package foreground
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRuleMatches(t *testing.T) {
+	win := Window{ExePath: "C:/Games/Valorant/VALORANT-Win64-Shipping.exe", Title: "VALORANT  "}
+
+	tests := []struct {
+		name string
+		rule Rule
+		want bool
+	}{
+		{name: "exact process", rule: Rule{Process: "valorant-win64-shipping"}, want: true},
+		{name: "glob", rule: Rule{Process: "*valorant*"}, want: true},
+		{name: "process case", rule: Rule{Process: "VALORANT-WIN64-SHIPPING"}, want: true},
+		{name: "extension is not part of the name", rule: Rule{Process: "*.exe"}},
+		{name: "other process", rule: Rule{Process: "cs2"}},
+		{name: "title substring", rule: Rule{Title: "lora"}, want: true},
+		{name: "other title", rule: Rule{Title: "counter-strike"}},
+		{name: "process and title", rule: Rule{Process: "valorant*", Title: "valorant"}, want: true},
+		{name: "process but not title", rule: Rule{Process: "valorant*", Title: "lobby"}},
+		{name: "title but not process", rule: Rule{Process: "cs2", Title: "valorant"}},
+		{name: "invalid pattern", rule: Rule{Process: "[valorant"}},
+	}
+
+	for _, tt := range tests {
+		if got := tt.rule.Matches(win); got != tt.want {
+			t.Errorf("%s: Matches() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	game := Window{ExePath: "C:/Games/cs2.exe", Title: "Counter-Strike 2"}
+	browser := Window{ExePath: "C:/Program Files/firefox.exe", Title: "Twitch - Mozilla Firefox"}
+
+	s := Settings{
+		DefaultProfile: "Desktop",
+		Rules: []Rule{
+			{Name: "disabled", Process: "cs2", Profile: "Off"},
+			{Name: "cs2", Enabled: true, Process: "cs2", Profile: "Shooters", AutoRecord: true},
+			{Name: "any cs", Enabled: true, Title: "counter-strike", Profile: "Generic"},
+			{Name: "twitch", Enabled: true, Title: "twitch"},
+			{Name: "valorant", Enabled: true, Process: "valorant*", AutoRecord: true},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		win       Window
+		processes []string
+		want      Decision
+	}{
+		{
+			name: "first enabled rule wins",
+			win:  game,
+			want: Decision{Rule: "cs2", Profile: "Shooters"},
+		},
+		{
+			name: "rule without profile keeps the current one",
+			win:  browser,
+			want: Decision{Rule: "twitch"},
+		},
+		{
+			name: "default profile",
+			win:  Window{ExePath: "C:/Windows/explorer.exe"},
+			want: Decision{Profile: "Desktop"},
+		},
+		{
+			name:      "game runs in the background",
+			win:       browser,
+			processes: []string{"explorer", "VALORANT-Win64-Shipping"},
+			want:      Decision{Rule: "twitch", Game: "valorant"},
+		},
+		{
+			name:      "first running auto-record rule wins",
+			win:       browser,
+			processes: []string{"valorant", "cs2"},
+			want:      Decision{Rule: "twitch", Game: "cs2"},
+		},
+	}
+
+	for _, tt := range tests {
+		got := s.Evaluate(tt.win, tt.processes)
+		tt.want.Window = tt.win
+		if got != tt.want {
+			t.Errorf("%s: Evaluate() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// fakeSystem replaces the foreground window and process list of a watcher
+type fakeSystem struct {
+	win       Window
+	err       error
+	processes []string
+	listed    int
+}
+
+func newTestWatcher(s Settings) (*Watcher, *fakeSystem, *[]Decision) {
+	sys := &fakeSystem{}
+	var got []Decision
+	w := NewWatcher()
+	w.current = func() (Window, error) { return sys.win, sys.err }
+	w.processes = func() ([]string, error) {
+		sys.listed++
+		return sys.processes, nil
+	}
+	w.OnChange = func(d Decision) { got = append(got, d) }
+	w.SetSettings(s)
+	return w, sys, &got
+}
+
+func TestWatcherDebounce(t *testing.T) {
+	w, sys, got := newTestWatcher(Settings{
+		DebounceSec: 3,
+		Rules: []Rule{
+			{Name: "cs2", Enabled: true, Process: "cs2", Profile: "Shooters"},
+			{Name: "editor", Enabled: true, Process: "code", Profile: "Work"},
+		},
+	})
+	game := Window{ExePath: "cs2.exe"}
+	editor := Window{ExePath: "code.exe"}
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		after time.Duration
+		win   Window
+		err   error
+		want  string // rule reported by this poll, "-" for none
+	}{
+		{after: 0, win: game, want: "-"},
+		{after: 2 * time.Second, win: game, want: "-"},
+		{after: 3 * time.Second, win: game, want: "cs2"},
+		{after: 10 * time.Second, win: game, want: "-"}, // already applied
+		// A short alt-tab resets the timer and changes nothing
+		{after: 11 * time.Second, win: editor, want: "-"},
+		{after: 12 * time.Second, win: game, want: "-"},
+		{after: 15 * time.Second, win: game, want: "-"},
+		// The timer restarts when the pending decision changes
+		{after: 20 * time.Second, win: editor, want: "-"},
+		{after: 22 * time.Second, win: Window{ExePath: "explorer.exe"}, want: "-"},
+		{after: 24 * time.Second, win: editor, want: "-"},
+		{after: 26 * time.Second, win: editor, want: "-"},
+		// Nothing focused keeps the pending decision
+		{after: 26500 * time.Millisecond, err: errors.New("no window"), want: "-"},
+		{after: 27 * time.Second, win: editor, want: "editor"},
+	}
+
+	for i, step := range steps {
+		sys.win, sys.err = step.win, step.err
+		before := len(*got)
+		w.poll(t0.Add(step.after))
+
+		rule := "-"
+		if len(*got) > before {
+			rule = (*got)[len(*got)-1].Rule
+		}
+		if rule != step.want {
+			t.Errorf("step %d (%s): reported %q, want %q", i, step.after, rule, step.want)
+		}
+	}
+	if sys.listed != 0 {
+		t.Errorf("listed processes %d times without auto-record rules", sys.listed)
+	}
+}
+
+func TestWatcherReportsAfterSettingsChange(t *testing.T) {
+	s := Settings{Rules: []Rule{{Name: "cs2", Enabled: true, Process: "cs2", AutoRecord: true}}}
+	w, sys, got := newTestWatcher(s)
+	sys.win = Window{ExePath: "explorer.exe"}
+	sys.processes = []string{"cs2"}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	w.poll(now)
+	w.poll(now.Add(time.Second))
+	if len(*got) != 1 || (*got)[0].Game != "cs2" {
+		t.Fatalf("decisions = %+v, want one with game cs2", *got)
+	}
+	if sys.listed != 2 {
+		t.Errorf("listed processes %d times, want 2", sys.listed)
+	}
+
+	// Unchanged settings keep the applied decision
+	w.SetSettings(s)
+	w.poll(now.Add(2 * time.Second))
+	if len(*got) != 1 {
+		t.Errorf("decision reported again after unchanged settings: %+v", *got)
+	}
+
+	s.DefaultProfile = "Desktop"
+	w.SetSettings(s)
+	w.poll(now.Add(3 * time.Second))
+	if len(*got) != 2 || (*got)[1].Profile != "Desktop" {
+		t.Errorf("decisions = %+v, want a new one with the default profile", *got)
+	}
+}
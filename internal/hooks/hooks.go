@@ -0,0 +1,268 @@
+// Package hooks runs user-configured actions after a clip has been saved:
+// external commands that get the clip as JSON on stdin, and HTTP webhooks.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"rewind/internal/capture"
+	"rewind/internal/utils"
+)
+
+const (
+	TypeCommand = "command"
+	TypeWebhook = "webhook"
+
+	defaultTimeout = 30 * time.Second
+	maxRetries     = 5
+	maxOutput      = 4096
+
+	// waitDelay is how long a killed command may hold its output open
+	waitDelay = 2 * time.Second
+)
+
+// retryBackoff is the pause before the first retry; it doubles after each
+var retryBackoff = time.Second
+
+// Hook is one configured action
+type Hook struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"` // "command" or "webhook"
+	Enabled    bool              `json:"enabled"`
+	Command    string            `json:"command,omitempty"` // executable for command hooks
+	Args       []string          `json:"args,omitempty"`    // "{path}" is replaced by the clip path
+	URL        string            `json:"url,omitempty"`     // target of webhook hooks
+	Headers    map[string]string `json:"headers,omitempty"`
+	TimeoutSec int               `json:"timeoutSec"` // per attempt, 0 = 30s
+	Retries    int               `json:"retries"`    // extra attempts after a failure
+}
+
+// Validate checks that a hook can be run
+func (h Hook) Validate() error {
+	if h.Name == "" {
+		return fmt.Errorf("hook name must not be empty")
+	}
+	if h.TimeoutSec < 0 {
+		return fmt.Errorf("hook %q: timeout must not be negative", h.Name)
+	}
+	if h.Retries < 0 || h.Retries > maxRetries {
+		return fmt.Errorf("hook %q: retries must be between 0 and %d", h.Name, maxRetries)
+	}
+
+	switch h.Type {
+	case TypeCommand:
+		if h.Command == "" {
+			return fmt.Errorf("hook %q: command must not be empty", h.Name)
+		}
+	case TypeWebhook:
+		u, err := url.Parse(h.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("hook %q: invalid URL: %s", h.Name, h.URL)
+		}
+	default:
+		return fmt.Errorf("hook %q: unknown type: %s", h.Name, h.Type)
+	}
+	return nil
+}
+
+func (h Hook) timeout() time.Duration {
+	if h.TimeoutSec > 0 {
+		return time.Duration(h.TimeoutSec) * time.Second
+	}
+	return defaultTimeout
+}
+
+// Event is what hooks receive about a saved clip
+type Event struct {
+	Path        string                `json:"path"`
+	Name        string                `json:"name"`
+	Size        int64                 `json:"size"`
+	IsRawFolder bool                  `json:"isRawFolder"`
+	SavedAt     time.Time             `json:"savedAt"`
+	Metadata    *capture.ClipMetadata `json:"metadata,omitempty"`
+}
+
+// Result reports how a hook run went
+type Result struct {
+	Hook     string        `json:"hook"`
+	Path     string        `json:"path"`
+	Attempts int           `json:"attempts"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	Output   string        `json:"output,omitempty"` // command output or response body, truncated
+}
+
+// Runner runs the configured hooks for every saved clip in the background
+type Runner struct {
+	hooks []Hook
+	mu    sync.RWMutex
+
+	// OnResult is called after each hook has finished all attempts
+	OnResult func(Result)
+}
+
+func NewRunner() *Runner {
+	return &Runner{}
+}
+
+// SetHooks replaces the configured hooks
+func (r *Runner) SetHooks(hooks []Hook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append([]Hook(nil), hooks...)
+}
+
+// Run starts all enabled hooks for ev; it does not wait for them
+func (r *Runner) Run(ev Event) {
+	r.mu.RLock()
+	hooks := r.hooks
+	r.mu.RUnlock()
+
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		slog.Error("failed to encode hook event", "error", err)
+		return
+	}
+
+	for _, h := range hooks {
+		if !h.Enabled {
+			continue
+		}
+		go r.runHook(h, ev.Path, payload)
+	}
+}
+
+// runHook runs h until it succeeds or its retries are used up, backing off
+// between attempts
+func (r *Runner) runHook(h Hook, path string, payload []byte) {
+	res := Result{Hook: h.Name, Path: path}
+	started := time.Now()
+	backoff := retryBackoff
+
+	var err error
+	for attempt := 0; attempt <= h.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		res.Attempts++
+
+		switch h.Type {
+		case TypeCommand:
+			res.Output, err = runCommand(h, path, payload)
+		case TypeWebhook:
+			res.Output, err = postWebhook(h, payload)
+		default:
+			err = fmt.Errorf("unknown hook type: %s", h.Type)
+		}
+		if err == nil {
+			break
+		}
+		slog.Warn("hook attempt failed", "hook", h.Name, "attempt", res.Attempts, "error", err)
+	}
+
+	res.Duration = time.Since(started)
+	if err != nil {
+		res.Error = err.Error()
+		slog.Error("hook failed", "hook", h.Name, "path", path, "attempts", res.Attempts, "error", err)
+	} else {
+		slog.Info("hook finished", "hook", h.Name, "path", path, "attempts", res.Attempts, "duration", res.Duration)
+	}
+
+	if r.OnResult != nil {
+		r.OnResult(res)
+	}
+}
+
+// runCommand starts the hook command with the event JSON on stdin and kills
+// it when the timeout passes. Children that keep its output open are not
+// waited for longer than waitDelay.
+func runCommand(h Hook, path string, payload []byte) (string, error) {
+	args := make([]string, len(h.Args))
+	for i, a := range h.Args {
+		args[i] = strings.ReplaceAll(a, "{path}", path)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout())
+	defer cancel()
+
+	cmd := utils.CommandContext(ctx, h.Command, args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(), "REWIND_CLIP_PATH="+path)
+	cmd.WaitDelay = waitDelay
+
+	out := &limitedBuffer{max: maxOutput}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	err := cmd.Run()
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		err = fmt.Errorf("timed out after %s", h.timeout())
+	case errors.Is(err, exec.ErrWaitDelay):
+		err = nil // exited fine, but left a child running with its output
+	}
+	return truncate(out.String()), err
+}
+
+// limitedBuffer keeps the first max bytes written to it and drops the rest
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// postWebhook sends the event JSON to the hook URL; non-2xx is a failure
+func postWebhook(h Hook, payload []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Rewind/"+utils.AppVersion)
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxOutput))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return truncate(string(body)), fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return truncate(string(body)), nil
+}
+
+func truncate(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > maxOutput {
+		return s[:maxOutput]
+	}
+	return s
+}
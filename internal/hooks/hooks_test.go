@@ -0,0 +1,202 @@
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The test binary doubles as the hook command, see helper
+func TestMain(m *testing.M) {
+	if os.Getenv("REWIND_HOOK_HELPER") == "1" {
+		os.Exit(helper(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+func helper(args []string) int {
+	switch args[0] {
+	case "echo":
+		var ev Event
+		if err := json.NewDecoder(os.Stdin).Decode(&ev); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		fmt.Printf("args=%s env=%s stdin=%s", strings.Join(args[1:], ","), os.Getenv("REWIND_CLIP_PATH"), ev.Path)
+	case "fail":
+		fmt.Print("failed")
+		return 3
+	case "spam":
+		fmt.Print(strings.Repeat("x", 1<<20))
+	case "sleep":
+		time.Sleep(5 * time.Second)
+	case "orphan":
+		// The child inherits stdout and outlives its parent
+		child := exec.Command(os.Args[0], "sleep")
+		child.Stdout = os.Stdout
+		if err := child.Start(); err != nil {
+			return 1
+		}
+		time.Sleep(time.Minute)
+	}
+	return 0
+}
+
+// helperHook runs the test binary as a command hook. The timeout is
+// generous, since the binary starts slowly under the race detector; tests
+// of the timeout lower it.
+func helperHook(t *testing.T, args ...string) Hook {
+	t.Helper()
+	t.Setenv("REWIND_HOOK_HELPER", "1")
+	return Hook{Name: "test", Type: TypeCommand, Enabled: true, Command: os.Args[0], Args: args, TimeoutSec: 30}
+}
+
+func TestRunCommand(t *testing.T) {
+	path := `C:\clips\clip 1.mp4`
+	payload, _ := json.Marshal(Event{Path: path})
+
+	tests := []struct {
+		name    string
+		args    []string
+		timeout int
+		want    string
+		wantErr string
+	}{
+		{
+			name: "path substituted",
+			args: []string{"echo", "--file={path}", "{path}", "plain"},
+			want: "args=--file=" + path + "," + path + ",plain env=" + path + " stdin=" + path,
+		},
+		{name: "exit status", args: []string{"fail"}, want: "failed", wantErr: "exit status 3"},
+		{name: "output capped", args: []string{"spam"}, want: strings.Repeat("x", maxOutput)},
+		{name: "timeout", args: []string{"sleep"}, timeout: 1, wantErr: "timed out after 1s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := helperHook(t, tt.args...)
+			if tt.timeout > 0 {
+				h.TimeoutSec = tt.timeout
+			}
+			out, err := runCommand(h, path, payload)
+			if out != tt.want {
+				t.Errorf("output = %.100q, want %.100q", out, tt.want)
+			}
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunCommandOrphanHoldsOutput(t *testing.T) {
+	h := helperHook(t, "orphan")
+	h.TimeoutSec = 1
+
+	start := time.Now()
+	_, err := runCommand(h, "clip.mp4", []byte("{}"))
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("error = %v, want a timeout", err)
+	}
+	if elapsed, limit := time.Since(start), h.timeout()+waitDelay+2*time.Second; elapsed > limit {
+		t.Errorf("runCommand() took %s, want at most %s", elapsed, limit)
+	}
+}
+
+func TestRunHookRetries(t *testing.T) {
+	old := retryBackoff
+	retryBackoff = time.Millisecond
+	t.Cleanup(func() { retryBackoff = old })
+
+	tests := []struct {
+		name         string
+		args         []string
+		retries      int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "success", args: []string{"echo"}, retries: 3, wantAttempts: 1},
+		{name: "no retries", args: []string{"fail"}, wantAttempts: 1, wantErr: true},
+		{name: "all retries used", args: []string{"fail"}, retries: 2, wantAttempts: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := helperHook(t, tt.args...)
+			h.Retries = tt.retries
+
+			var got Result
+			r := NewRunner()
+			r.OnResult = func(res Result) { got = res }
+			r.runHook(h, "clip.mp4", []byte(`{"path":"clip.mp4"}`))
+
+			if got.Attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got.Attempts, tt.wantAttempts)
+			}
+			if (got.Error != "") != tt.wantErr {
+				t.Errorf("error = %q, want error %v", got.Error, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPostWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{name: "ok", status: http.StatusOK, body: "thanks"},
+		{name: "no content", status: http.StatusNoContent},
+		{name: "server error", status: http.StatusInternalServerError, body: "broken", wantErr: "500"},
+		{name: "not modified", status: http.StatusNotModified, wantErr: "304"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits.Add(1)
+				if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("request = %s %s", r.Method, r.Header.Get("Content-Type"))
+				}
+				if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+					t.Errorf("Authorization = %q", got)
+				}
+				if body, _ := io.ReadAll(r.Body); string(body) != `{"path":"clip.mp4"}` {
+					t.Errorf("body = %s", body)
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			h := Hook{Name: "hook", Type: TypeWebhook, URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer secret"}}
+			out, err := postWebhook(h, []byte(`{"path":"clip.mp4"}`))
+			if out != tt.body {
+				t.Errorf("output = %q, want %q", out, tt.body)
+			}
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+			if hits.Load() != 1 {
+				t.Errorf("server hit %d times, want 1", hits.Load())
+			}
+		})
+	}
+}
@@ -23,6 +23,7 @@ const (
 	ModShift   = 0x0004
 	ModWin     = 0x0008
 
+	VkF8  = 0x77
 	VkF9  = 0x78
 	VkF10 = 0x79
 
@@ -71,6 +72,13 @@ func (h *HotkeyManager) loop() {
 		slog.Info("Registered global hotkey: Ctrl+F10 (Save Clip)")
 	}
 
+	if err := registerHotKey(0, 3, ModControl, VkF8); err != nil {
+		slog.Error("failed to register Ctrl+F8", "error", err)
+	} else {
+		defer unregisterHotKey(0, 3)
+		slog.Info("Registered global hotkey: Ctrl+F8 (Drop Marker)")
+	}
+
 	// Message loop
 	var msg msg
 	for {
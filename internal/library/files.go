@@ -0,0 +1,93 @@
+package library
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"rewind/internal/capture"
+)
+
+// companions pairs the files that belong to a clip at src with where they
+// go when the clip moves to dst: the JSON sidecar, previews and the sources
+// kept for a broken clip
+func companions(src, dst string) [][2]string {
+	return [][2]string{
+		{src + ".json", dst + ".json"},
+		{capture.PreviewDir(src), capture.PreviewDir(dst)},
+		{capture.SourcesDir(src), capture.SourcesDir(dst)},
+	}
+}
+
+// MoveClip moves a clip file or raw folder together with its companion
+// files. dst must not exist, unless it only differs from src in case.
+func MoveClip(src, dst string) error {
+	if _, err := os.Lstat(dst); err == nil && !strings.EqualFold(src, dst) {
+		return fmt.Errorf("%s already exists", filepath.Base(dst))
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create folder: %w", err)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return err
+	}
+
+	for _, c := range companions(src, dst) {
+		if _, err := os.Lstat(c[0]); err != nil {
+			continue
+		}
+		// A companion left behind only costs regenerated previews or a
+		// missing sidecar, so the move itself still succeeds
+		if err := os.MkdirAll(filepath.Dir(c[1]), os.ModePerm); err != nil {
+			slog.Warn("failed to move clip companion", "path", c[0], "error", err)
+			continue
+		}
+		if err := os.Rename(c[0], c[1]); err != nil {
+			slog.Warn("failed to move clip companion", "path", c[0], "error", err)
+		}
+	}
+	return nil
+}
+
+// RemoveClip deletes a clip together with its companion files
+func RemoveClip(path string) error {
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	for _, c := range companions(path, path) {
+		os.RemoveAll(c[0])
+	}
+	return nil
+}
+
+// WithinLibrary checks that rel, relative to the output directory, neither
+// escapes it nor points into one of the app's hidden folders
+func WithinLibrary(rel string) error {
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return fmt.Errorf("path is outside the output directory")
+	}
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if strings.HasPrefix(part, ".") {
+			return fmt.Errorf("path is outside the clip library")
+		}
+	}
+	return nil
+}
+
+// availablePath returns path, or path with a numeric suffix if it is taken
+func availablePath(path string) string {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+	base := path[:len(path)-len(ext)]
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s_%d%s", base, i, ext)
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
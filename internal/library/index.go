@@ -0,0 +1,348 @@
+package library
+
+import (
+	"encoding/json"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"rewind/internal/capture"
+)
+
+// IndexDirName holds the library index inside the output directory; like
+// other dot folders it is not listed as a clip
+const IndexDirName = ".library"
+
+const (
+	indexFile    = "index.json"
+	indexVersion = 1
+
+	// resyncAfter bounds how long SyncIfStale trusts a clean index. Folder
+	// modification times reveal added, removed and renamed clips, but not
+	// clips or sidecars edited in place.
+	resyncAfter = time.Minute
+)
+
+// entry is the indexed state of one clip. Size and the modification times
+// detect changes, so metadata is only read again for clips that changed.
+// The size of a raw folder is recomputed on every sync, as its files grow
+// without changing the folder's modification time.
+type entry struct {
+	Path        string                `json:"path"` // relative to the root, slash separated
+	IsRawFolder bool                  `json:"isRawFolder,omitempty"`
+	Size        int64                 `json:"size"`
+	ModTime     time.Time             `json:"modTime"`
+	MetaModTime time.Time             `json:"metaModTime,omitempty"` // zero = no metadata
+	Metadata    *capture.ClipMetadata `json:"metadata,omitempty"`
+}
+
+type indexDoc struct {
+	Version int      `json:"version"`
+	Clips   []*entry `json:"clips"`
+}
+
+// Item is a clip as returned by queries
+type Item struct {
+	Path        string // absolute
+	Name        string // file or folder name
+	Folder      string // relative to the root, "" = top level
+	IsRawFolder bool
+	Size        int64
+	Time        time.Time // creation time, or modification time without metadata
+	Metadata    *capture.ClipMetadata
+}
+
+// Index caches the clips of an output directory on disk
+type Index struct {
+	root string
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	stale   bool                 // the filesystem may have changed since the last Sync
+	dirs    map[string]time.Time // modification times of the scanned folders, "." = root
+	synced  time.Time
+}
+
+// Open loads the index of root. A missing or unreadable index starts
+// empty and is rebuilt by the next Sync. A new index is stale, so the
+// first SyncIfStale scans the directory.
+func Open(root string) *Index {
+	x := &Index{root: root, entries: map[string]*entry{}, stale: true}
+
+	data, err := os.ReadFile(x.file())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("failed to read library index", "error", err)
+		}
+		return x
+	}
+
+	var doc indexDoc
+	if err := json.Unmarshal(data, &doc); err != nil || doc.Version != indexVersion {
+		slog.Warn("discarding library index", "version", doc.Version, "error", err)
+		return x
+	}
+	for _, e := range doc.Clips {
+		x.entries[e.Path] = e
+	}
+	return x
+}
+
+// Root returns the directory the index covers
+func (x *Index) Root() string {
+	return x.root
+}
+
+func (x *Index) file() string {
+	return filepath.Join(x.root, IndexDirName, indexFile)
+}
+
+// Sync brings the index up to date with the filesystem. Unchanged clips
+// cost a stat; only new and changed clips are read.
+func (x *Index) Sync() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	rootInfo, err := os.Stat(x.root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Stays stale, so the folder is scanned once it exists
+			clear(x.entries)
+			return nil
+		}
+		return err
+	}
+
+	seen := make(map[string]bool, len(x.entries))
+	dirs := map[string]time.Time{".": rootInfo.ModTime()}
+	var changed int
+
+	err = filepath.WalkDir(x.root, func(absPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip unreadable entries instead of failing the whole sync
+			slog.Debug("skipping clip path", "path", absPath, "error", err)
+			if d != nil && d.IsDir() && absPath != x.root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if absPath == x.root {
+			return nil
+		}
+
+		if d.IsDir() {
+			// .previews, .inflight, .library and other hidden folders
+			if strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(capture.MetadataPath(absPath)); err != nil {
+				// Not a raw clip, look inside
+				if info, err := d.Info(); err == nil {
+					dirs[x.rel(absPath)] = info.ModTime()
+				}
+				return nil
+			}
+		} else if !IsClipFile(d.Name()) {
+			return nil
+		}
+
+		rel := x.rel(absPath)
+		seen[rel] = true
+		if x.refresh(rel, absPath, d) {
+			changed++
+		}
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for rel := range x.entries {
+		if !seen[rel] {
+			delete(x.entries, rel)
+			changed++
+		}
+	}
+
+	x.stale = false
+	x.dirs = dirs
+	x.synced = time.Now()
+	if changed > 0 {
+		slog.Debug("library index updated", "changed", changed, "clips", len(x.entries))
+		if err := x.save(); err != nil {
+			slog.Warn("failed to save library index", "error", err)
+		}
+	}
+	return nil
+}
+
+// SyncIfStale syncs the index if it was never synced, has been invalidated
+// since, or the filesystem changed behind the app's back: a folder's
+// modification time moved, or the last sync is older than resyncAfter.
+// Otherwise queries are answered from memory at the cost of a stat per
+// folder.
+func (x *Index) SyncIfStale() error {
+	x.mu.Lock()
+	stale := x.stale || time.Since(x.synced) > resyncAfter || x.dirsChanged()
+	x.mu.Unlock()
+
+	if !stale {
+		return nil
+	}
+	return x.Sync()
+}
+
+// dirsChanged reports whether a scanned folder was modified or removed
+// since the last Sync, i.e. clips were added, removed or renamed in it.
+// Must be called with x.mu held.
+func (x *Index) dirsChanged() bool {
+	for rel, modTime := range x.dirs {
+		info, err := os.Stat(filepath.Join(x.root, filepath.FromSlash(rel)))
+		if err != nil || !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// Invalidate marks the index stale after clips were written, moved or
+// deleted, so the next SyncIfStale scans the directory again
+func (x *Index) Invalidate() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.stale = true
+}
+
+// Refresh re-reads one clip, e.g. after its metadata was changed
+func (x *Index) Refresh(absPath string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	rel := x.rel(absPath)
+	info, err := os.Stat(absPath)
+	if err != nil {
+		delete(x.entries, rel)
+	} else {
+		delete(x.entries, rel) // force a re-read
+		x.refresh(rel, absPath, fs.FileInfoToDirEntry(info))
+	}
+	if err := x.save(); err != nil {
+		slog.Warn("failed to save library index", "error", err)
+	}
+}
+
+// refresh updates the entry of a clip if it changed on disk and reports
+// whether it did. Must be called with x.mu held.
+func (x *Index) refresh(rel, absPath string, d fs.DirEntry) bool {
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+
+	var metaModTime time.Time
+	if metaInfo, err := os.Stat(capture.MetadataPath(absPath)); err == nil {
+		metaModTime = metaInfo.ModTime()
+	}
+
+	size := info.Size()
+	if d.IsDir() {
+		size = dirSize(absPath)
+	}
+
+	old := x.entries[rel]
+	if old != nil && old.ModTime.Equal(info.ModTime()) && old.MetaModTime.Equal(metaModTime) && old.Size == size {
+		return false
+	}
+
+	e := &entry{
+		Path:        rel,
+		IsRawFolder: d.IsDir(),
+		Size:        size,
+		ModTime:     info.ModTime(),
+		MetaModTime: metaModTime,
+	}
+	if !metaModTime.IsZero() {
+		if m, err := capture.ReadMetadata(absPath); err == nil {
+			e.Metadata = m
+		}
+	}
+	x.entries[rel] = e
+	return true
+}
+
+// save writes the index. Must be called with x.mu held.
+func (x *Index) save() error {
+	doc := indexDoc{Version: indexVersion, Clips: make([]*entry, 0, len(x.entries))}
+	for _, e := range x.entries {
+		doc.Clips = append(doc.Clips, e)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	path := x.file()
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (x *Index) rel(absPath string) string {
+	rel, err := filepath.Rel(x.root, absPath)
+	if err != nil {
+		return filepath.ToSlash(absPath)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// item converts an entry for callers
+func (x *Index) item(e *entry) Item {
+	it := Item{
+		Path:        filepath.Join(x.root, filepath.FromSlash(e.Path)),
+		Name:        filepath.Base(filepath.FromSlash(e.Path)),
+		IsRawFolder: e.IsRawFolder,
+		Size:        e.Size,
+		Time:        e.ModTime,
+		Metadata:    e.Metadata,
+	}
+	if dir := filepath.Dir(filepath.FromSlash(e.Path)); dir != "." {
+		it.Folder = dir
+	}
+	if e.Metadata != nil && !e.Metadata.CreatedAt.IsZero() {
+		it.Time = e.Metadata.CreatedAt
+	}
+	return it
+}
+
+// IsClipFile reports whether name has an extension listed as a clip
+func IsClipFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".mp4", ".ts", ".webm", ".gif", ".webp":
+		return true
+	}
+	return false
+}
+
+func dirSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, _ error) error {
+		if info != nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,126 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rewind/internal/capture"
+)
+
+func TestIndexSyncIfStale(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, data string) {
+		t.Helper()
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sync := func(x *Index) {
+		t.Helper()
+		if err := x.SyncIfStale(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sizes := func(x *Index) map[string]int64 {
+		x.mu.Lock()
+		defer x.mu.Unlock()
+		m := map[string]int64{}
+		for rel, e := range x.entries {
+			m[rel] = e.Size
+		}
+		return m
+	}
+	check := func(x *Index, step string, want map[string]int64) {
+		t.Helper()
+		got := sizes(x)
+		if len(got) != len(want) {
+			t.Fatalf("%s: indexed %v, want %v", step, got, want)
+		}
+		for rel, size := range want {
+			if got[rel] != size {
+				t.Fatalf("%s: indexed %v, want %v", step, got, want)
+			}
+		}
+	}
+
+	write("a.mp4", "clip")
+	write("games/b.mp4", "clip")
+	x := Open(root)
+	sync(x)
+	check(x, "first sync", map[string]int64{"a.mp4": 4, "games/b.mp4": 4})
+
+	// Clips added or removed by other programs are picked up through the
+	// folders' modification times
+	write("c.mp4", "clip")
+	sync(x)
+	check(x, "added at the top", map[string]int64{"a.mp4": 4, "games/b.mp4": 4, "c.mp4": 4})
+
+	os.Remove(filepath.Join(root, "games", "b.mp4"))
+	sync(x)
+	check(x, "removed from a folder", map[string]int64{"a.mp4": 4, "c.mp4": 4})
+
+	// An edit in place leaves the folder alone, so a clean index answers
+	// from memory until it is invalidated or too old
+	write("a.mp4", "longer clip")
+	sync(x)
+	check(x, "edited in place", map[string]int64{"a.mp4": 4, "c.mp4": 4})
+
+	x.mu.Lock()
+	x.synced = x.synced.Add(-resyncAfter - time.Second)
+	x.mu.Unlock()
+	sync(x)
+	check(x, "after resyncAfter", map[string]int64{"a.mp4": 11, "c.mp4": 4})
+
+	write("c.mp4", "longer clip")
+	x.Invalidate()
+	sync(x)
+	check(x, "invalidated", map[string]int64{"a.mp4": 11, "c.mp4": 11})
+
+	// A reopened index starts stale and sees changes made meanwhile
+	os.Remove(filepath.Join(root, "a.mp4"))
+	x = Open(root)
+	sync(x)
+	check(x, "reopened", map[string]int64{"c.mp4": 11})
+}
+
+func TestIndexRawFolderSize(t *testing.T) {
+	root := t.TempDir()
+	raw := filepath.Join(root, "raw_clip")
+	if err := os.MkdirAll(raw, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := capture.UpdateMetadata(raw, func(m *capture.ClipMetadata) { m.DurationSec = 10 }); err != nil {
+		t.Fatal(err)
+	}
+	segment := filepath.Join(raw, "video.ts")
+	if err := os.WriteFile(segment, make([]byte, 100), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	x := Open(root)
+	if err := x.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	before := x.Query(Query{}).Items[0].Size
+
+	// Files growing inside the folder leave its modification time alone
+	f, err := os.OpenFile(segment, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(make([]byte, 50))
+	f.Close()
+
+	if err := x.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if after := x.Query(Query{}).Items[0].Size; after != before+50 {
+		t.Errorf("raw folder size = %d after growing, want %d", after, before+50)
+	}
+}
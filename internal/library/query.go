@@ -0,0 +1,193 @@
+package library
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sort keys
+const (
+	SortDate     = "date"
+	SortName     = "name"
+	SortSize     = "size"
+	SortDuration = "duration"
+)
+
+// Query filters, sorts and pages the clips. The zero value returns every
+// clip, newest first.
+type Query struct {
+	Search    string    `json:"search,omitempty"` // words matched against name, title, notes, tags and app
+	Tags      []string  `json:"tags,omitempty"`   // clips must have all of them
+	Favorites bool      `json:"favorites,omitempty"`
+	Locked    bool      `json:"locked,omitempty"`
+	Folder    string    `json:"folder,omitempty"` // exact folder, "" = all
+	From      time.Time `json:"from,omitempty"`
+	To        time.Time `json:"to,omitempty"`
+	SortBy    string    `json:"sortBy,omitempty"` // see Sort*, default date
+	Ascending bool      `json:"ascending,omitempty"`
+	Offset    int       `json:"offset,omitempty"`
+	Limit     int       `json:"limit,omitempty"` // 0 = no limit
+}
+
+// Page is one page of query results
+type Page struct {
+	Items []Item
+	Total int // matches before paging
+}
+
+// TagCount is a tag and how many clips have it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// Query returns the indexed clips matching q. Call Sync first to pick up
+// changes on disk.
+func (x *Index) Query(q Query) Page {
+	x.mu.Lock()
+	items := make([]Item, 0, len(x.entries))
+	for _, e := range x.entries {
+		it := x.item(e)
+		if q.matches(it) {
+			items = append(items, it)
+		}
+	}
+	x.mu.Unlock()
+
+	sortItems(items, q.SortBy, q.Ascending)
+
+	page := Page{Total: len(items)}
+	start := min(max(q.Offset, 0), len(items))
+	end := len(items)
+	if q.Limit > 0 {
+		end = min(start+q.Limit, end)
+	}
+	page.Items = items[start:end]
+	return page
+}
+
+// Tags returns every tag in use, most used first
+func (x *Index) Tags() []TagCount {
+	x.mu.Lock()
+	counts := map[string]int{}
+	for _, e := range x.entries {
+		if e.Metadata == nil {
+			continue
+		}
+		for _, t := range e.Metadata.Tags {
+			counts[t]++
+		}
+	}
+	x.mu.Unlock()
+
+	tags := make([]TagCount, 0, len(counts))
+	for t, n := range counts {
+		tags = append(tags, TagCount{Tag: t, Count: n})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	return tags
+}
+
+func (q Query) matches(it Item) bool {
+	m := it.Metadata
+	if (q.Favorites || q.Locked || len(q.Tags) > 0) && m == nil {
+		return false
+	}
+	if q.Favorites && !m.Favorite {
+		return false
+	}
+	if q.Locked && !m.Locked {
+		return false
+	}
+	for _, tag := range q.Tags {
+		if !hasTag(m.Tags, tag) {
+			return false
+		}
+	}
+	if q.Folder != "" && !strings.EqualFold(q.Folder, it.Folder) {
+		return false
+	}
+	if !q.From.IsZero() && it.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !it.Time.Before(q.To) {
+		return false
+	}
+
+	if q.Search == "" {
+		return true
+	}
+	text := strings.ToLower(searchText(it))
+	for _, word := range strings.Fields(strings.ToLower(q.Search)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// searchText joins the searchable fields of a clip
+func searchText(it Item) string {
+	parts := []string{it.Name, it.Folder}
+	if m := it.Metadata; m != nil {
+		parts = append(parts, m.Title, m.Notes, m.ForegroundApp, m.WindowTitle)
+		parts = append(parts, m.Tags...)
+	}
+	return strings.Join(parts, "\n")
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortItems(items []Item, by string, ascending bool) {
+	var less func(a, b Item) bool
+	switch by {
+	case SortName:
+		less = func(a, b Item) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }
+	case SortSize:
+		less = func(a, b Item) bool { return a.Size < b.Size }
+	case SortDuration:
+		less = func(a, b Item) bool { return duration(a) < duration(b) }
+	default:
+		less = func(a, b Item) bool { return a.Time.Before(b.Time) }
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if ascending {
+			return less(items[i], items[j])
+		}
+		return less(items[j], items[i])
+	})
+}
+
+func duration(it Item) int {
+	if it.Metadata == nil {
+		return 0
+	}
+	return it.Metadata.DurationSec
+}
+
+// NormalizeTags trims tags and drops empty and duplicate ones, keeping the
+// first spelling
+func NormalizeTags(tags []string) []string {
+	var out []string
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t != "" && !hasTag(out, t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
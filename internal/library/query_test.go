@@ -0,0 +1,118 @@
+package library
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"rewind/internal/capture"
+)
+
+// testIndex returns an index of clips that exist only in memory
+func testIndex(entries ...*entry) *Index {
+	x := &Index{root: "/clips", entries: map[string]*entry{}}
+	for _, e := range entries {
+		x.entries[e.Path] = e
+	}
+	return x
+}
+
+func TestQuery(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 12, 0, 0, 0, time.UTC) }
+
+	x := testIndex(
+		&entry{Path: "ace.mp4", Size: 300, ModTime: day(9), Metadata: &capture.ClipMetadata{
+			CreatedAt: day(1), DurationSec: 30, Title: "Clutch ace", Tags: []string{"CS2", "Highlight"}, Favorite: true,
+		}},
+		&entry{Path: "Valorant/defuse.mp4", Size: 100, ModTime: day(2), Metadata: &capture.ClipMetadata{
+			CreatedAt: day(2), DurationSec: 60, ForegroundApp: "VALORANT", Notes: "ninja defuse", Tags: []string{"highlight"}, Locked: true,
+		}},
+		&entry{Path: "Valorant/raw_clip", IsRawFolder: true, Size: 500, ModTime: day(3), Metadata: &capture.ClipMetadata{
+			CreatedAt: day(3), DurationSec: 15, WindowTitle: "Valorant - Ranked",
+		}},
+		&entry{Path: "bug.webm", Size: 200, ModTime: day(4)},
+	)
+
+	names := func(items []Item) []string {
+		var out []string
+		for _, it := range items {
+			out = append(out, it.Name)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		q         Query
+		want      []string
+		wantTotal int
+	}{
+		{name: "newest first", q: Query{}, want: []string{"bug.webm", "raw_clip", "defuse.mp4", "ace.mp4"}},
+		{name: "oldest first", q: Query{Ascending: true}, want: []string{"ace.mp4", "defuse.mp4", "raw_clip", "bug.webm"}},
+		{name: "by name", q: Query{SortBy: SortName, Ascending: true}, want: []string{"ace.mp4", "bug.webm", "defuse.mp4", "raw_clip"}},
+		{name: "by size", q: Query{SortBy: SortSize}, want: []string{"raw_clip", "ace.mp4", "bug.webm", "defuse.mp4"}},
+		{name: "by duration", q: Query{SortBy: SortDuration, Ascending: true}, want: []string{"bug.webm", "raw_clip", "ace.mp4", "defuse.mp4"}},
+
+		{name: "search title", q: Query{Search: "clutch"}, want: []string{"ace.mp4"}},
+		{name: "search notes", q: Query{Search: "NINJA"}, want: []string{"defuse.mp4"}},
+		{name: "search app, window and folder", q: Query{Search: "valorant"}, want: []string{"raw_clip", "defuse.mp4"}},
+		{name: "search tag", q: Query{Search: "cs2"}, want: []string{"ace.mp4"}},
+		{name: "search file name", q: Query{Search: ".webm"}, want: []string{"bug.webm"}},
+		{name: "every word must match", q: Query{Search: "valorant ranked"}, want: []string{"raw_clip"}},
+		{name: "no match", q: Query{Search: "valorant clutch"}},
+
+		{name: "tags ignore case", q: Query{Tags: []string{"HIGHLIGHT"}}, want: []string{"defuse.mp4", "ace.mp4"}},
+		{name: "all tags", q: Query{Tags: []string{"highlight", "cs2"}}, want: []string{"ace.mp4"}},
+		{name: "favorites", q: Query{Favorites: true}, want: []string{"ace.mp4"}},
+		{name: "locked", q: Query{Locked: true}, want: []string{"defuse.mp4"}},
+		{name: "folder", q: Query{Folder: "valorant"}, want: []string{"raw_clip", "defuse.mp4"}},
+
+		// Clips with metadata are dated by creation, others by modification
+		{name: "from", q: Query{From: day(2)}, want: []string{"bug.webm", "raw_clip", "defuse.mp4"}},
+		{name: "to is exclusive", q: Query{To: day(3)}, want: []string{"defuse.mp4", "ace.mp4"}},
+		{name: "date range", q: Query{From: day(2), To: day(4)}, want: []string{"raw_clip", "defuse.mp4"}},
+
+		{name: "first page", q: Query{Limit: 3}, want: []string{"bug.webm", "raw_clip", "defuse.mp4"}, wantTotal: 4},
+		{name: "last page", q: Query{Offset: 3, Limit: 3}, want: []string{"ace.mp4"}, wantTotal: 4},
+		{name: "past the end", q: Query{Offset: 10, Limit: 3}, wantTotal: 4},
+		{name: "negative offset", q: Query{Offset: -1, Limit: 1}, want: []string{"bug.webm"}, wantTotal: 4},
+		{name: "filtered page", q: Query{Folder: "Valorant", Offset: 1, Limit: 1}, want: []string{"defuse.mp4"}, wantTotal: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := x.Query(tt.q)
+			if got := names(page.Items); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("items = %v, want %v", got, tt.want)
+			}
+			wantTotal := tt.wantTotal
+			if wantTotal == 0 {
+				wantTotal = len(tt.want)
+			}
+			if page.Total != wantTotal {
+				t.Errorf("total = %d, want %d", page.Total, wantTotal)
+			}
+		})
+	}
+}
+
+func TestTags(t *testing.T) {
+	x := testIndex(
+		&entry{Path: "a.mp4", Metadata: &capture.ClipMetadata{Tags: []string{"cs2", "ace"}}},
+		&entry{Path: "b.mp4", Metadata: &capture.ClipMetadata{Tags: []string{"cs2"}}},
+		&entry{Path: "c.mp4", Metadata: &capture.ClipMetadata{Tags: []string{"bug"}}},
+		&entry{Path: "d.mp4"},
+	)
+
+	want := []TagCount{{Tag: "cs2", Count: 2}, {Tag: "ace", Count: 1}, {Tag: "bug", Count: 1}}
+	if got := x.Tags(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Tags() = %v, want %v", got, want)
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	got := NormalizeTags([]string{" CS2 ", "", "cs2", "ace", "  ", "Ace"})
+	if want := []string{"CS2", "ace"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("NormalizeTags() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,82 @@
+// Package library manages the saved clips in the output directory.
+package library
+
+import (
+	"sort"
+	"time"
+)
+
+// Policy limits how much the clips folder may hold. Zero values disable
+// the respective limit. The trash does not count towards the limits;
+// TrashDays bounds how long it keeps deleted clips instead.
+type Policy struct {
+	MaxTotalMB int `json:"maxTotalMB"`
+	MaxAgeDays int `json:"maxAgeDays"`
+	MaxCount   int `json:"maxCount"`
+	TrashDays  int `json:"trashDays"` // 0 = keep deleted clips until the trash is emptied
+}
+
+// DefaultPolicy returns the policy used when none is configured: clips are
+// kept, deleted clips stay in the trash for 30 days
+func DefaultPolicy() Policy {
+	return Policy{TrashDays: 30}
+}
+
+// Enabled reports whether any clip limit is set
+func (p Policy) Enabled() bool {
+	return p.MaxTotalMB > 0 || p.MaxAgeDays > 0 || p.MaxCount > 0
+}
+
+// Entry is a clip as seen by the retention policy
+type Entry struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Exempt  bool // favorite or locked, never deleted
+}
+
+// Plan returns the clips that have to go, oldest first. Clips past the max
+// age are removed first, then the oldest until count and total size fit.
+// Exempt clips count towards the limits but are never selected.
+func (p Policy) Plan(entries []Entry, now time.Time) []Entry {
+	if !p.Enabled() {
+		return nil
+	}
+
+	sorted := append([]Entry(nil), entries...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ModTime.Before(sorted[j].ModTime) })
+
+	var total int64
+	for _, e := range sorted {
+		total += e.Size
+	}
+	count := len(sorted)
+	maxTotal := int64(p.MaxTotalMB) * 1024 * 1024
+
+	var remove []Entry
+	for _, e := range sorted {
+		if e.Exempt {
+			continue
+		}
+
+		tooOld := p.MaxAgeDays > 0 && now.Sub(e.ModTime) > time.Duration(p.MaxAgeDays)*24*time.Hour
+		tooMany := p.MaxCount > 0 && count > p.MaxCount
+		tooBig := maxTotal > 0 && total > maxTotal
+		if !tooOld && !tooMany && !tooBig {
+			// Sorted by age, so everything after this is newer and fits
+			break
+		}
+
+		remove = append(remove, e)
+		total -= e.Size
+		count--
+	}
+	return remove
+}
+
+// Result reports what a retention run deleted
+type Result struct {
+	Deleted    []string `json:"deleted"`
+	FreedBytes int64    `json:"freedBytes"`
+	Failed     []string `json:"failed,omitempty"`
+}
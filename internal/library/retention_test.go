@@ -0,0 +1,83 @@
+package library
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPolicyPlan(t *testing.T) {
+	now := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	const mb = 1024 * 1024
+	clip := func(path string, ageDays int, sizeMB int64) Entry {
+		return Entry{Path: path, Size: sizeMB * mb, ModTime: now.Add(-time.Duration(ageDays) * 24 * time.Hour)}
+	}
+	exempt := func(e Entry) Entry {
+		e.Exempt = true
+		return e
+	}
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		entries []Entry
+		want    []string
+	}{
+		{
+			name:    "disabled",
+			entries: []Entry{clip("a", 400, 1000)},
+		},
+		{
+			name:    "max age",
+			policy:  Policy{MaxAgeDays: 7},
+			entries: []Entry{clip("new", 1, 1), clip("week", 7, 1), clip("old", 10, 1), clip("older", 30, 1)},
+			want:    []string{"older", "old"},
+		},
+		{
+			name:    "max count removes the oldest",
+			policy:  Policy{MaxCount: 2},
+			entries: []Entry{clip("b", 2, 1), clip("d", 4, 1), clip("a", 1, 1), clip("c", 3, 1)},
+			want:    []string{"d", "c"},
+		},
+		{
+			name:    "max total size",
+			policy:  Policy{MaxTotalMB: 10},
+			entries: []Entry{clip("a", 1, 4), clip("b", 2, 4), clip("c", 3, 4), clip("d", 4, 1)},
+			want:    []string{"d", "c"},
+		},
+		{
+			name:    "within limits",
+			policy:  Policy{MaxTotalMB: 10, MaxAgeDays: 30, MaxCount: 5},
+			entries: []Entry{clip("a", 1, 4), clip("b", 20, 4)},
+		},
+		{
+			name:    "exempt clips count but stay",
+			policy:  Policy{MaxCount: 2},
+			entries: []Entry{exempt(clip("fav", 9, 1)), clip("c", 3, 1), clip("b", 2, 1), clip("a", 1, 1)},
+			want:    []string{"c", "b"},
+		},
+		{
+			name:    "exempt clips can exceed the limit",
+			policy:  Policy{MaxTotalMB: 1},
+			entries: []Entry{exempt(clip("fav", 2, 5)), exempt(clip("locked", 1, 5))},
+		},
+		{
+			name:    "age then size",
+			policy:  Policy{MaxAgeDays: 7, MaxTotalMB: 5},
+			entries: []Entry{clip("ancient", 90, 1), clip("a", 1, 2), clip("b", 2, 2), clip("c", 3, 2)},
+			want:    []string{"ancient", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, e := range tt.policy.Plan(tt.entries, now) {
+				got = append(got, e.Path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Plan() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package library
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// TrashDirName holds deleted clips inside the output directory until they
+// are restored or purged
+const TrashDirName = ".trash"
+
+// trashInfoFile describes a trashed clip inside its trash folder
+const trashInfoFile = "trash.json"
+
+// TrashItem is a deleted clip that can still be restored
+type TrashItem struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	OriginalPath string    `json:"originalPath"` // relative to the output directory
+	DeletedAt    time.Time `json:"deletedAt"`
+	Size         int64     `json:"size"`
+	IsRawFolder  bool      `json:"isRawFolder"`
+}
+
+// Trash manages the trash folder of an output directory
+type Trash struct {
+	root string
+}
+
+// NewTrash returns the trash of the output directory root
+func NewTrash(root string) *Trash {
+	return &Trash{root: root}
+}
+
+func (t *Trash) dir(id string) string {
+	return filepath.Join(t.root, TrashDirName, id)
+}
+
+// Add moves a clip and its companion files into the trash
+func (t *Trash) Add(clipPath string) (*TrashItem, error) {
+	info, err := os.Stat(clipPath)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(t.root, clipPath)
+	if err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, 4)
+	rand.Read(key)
+	item := &TrashItem{
+		ID:           time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(key),
+		Name:         info.Name(),
+		OriginalPath: filepath.ToSlash(rel),
+		DeletedAt:    time.Now(),
+		Size:         info.Size(),
+		IsRawFolder:  info.IsDir(),
+	}
+	if info.IsDir() {
+		item.Size = dirSize(clipPath)
+	}
+
+	dir := t.dir(item.ID)
+	if err := MoveClip(clipPath, filepath.Join(dir, item.Name)); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, trashInfoFile), data, 0644)
+	}
+	if err != nil {
+		// Without the info file the clip could not be listed, put it back
+		MoveClip(filepath.Join(dir, item.Name), clipPath)
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to write trash info: %w", err)
+	}
+	return item, nil
+}
+
+// List returns the trashed clips, most recently deleted first
+func (t *Trash) List() ([]TrashItem, error) {
+	entries, err := os.ReadDir(filepath.Join(t.root, TrashDirName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []TrashItem{}, nil
+		}
+		return nil, err
+	}
+
+	items := []TrashItem{}
+	for _, e := range entries {
+		if item, err := t.get(e.Name()); err == nil {
+			items = append(items, *item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+	return items, nil
+}
+
+func (t *Trash) get(id string) (*TrashItem, error) {
+	if id == "" || filepath.Base(id) != id {
+		return nil, fmt.Errorf("invalid trash id: %s", id)
+	}
+	data, err := os.ReadFile(filepath.Join(t.dir(id), trashInfoFile))
+	if err != nil {
+		return nil, fmt.Errorf("trash item not found: %s", id)
+	}
+	var item TrashItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, err
+	}
+	item.ID = id
+	return &item, nil
+}
+
+// Restore moves a trashed clip back to where it was deleted from. If that
+// name has been taken since, a numeric suffix is added. It returns the
+// restored path.
+func (t *Trash) Restore(id string) (string, error) {
+	item, err := t.get(id)
+	if err != nil {
+		return "", err
+	}
+
+	// The info file is only as trustworthy as the folder it sits in
+	rel := filepath.Clean(filepath.FromSlash(item.OriginalPath))
+	if err := WithinLibrary(rel); err != nil {
+		return "", fmt.Errorf("invalid trash item %s: %w", id, err)
+	}
+	if item.Name == "" || filepath.Base(item.Name) != item.Name {
+		return "", fmt.Errorf("invalid trash item %s: bad name", id)
+	}
+
+	dst := availablePath(filepath.Join(t.root, rel))
+	if err := MoveClip(filepath.Join(t.dir(id), item.Name), dst); err != nil {
+		return "", err
+	}
+	os.RemoveAll(t.dir(id))
+	return dst, nil
+}
+
+// Purge permanently deletes trashed clips
+func (t *Trash) Purge(ids []string) error {
+	for _, id := range ids {
+		if _, err := t.get(id); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(t.dir(id)); err != nil {
+			return fmt.Errorf("failed to purge %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// Expire permanently deletes the clips deleted longer than maxAge ago and
+// returns them
+func (t *Trash) Expire(maxAge time.Duration, now time.Time) ([]TrashItem, error) {
+	items, err := t.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []TrashItem
+	for _, item := range items {
+		if now.Sub(item.DeletedAt) <= maxAge {
+			continue
+		}
+		if err := os.RemoveAll(t.dir(item.ID)); err != nil {
+			return expired, fmt.Errorf("failed to purge %s: %w", item.ID, err)
+		}
+		expired = append(expired, item)
+	}
+	return expired, nil
+}
+
+// Size returns the bytes held by the trashed clips
+func (t *Trash) Size() (int64, error) {
+	items, err := t.List()
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, item := range items {
+		size += item.Size
+	}
+	return size, nil
+}
+
+// Empty permanently deletes everything in the trash
+func (t *Trash) Empty() error {
+	return os.RemoveAll(filepath.Join(t.root, TrashDirName))
+}
@@ -0,0 +1,124 @@
+package library
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTrashRestore(t *testing.T) {
+	root := t.TempDir()
+	trash := NewTrash(root)
+
+	clip := filepath.Join(root, "games", "clip.mp4")
+	if err := os.MkdirAll(filepath.Dir(clip), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(clip, []byte("clip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := trash.Add(clip)
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, err := os.Stat(clip); !os.IsNotExist(err) {
+		t.Fatalf("clip still in place after Add(): %v", err)
+	}
+
+	got, err := trash.Restore(item.ID)
+	if err != nil || got != clip {
+		t.Fatalf("Restore() = %q, %v, want %q", got, err, clip)
+	}
+	if _, err := os.Stat(trash.dir(item.ID)); !os.IsNotExist(err) {
+		t.Errorf("trash folder left behind: %v", err)
+	}
+}
+
+func TestTrashRestoreTampered(t *testing.T) {
+	tests := []struct {
+		name         string
+		originalPath string
+		itemName     string
+	}{
+		{name: "parent dir", originalPath: "../outside.mp4", itemName: "clip.mp4"},
+		{name: "nested parent dir", originalPath: "games/../../outside.mp4", itemName: "clip.mp4"},
+		{name: "absolute", originalPath: filepath.ToSlash(filepath.Join(t.TempDir(), "outside.mp4")), itemName: "clip.mp4"},
+		{name: "hidden folder", originalPath: ".previews/clip.mp4", itemName: "clip.mp4"},
+		{name: "root", originalPath: ".", itemName: "clip.mp4"},
+		{name: "name with separator", originalPath: "clip.mp4", itemName: "../clip.mp4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			trash := NewTrash(root)
+
+			id := "20240305-120000-deadbeef"
+			dir := trash.dir(id)
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "clip.mp4"), []byte("clip"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			data, _ := json.Marshal(TrashItem{ID: id, Name: tt.itemName, OriginalPath: tt.originalPath})
+			if err := os.WriteFile(filepath.Join(dir, trashInfoFile), data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, err := trash.Restore(id); err == nil {
+				t.Fatalf("Restore() = %q, want an error", got)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "clip.mp4")); err != nil {
+				t.Errorf("trashed clip was moved: %v", err)
+			}
+		})
+	}
+}
+
+func TestTrashExpire(t *testing.T) {
+	root := t.TempDir()
+	trash := NewTrash(root)
+	now := time.Now()
+
+	var ids []string
+	for i, name := range []string{"old.mp4", "recent.mp4"} {
+		clip := filepath.Join(root, name)
+		if err := os.WriteFile(clip, []byte("clip"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		item, err := trash.Add(clip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, item.ID)
+
+		// Backdate the first clip past the limit
+		item.DeletedAt = now.Add(-time.Duration(1-i) * 31 * 24 * time.Hour)
+		data, _ := json.Marshal(item)
+		if err := os.WriteFile(filepath.Join(trash.dir(item.ID), trashInfoFile), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if size, err := trash.Size(); err != nil || size != 8 {
+		t.Errorf("Size() = %d, %v, want 8", size, err)
+	}
+
+	expired, err := trash.Expire(30*24*time.Hour, now)
+	if err != nil {
+		t.Fatalf("Expire() error = %v", err)
+	}
+	if len(expired) != 1 || expired[0].ID != ids[0] {
+		t.Errorf("Expire() = %+v, want only %s", expired, ids[0])
+	}
+	if _, err := os.Stat(trash.dir(ids[0])); !os.IsNotExist(err) {
+		t.Errorf("expired clip still in the trash: %v", err)
+	}
+	if items, _ := trash.List(); len(items) != 1 || items[0].ID != ids[1] {
+		t.Errorf("trash after Expire() = %+v, want only %s", items, ids[1])
+	}
+}
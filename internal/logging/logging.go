@@ -14,8 +14,19 @@ import (
 
 var logFile *lumberjack.Logger
 
-// Setup initializes the logging system
+// Setup initializes the logging system, mirroring logs to stdout when
+// there is one
 func Setup(logPath string, debug bool) error {
+	var console io.Writer
+	if fileInfo, _ := os.Stdout.Stat(); fileInfo != nil {
+		console = os.Stdout
+	}
+	return SetupWithConsole(logPath, debug, console)
+}
+
+// SetupWithConsole initializes the logging system, mirroring logs to
+// console unless it is nil
+func SetupWithConsole(logPath string, debug bool, console io.Writer) error {
 	logDir := filepath.Dir(logPath)
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return fmt.Errorf("failed to create log directory: %w", err)
@@ -33,8 +44,8 @@ func Setup(logPath string, debug bool) error {
 	var writers []io.Writer
 	writers = append(writers, logFile)
 
-	if fileInfo, _ := os.Stdout.Stat(); fileInfo != nil {
-		writers = append(writers, os.Stdout)
+	if console != nil {
+		writers = append(writers, console)
 	}
 
 	multiWriter := io.MultiWriter(writers...)
@@ -0,0 +1,144 @@
+package obsws
+
+import (
+	"encoding/json"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+// frame is a queued outgoing message; closeCode ends the connection
+type frame struct {
+	data      []byte
+	closeCode int
+}
+
+// client is one connection. Writes go through a queue so events can be
+// sent without blocking the app.
+type client struct {
+	ws        *websocket.Conn
+	queue     chan frame
+	quit      chan struct{} // closed by close
+	done      chan struct{} // closed once the connection is closed
+	closeOnce sync.Once
+
+	mu            sync.Mutex
+	identified    bool
+	subscriptions int
+}
+
+func newClient(ws *websocket.Conn) *client {
+	c := &client{
+		ws:    ws,
+		queue: make(chan frame, 64),
+		quit:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go c.writeLoop()
+	return c
+}
+
+func (c *client) writeLoop() {
+	defer close(c.done)
+	defer c.ws.Close()
+	defer c.close(0, "") // unblock senders if the write failed
+
+	for {
+		select {
+		case f := <-c.queue:
+			if !c.write(f) {
+				return
+			}
+		case <-c.quit:
+			// Flush what was queued before closing, e.g. the close frame
+			for {
+				select {
+				case f := <-c.queue:
+					if !c.write(f) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write sends a frame and reports whether the connection stays open
+func (c *client) write(f frame) bool {
+	if f.closeCode != 0 {
+		// x/net/websocket has no API for close codes, so the close frame
+		// is written by hand
+		c.ws.PayloadType = websocket.CloseFrame
+		c.ws.Write(f.data)
+		return false
+	}
+	_, err := c.ws.Write(f.data)
+	return err == nil
+}
+
+func (c *client) isIdentified() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.identified
+}
+
+func (c *client) identify(subscriptions int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.identified = true
+	c.subscriptions = subscriptions
+}
+
+// send queues a message, waiting if the queue is full
+func (c *client) send(op int, d any) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return
+	}
+	msg, _ := json.Marshal(message{Op: op, D: data})
+
+	select {
+	case c.queue <- frame{data: msg}:
+	case <-c.quit:
+	}
+}
+
+// sendEvent queues an event if the client subscribed to its category. Slow
+// clients miss events rather than stalling the app.
+func (c *client) sendEvent(category int, eventType string, data any) {
+	c.mu.Lock()
+	subscribed := c.identified && c.subscriptions&category != 0
+	c.mu.Unlock()
+	if !subscribed {
+		return
+	}
+
+	d, _ := json.Marshal(event{EventType: eventType, EventIntent: category, EventData: data})
+	msg, _ := json.Marshal(message{Op: opEvent, D: d})
+	select {
+	case c.queue <- frame{data: msg}:
+	default:
+	}
+}
+
+// close ends the connection after the queued messages, sending code and
+// reason unless code is 0. Only the first call has an effect.
+func (c *client) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		if code != 0 {
+			payload := append([]byte{byte(code >> 8), byte(code)}, reason...)
+			select {
+			case c.queue <- frame{data: payload, closeCode: code}:
+			default:
+			}
+		}
+		close(c.quit)
+	})
+}
+
+// wait blocks until the connection is closed
+func (c *client) wait() {
+	<-c.done
+}
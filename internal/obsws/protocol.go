@@ -0,0 +1,177 @@
+// Package obsws implements the replay buffer subset of the obs-websocket
+// v5 protocol, so tools written for OBS can drive Rewind
+package obsws
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+)
+
+// Version is the obs-websocket version reported to clients
+const Version = "5.5.0"
+
+// subprotocol is the only encoding supported; msgpack is not
+const subprotocol = "obswebsocket.json"
+
+// DefaultAddr matches the default obs-websocket port
+const DefaultAddr = "127.0.0.1:4455"
+
+// Message opcodes
+const (
+	opHello                = 0
+	opIdentify             = 1
+	opIdentified           = 2
+	opReidentify           = 3
+	opEvent                = 5
+	opRequest              = 6
+	opRequestResponse      = 7
+	opRequestBatch         = 8
+	opRequestBatchResponse = 9
+)
+
+// Close codes
+const (
+	closeUnknownReason         = 4000
+	closeMessageDecodeError    = 4002
+	closeMissingDataField      = 4003
+	closeUnknownOpCode         = 4005
+	closeNotIdentified         = 4007
+	closeAlreadyIdentified     = 4008
+	closeAuthenticationFailed  = 4009
+	closeUnsupportedRPCVersion = 4010
+)
+
+// Request status codes
+const (
+	statusSuccess                 = 100
+	statusUnknownRequestType      = 204
+	statusInvalidRequestFieldType = 400
+	statusOutputRunning           = 500
+	statusOutputNotRunning        = 501
+	statusResourceNotFound        = 600
+	statusRequestFailed           = 702
+)
+
+// Event subscription bits
+const (
+	subscriptionGeneral = 1 << 0
+	subscriptionOutputs = 1 << 6
+	subscriptionAll     = 0x7FF // every non high-volume category
+)
+
+// Output states of ReplayBufferStateChanged
+const (
+	outputStarted = "OBS_WEBSOCKET_OUTPUT_STARTED"
+	outputStopped = "OBS_WEBSOCKET_OUTPUT_STOPPED"
+)
+
+// message is the envelope of every frame
+type message struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d"`
+}
+
+type hello struct {
+	OBSWebSocketVersion string          `json:"obsWebSocketVersion"`
+	RPCVersion          int             `json:"rpcVersion"`
+	Authentication      *authentication `json:"authentication,omitempty"`
+}
+
+type authentication struct {
+	Challenge string `json:"challenge"`
+	Salt      string `json:"salt"`
+}
+
+type identify struct {
+	RPCVersion         int    `json:"rpcVersion"`
+	Authentication     string `json:"authentication"`
+	EventSubscriptions *int   `json:"eventSubscriptions"`
+}
+
+type identified struct {
+	NegotiatedRPCVersion int `json:"negotiatedRpcVersion"`
+}
+
+type event struct {
+	EventType   string `json:"eventType"`
+	EventIntent int    `json:"eventIntent"`
+	EventData   any    `json:"eventData,omitempty"`
+}
+
+type request struct {
+	RequestType string          `json:"requestType"`
+	RequestID   string          `json:"requestId"`
+	RequestData json.RawMessage `json:"requestData,omitempty"`
+}
+
+type requestStatus struct {
+	Result  bool   `json:"result"`
+	Code    int    `json:"code"`
+	Comment string `json:"comment,omitempty"`
+}
+
+type requestResponse struct {
+	RequestType   string        `json:"requestType"`
+	RequestID     string        `json:"requestId"`
+	RequestStatus requestStatus `json:"requestStatus"`
+	ResponseData  any           `json:"responseData,omitempty"`
+}
+
+type requestBatch struct {
+	RequestID     string    `json:"requestId"`
+	HaltOnFailure bool      `json:"haltOnFailure"`
+	Requests      []request `json:"requests"`
+}
+
+type requestBatchResponse struct {
+	RequestID string            `json:"requestId"`
+	Results   []requestResponse `json:"results"`
+}
+
+// authResponse computes what a client sends for password, salt and
+// challenge: base64(sha256(base64(sha256(password + salt)) + challenge))
+func authResponse(password, salt, challenge string) string {
+	secret := sha256.Sum256([]byte(password + salt))
+	resp := sha256.Sum256([]byte(base64.StdEncoding.EncodeToString(secret[:]) + challenge))
+	return base64.StdEncoding.EncodeToString(resp[:])
+}
+
+// Settings configures the obs-websocket server. It is off by default.
+type Settings struct {
+	Enabled  bool   `json:"enabled"`
+	Addr     string `json:"addr"`     // "host:port"
+	Password string `json:"password"` // "" = no authentication
+}
+
+// DefaultSettings returns the settings used when none are configured
+func DefaultSettings() Settings {
+	return Settings{Addr: DefaultAddr}
+}
+
+// Validate checks the address. Listening beyond loopback requires a
+// password.
+func (s Settings) Validate() error {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid obs-websocket address: %w", err)
+	}
+	ip := net.ParseIP(host)
+	local := host == "localhost" || (ip != nil && ip.IsLoopback())
+	if !local && s.Password == "" {
+		return fmt.Errorf("obs-websocket needs a password when listening beyond localhost")
+	}
+	return nil
+}
+
+// LogValue logs whether a password is set instead of the password
+func (s Settings) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Bool("enabled", s.Enabled),
+		slog.String("addr", s.Addr),
+		slog.Bool("password", s.Password != ""),
+	)
+}
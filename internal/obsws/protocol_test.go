@@ -0,0 +1,24 @@
+package obsws
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSettingsLogValue(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	s := Settings{Enabled: true, Addr: DefaultAddr, Password: "hunter2-but-longer"}
+	logger.Info("settings", "obs", s)
+
+	out := buf.String()
+	if strings.Contains(out, s.Password) {
+		t.Errorf("log line contains the password: %s", out)
+	}
+	if !strings.Contains(out, "obs.password=true") {
+		t.Errorf("log line = %s", out)
+	}
+}
@@ -0,0 +1,373 @@
+package obsws
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"rewind/internal/utils"
+
+	"golang.org/x/net/websocket"
+)
+
+// Controller is the part of the app the protocol maps onto
+type Controller interface {
+	Start() error
+	Stop() error
+	SaveClip() (string, error)
+	Recording() bool
+	AddMarker(label string) error
+
+	// Subscribe reports recording starting or stopping and saved clips.
+	// The callbacks must not block.
+	Subscribe(onRecording func(active bool), onSaved func(path string)) (unsubscribe func())
+}
+
+// requests lists the supported request types. GetReplayBufferActive is not
+// part of obs-websocket but some older plugins send it.
+var requests = []string{
+	"GetVersion",
+	"GetReplayBufferStatus",
+	"GetReplayBufferActive",
+	"StartReplayBuffer",
+	"StopReplayBuffer",
+	"ToggleReplayBuffer",
+	"SaveReplayBuffer",
+	"CreateRecordChapter",
+	"GetLastReplayBufferReplay",
+}
+
+// Server runs the obs-websocket endpoint while it is enabled
+type Server struct {
+	ctrl Controller
+
+	mu          sync.Mutex
+	settings    Settings
+	srv         *http.Server
+	clients     map[*client]struct{}
+	unsubscribe func()
+	lastReplay  string
+}
+
+// NewServer creates a stopped server
+func NewServer(ctrl Controller) *Server {
+	return &Server{ctrl: ctrl, clients: map[*client]struct{}{}}
+}
+
+// Apply starts, stops or restarts the server to match settings. It never
+// waits for running requests.
+func (s *Server) Apply(settings Settings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.srv != nil && settings == s.settings {
+		return nil
+	}
+	s.closeLocked()
+	s.settings = settings
+
+	if !settings.Enabled {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", settings.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to start obs-websocket server: %w", err)
+	}
+
+	srv := &http.Server{
+		Handler: websocket.Server{
+			Handshake: func(config *websocket.Config, r *http.Request) error {
+				return handshake(config, r, settings.Password)
+			},
+			Handler: func(ws *websocket.Conn) { s.serveClient(ws, settings.Password) },
+		},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.srv = srv
+	s.unsubscribe = s.ctrl.Subscribe(s.onRecording, s.onSaved)
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("obs-websocket server stopped", "error", err)
+		}
+	}()
+
+	slog.Info("obs-websocket server listening", "addr", ln.Addr().String(), "auth", settings.Password != "")
+	return nil
+}
+
+// Close stops the server and disconnects all clients
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked()
+	s.settings = Settings{}
+}
+
+func (s *Server) closeLocked() {
+	if s.srv == nil {
+		return
+	}
+	s.unsubscribe()
+	s.unsubscribe = nil
+
+	for c := range s.clients {
+		c.sendEvent(subscriptionGeneral, "ExitStarted", nil)
+		c.close(closeUnknownReason, "server stopped")
+	}
+	clear(s.clients)
+
+	s.srv.Close()
+	s.srv = nil
+	slog.Info("obs-websocket server stopped")
+}
+
+// handshake negotiates the JSON subprotocol. Browsers connect from any
+// origin, so authentication replaces the origin check; without a password
+// any web page could drive the app and browsers are refused.
+func handshake(config *websocket.Config, r *http.Request, password string) error {
+	if password == "" && r.Header.Get("Origin") != "" {
+		return fmt.Errorf("browser connections need a password")
+	}
+	if len(config.Protocol) == 0 {
+		return nil
+	}
+	if !slices.Contains(config.Protocol, subprotocol) {
+		return fmt.Errorf("unsupported subprotocol")
+	}
+	config.Protocol = []string{subprotocol}
+	return nil
+}
+
+func (s *Server) broadcast(category int, eventType string, data any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		c.sendEvent(category, eventType, data)
+	}
+}
+
+func (s *Server) onRecording(active bool) {
+	state := outputStopped
+	if active {
+		state = outputStarted
+	}
+	s.broadcast(subscriptionOutputs, "ReplayBufferStateChanged", map[string]any{
+		"outputActive": active,
+		"outputState":  state,
+	})
+}
+
+func (s *Server) onSaved(path string) {
+	s.mu.Lock()
+	s.lastReplay = path
+	s.mu.Unlock()
+	s.broadcast(subscriptionOutputs, "ReplayBufferSaved", map[string]any{"savedReplayPath": path})
+}
+
+// serveClient runs the Hello/Identify handshake and then answers requests
+func (s *Server) serveClient(ws *websocket.Conn, password string) {
+	c := newClient(ws)
+	defer c.wait()
+	defer c.close(0, "")
+
+	h := hello{OBSWebSocketVersion: Version, RPCVersion: 1}
+	if password != "" {
+		h.Authentication = &authentication{Challenge: randomString(), Salt: randomString()}
+	}
+	c.send(opHello, h)
+
+	for {
+		var raw []byte
+		if err := websocket.Message.Receive(ws, &raw); err != nil {
+			return
+		}
+
+		var msg message
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			c.close(closeMessageDecodeError, "invalid message")
+			return
+		}
+
+		switch msg.Op {
+		case opIdentify, opReidentify:
+			var id identify
+			if err := json.Unmarshal(msg.D, &id); err != nil {
+				c.close(closeMissingDataField, "invalid identify")
+				return
+			}
+			if msg.Op == opIdentify {
+				if c.isIdentified() {
+					c.close(closeAlreadyIdentified, "already identified")
+					return
+				}
+				if id.RPCVersion != 1 {
+					c.close(closeUnsupportedRPCVersion, "only rpc version 1 is supported")
+					return
+				}
+				if h.Authentication != nil {
+					want := authResponse(password, h.Authentication.Salt, h.Authentication.Challenge)
+					if subtle.ConstantTimeCompare([]byte(id.Authentication), []byte(want)) != 1 {
+						slog.Warn("obs-websocket authentication failed", "remote", ws.Request().RemoteAddr)
+						c.close(closeAuthenticationFailed, "authentication failed")
+						return
+					}
+				}
+				s.mu.Lock()
+				s.clients[c] = struct{}{}
+				s.mu.Unlock()
+				defer func() {
+					s.mu.Lock()
+					delete(s.clients, c)
+					s.mu.Unlock()
+				}()
+			} else if !c.isIdentified() {
+				c.close(closeNotIdentified, "not identified")
+				return
+			}
+
+			subs := subscriptionAll
+			if id.EventSubscriptions != nil {
+				subs = *id.EventSubscriptions
+			}
+			c.identify(subs)
+			c.send(opIdentified, identified{NegotiatedRPCVersion: 1})
+		case opRequest:
+			if !c.isIdentified() {
+				c.close(closeNotIdentified, "not identified")
+				return
+			}
+			var req request
+			if err := json.Unmarshal(msg.D, &req); err != nil {
+				c.close(closeMissingDataField, "invalid request")
+				return
+			}
+			c.send(opRequestResponse, s.handle(req))
+		case opRequestBatch:
+			if !c.isIdentified() {
+				c.close(closeNotIdentified, "not identified")
+				return
+			}
+			var batch requestBatch
+			if err := json.Unmarshal(msg.D, &batch); err != nil {
+				c.close(closeMissingDataField, "invalid request batch")
+				return
+			}
+			resp := requestBatchResponse{RequestID: batch.RequestID, Results: []requestResponse{}}
+			for _, req := range batch.Requests {
+				res := s.handle(req)
+				resp.Results = append(resp.Results, res)
+				if batch.HaltOnFailure && !res.RequestStatus.Result {
+					break
+				}
+			}
+			c.send(opRequestBatchResponse, resp)
+		default:
+			c.close(closeUnknownOpCode, fmt.Sprintf("unknown op code %d", msg.Op))
+			return
+		}
+	}
+}
+
+// handle runs one request
+func (s *Server) handle(req request) requestResponse {
+	resp := requestResponse{RequestType: req.RequestType, RequestID: req.RequestID}
+	fail := func(code int, comment string) requestResponse {
+		resp.RequestStatus = requestStatus{Code: code, Comment: comment}
+		return resp
+	}
+
+	switch req.RequestType {
+	case "GetVersion":
+		resp.ResponseData = map[string]any{
+			// Tools check the OBS version for feature support; report the
+			// release that shipped this protocol version
+			"obsVersion":            "30.0.0",
+			"obsWebSocketVersion":   Version,
+			"rpcVersion":            1,
+			"availableRequests":     requests,
+			"supportedImageFormats": []string{},
+			"platform":              "windows",
+			"platformDescription":   "Rewind " + utils.AppVersion,
+		}
+	case "GetReplayBufferStatus", "GetReplayBufferActive":
+		resp.ResponseData = map[string]any{"outputActive": s.ctrl.Recording()}
+	case "StartReplayBuffer":
+		if s.ctrl.Recording() {
+			return fail(statusOutputRunning, "replay buffer is already active")
+		}
+		if err := s.ctrl.Start(); err != nil {
+			return fail(statusRequestFailed, err.Error())
+		}
+	case "StopReplayBuffer":
+		if !s.ctrl.Recording() {
+			return fail(statusOutputNotRunning, "replay buffer is not active")
+		}
+		if err := s.ctrl.Stop(); err != nil {
+			return fail(statusRequestFailed, err.Error())
+		}
+	case "ToggleReplayBuffer":
+		var err error
+		active := !s.ctrl.Recording()
+		if active {
+			err = s.ctrl.Start()
+		} else {
+			err = s.ctrl.Stop()
+		}
+		if err != nil {
+			return fail(statusRequestFailed, err.Error())
+		}
+		resp.ResponseData = map[string]any{"outputActive": active}
+	case "SaveReplayBuffer":
+		if !s.ctrl.Recording() {
+			return fail(statusOutputNotRunning, "replay buffer is not active")
+		}
+		if _, err := s.ctrl.SaveClip(); err != nil {
+			return fail(statusRequestFailed, err.Error())
+		}
+	case "CreateRecordChapter":
+		// Markers land in the replay buffer, which saves them as chapters
+		var data struct {
+			ChapterName string `json:"chapterName"`
+		}
+		if len(req.RequestData) > 0 {
+			if err := json.Unmarshal(req.RequestData, &data); err != nil {
+				return fail(statusInvalidRequestFieldType, "invalid requestData")
+			}
+		}
+		if !s.ctrl.Recording() {
+			return fail(statusOutputNotRunning, "replay buffer is not active")
+		}
+		if err := s.ctrl.AddMarker(data.ChapterName); err != nil {
+			return fail(statusRequestFailed, err.Error())
+		}
+	case "GetLastReplayBufferReplay":
+		s.mu.Lock()
+		last := s.lastReplay
+		s.mu.Unlock()
+		if last == "" {
+			return fail(statusResourceNotFound, "no replay has been saved")
+		}
+		resp.ResponseData = map[string]any{"savedReplayPath": last}
+	default:
+		return fail(statusUnknownRequestType, "unsupported request type")
+	}
+
+	resp.RequestStatus = requestStatus{Result: true, Code: statusSuccess}
+	return resp
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,43 @@
+package obsws
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestHandshake(t *testing.T) {
+	tests := []struct {
+		name      string
+		origin    string
+		password  string
+		protocols []string
+		wantErr   bool
+	}{
+		{name: "native client", protocols: []string{subprotocol}},
+		{name: "no subprotocol"},
+		{name: "unsupported subprotocol", protocols: []string{"obswebsocket.msgpack"}, wantErr: true},
+		{name: "browser with password", origin: "https://example.com", password: "secret", protocols: []string{subprotocol}},
+		{name: "browser without password", origin: "https://example.com", protocols: []string{subprotocol}, wantErr: true},
+		{name: "null origin without password", origin: "null", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			config := &websocket.Config{Protocol: tt.protocols}
+
+			err := handshake(config, r, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("handshake() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(tt.protocols) > 0 && (len(config.Protocol) != 1 || config.Protocol[0] != subprotocol) {
+				t.Errorf("negotiated protocols = %v, want [%s]", config.Protocol, subprotocol)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package remux
+
+import "errors"
+
+var errShortData = errors.New("unexpected end of data")
+
+// unescapeRBSP removes emulation prevention bytes (00 00 03 -> 00 00)
+func unescapeRBSP(nal []byte) []byte {
+	out := make([]byte, 0, len(nal))
+	zeros := 0
+	for _, b := range nal {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// bitReader reads big-endian bit fields and Exp-Golomb codes. Reading past
+// the end sets err and returns zeros.
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *bitReader) u(n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.data)*8 {
+			r.err = errShortData
+			return 0
+		}
+		bit := (r.data[r.pos/8] >> (7 - uint(r.pos%8))) & 1
+		v = v<<1 | uint64(bit)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) flag() bool { return r.u(1) == 1 }
+
+func (r *bitReader) skip(n int) { r.u(n) }
+
+// ue reads an unsigned Exp-Golomb code
+func (r *bitReader) ue() uint64 {
+	zeros := 0
+	for r.u(1) == 0 {
+		if r.err != nil || zeros > 31 {
+			r.err = errShortData
+			return 0
+		}
+		zeros++
+	}
+	return (1<<uint(zeros) - 1) + r.u(zeros)
+}
+
+// se reads a signed Exp-Golomb code
+func (r *bitReader) se() int64 {
+	v := r.ue()
+	if v%2 == 1 {
+		return int64(v+1) / 2
+	}
+	return -int64(v / 2)
+}
@@ -0,0 +1,177 @@
+package remux
+
+import "fmt"
+
+const (
+	h264NALIDR = 5
+	h264NALSPS = 7
+	h264NALPPS = 8
+	h264NALAUD = 9
+)
+
+// h264Codec collects H.264 parameter sets and builds the avc1 sample entry
+type h264Codec struct {
+	sps []byte
+	pps []byte
+}
+
+func (c *h264Codec) filter(nal []byte) (keep, key bool) {
+	switch nal[0] & 0x1F {
+	case h264NALSPS:
+		if c.sps == nil {
+			c.sps = append([]byte{}, nal...)
+		}
+		return false, false
+	case h264NALPPS:
+		if c.pps == nil {
+			c.pps = append([]byte{}, nal...)
+		}
+		return false, false
+	case h264NALAUD:
+		return false, false
+	case h264NALIDR:
+		return true, true
+	}
+	return true, false
+}
+
+func (c *h264Codec) ready() bool {
+	return c.sps != nil && c.pps != nil
+}
+
+func (c *h264Codec) sampleEntry() ([]byte, int, int, error) {
+	sps, err := parseH264SPS(c.sps)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid SPS: %w", err)
+	}
+
+	// AVCDecoderConfigurationRecord
+	avcC := []byte{1, c.sps[1], c.sps[2], c.sps[3], 0xFF, 0xE1}
+	avcC = appendU16(avcC, uint16(len(c.sps)))
+	avcC = append(avcC, c.sps...)
+	avcC = append(avcC, 1)
+	avcC = appendU16(avcC, uint16(len(c.pps)))
+	avcC = append(avcC, c.pps...)
+	if sps.highProfile {
+		avcC = append(avcC,
+			0xFC|byte(sps.chromaFormat),
+			0xF8|byte(sps.bitDepthLuma-8),
+			0xF8|byte(sps.bitDepthChroma-8),
+			0,
+		)
+	}
+
+	entry := visualSampleEntry("avc1", sps.width, sps.height, mkbox("avcC", avcC))
+	return entry, sps.width, sps.height, nil
+}
+
+type h264SPS struct {
+	width, height  int
+	highProfile    bool
+	chromaFormat   int
+	bitDepthLuma   int
+	bitDepthChroma int
+}
+
+func parseH264SPS(nal []byte) (*h264SPS, error) {
+	if len(nal) < 4 {
+		return nil, errShortData
+	}
+
+	r := &bitReader{data: unescapeRBSP(nal[1:])}
+	sps := &h264SPS{chromaFormat: 1, bitDepthLuma: 8, bitDepthChroma: 8}
+
+	profile := r.u(8)
+	r.skip(16) // constraint flags, level
+	r.ue()     // seq_parameter_set_id
+
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		sps.highProfile = true
+		sps.chromaFormat = int(r.ue())
+		if sps.chromaFormat == 3 {
+			r.skip(1) // separate_colour_plane_flag
+		}
+		sps.bitDepthLuma = int(r.ue()) + 8
+		sps.bitDepthChroma = int(r.ue()) + 8
+		r.skip(1) // qpprime_y_zero_transform_bypass_flag
+		if r.flag() {
+			lists := 8
+			if sps.chromaFormat == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if !r.flag() {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				skipScalingList(r, size)
+			}
+		}
+	}
+
+	r.ue() // log2_max_frame_num_minus4
+	switch r.ue() {
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.skip(1) // delta_pic_order_always_zero_flag
+		r.se()    // offset_for_non_ref_pic
+		r.se()    // offset_for_top_to_bottom_field
+		n := r.ue()
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			r.se()
+		}
+	}
+	r.ue()    // max_num_ref_frames
+	r.skip(1) // gaps_in_frame_num_value_allowed_flag
+
+	widthMbs := int(r.ue()) + 1
+	heightMapUnits := int(r.ue()) + 1
+	frameMbsOnly := 0
+	if r.flag() {
+		frameMbsOnly = 1
+	} else {
+		r.skip(1) // mb_adaptive_frame_field_flag
+	}
+	r.skip(1) // direct_8x8_inference_flag
+
+	var cropLeft, cropRight, cropTop, cropBottom int
+	if r.flag() {
+		cropLeft = int(r.ue())
+		cropRight = int(r.ue())
+		cropTop = int(r.ue())
+		cropBottom = int(r.ue())
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	cropUnitX, cropUnitY := 1, 2-frameMbsOnly
+	switch sps.chromaFormat {
+	case 1:
+		cropUnitX, cropUnitY = 2, 2*(2-frameMbsOnly)
+	case 2:
+		cropUnitX, cropUnitY = 2, 2-frameMbsOnly
+	}
+
+	sps.width = widthMbs*16 - cropUnitX*(cropLeft+cropRight)
+	sps.height = (2-frameMbsOnly)*heightMapUnits*16 - cropUnitY*(cropTop+cropBottom)
+	return sps, nil
+}
+
+func skipScalingList(r *bitReader, size int) {
+	last, next := int64(8), int64(8)
+	for j := 0; j < size && r.err == nil; j++ {
+		if next != 0 {
+			next = (last + r.se() + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package remux
+
+import (
+	"math/bits"
+	"testing"
+)
+
+// bitWriter writes big-endian bit fields and Exp-Golomb codes
+type bitWriter struct {
+	b []byte
+	n int
+}
+
+func (w *bitWriter) bits(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.b = append(w.b, 0)
+		}
+		if v>>i&1 == 1 {
+			w.b[len(w.b)-1] |= 0x80 >> (w.n % 8)
+		}
+		w.n++
+	}
+}
+
+func (w *bitWriter) ue(v uint64) {
+	n := bits.Len64(v + 1)
+	w.bits(0, n-1)
+	w.bits(v+1, n)
+}
+
+type testSPS struct {
+	profile        int
+	bitDepth       int // high profiles only
+	widthMbs       int
+	heightMapUnits int
+	interlaced     bool
+	crop           [4]int // left, right, top, bottom
+}
+
+// nal encodes the SPS as a NAL unit with 4:2:0 chroma and POC type 0
+func (s testSPS) nal() []byte {
+	w := &bitWriter{}
+	w.bits(uint64(s.profile), 8)
+	w.bits(0, 8)  // constraint flags
+	w.bits(40, 8) // level 4.0
+	w.ue(0)       // seq_parameter_set_id
+	if s.profile == 100 || s.profile == 110 {
+		w.ue(1) // chroma_format_idc
+		w.ue(uint64(s.bitDepth - 8))
+		w.ue(uint64(s.bitDepth - 8))
+		w.bits(0, 1) // qpprime_y_zero_transform_bypass_flag
+		w.bits(0, 1) // seq_scaling_matrix_present_flag
+	}
+	w.ue(0) // log2_max_frame_num_minus4
+	w.ue(0) // pic_order_cnt_type
+	w.ue(0) // log2_max_pic_order_cnt_lsb_minus4
+	w.ue(1) // max_num_ref_frames
+	w.bits(0, 1)
+	w.ue(uint64(s.widthMbs - 1))
+	w.ue(uint64(s.heightMapUnits - 1))
+	if s.interlaced {
+		w.bits(0, 1) // frame_mbs_only_flag
+		w.bits(0, 1) // mb_adaptive_frame_field_flag
+	} else {
+		w.bits(1, 1)
+	}
+	w.bits(1, 1) // direct_8x8_inference_flag
+	if s.crop != [4]int{} {
+		w.bits(1, 1)
+		for _, c := range s.crop {
+			w.ue(uint64(c))
+		}
+	} else {
+		w.bits(0, 1)
+	}
+	w.bits(0, 1) // vui_parameters_present_flag
+	w.bits(1, 1) // rbsp_stop_one_bit
+	return append([]byte{0x67}, w.b...)
+}
+
+func TestParseH264SPS(t *testing.T) {
+	tests := []struct {
+		name          string
+		nal           []byte
+		width, height int
+		high          bool
+		bitDepth      int
+		wantErr       bool
+	}{
+		{
+			name:  "baseline",
+			nal:   testSPS{profile: 66, widthMbs: 4, heightMapUnits: 4}.nal(),
+			width: 64, height: 64, bitDepth: 8,
+		},
+		{
+			name:  "1080p cropped",
+			nal:   testSPS{profile: 77, widthMbs: 120, heightMapUnits: 68, crop: [4]int{0, 0, 0, 4}}.nal(),
+			width: 1920, height: 1080, bitDepth: 8,
+		},
+		{
+			name:  "1080i cropped",
+			nal:   testSPS{profile: 77, widthMbs: 120, heightMapUnits: 34, interlaced: true, crop: [4]int{0, 0, 0, 2}}.nal(),
+			width: 1920, height: 1080, bitDepth: 8,
+		},
+		{
+			name:  "high 10",
+			nal:   testSPS{profile: 110, bitDepth: 10, widthMbs: 160, heightMapUnits: 90}.nal(),
+			width: 2560, height: 1440, high: true, bitDepth: 10,
+		},
+		{
+			name:    "truncated",
+			nal:     testSPS{profile: 66, widthMbs: 120, heightMapUnits: 68}.nal()[:5],
+			wantErr: true,
+		},
+		{
+			name:    "too short",
+			nal:     []byte{0x67, 66},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sps, err := parseH264SPS(tt.nal)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseH264SPS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if sps.width != tt.width || sps.height != tt.height {
+				t.Errorf("size = %dx%d, want %dx%d", sps.width, sps.height, tt.width, tt.height)
+			}
+			if sps.highProfile != tt.high || sps.bitDepthLuma != tt.bitDepth {
+				t.Errorf("high = %v depth %d, want %v depth %d", sps.highProfile, sps.bitDepthLuma, tt.high, tt.bitDepth)
+			}
+		})
+	}
+}
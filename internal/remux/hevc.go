@@ -0,0 +1,169 @@
+package remux
+
+import "fmt"
+
+const (
+	hevcNALIRAPFirst = 16
+	hevcNALIRAPLast  = 23
+	hevcNALVPS       = 32
+	hevcNALSPS       = 33
+	hevcNALPPS       = 34
+	hevcNALAUD       = 35
+)
+
+// hevcCodec collects HEVC parameter sets and builds the hvc1 sample entry
+type hevcCodec struct {
+	vps []byte
+	sps []byte
+	pps []byte
+}
+
+func (c *hevcCodec) filter(nal []byte) (keep, key bool) {
+	if len(nal) < 2 {
+		return false, false
+	}
+
+	typ := (nal[0] >> 1) & 0x3F
+	switch {
+	case typ == hevcNALVPS:
+		if c.vps == nil {
+			c.vps = append([]byte{}, nal...)
+		}
+		return false, false
+	case typ == hevcNALSPS:
+		if c.sps == nil {
+			c.sps = append([]byte{}, nal...)
+		}
+		return false, false
+	case typ == hevcNALPPS:
+		if c.pps == nil {
+			c.pps = append([]byte{}, nal...)
+		}
+		return false, false
+	case typ == hevcNALAUD:
+		return false, false
+	case typ >= hevcNALIRAPFirst && typ <= hevcNALIRAPLast:
+		return true, true
+	}
+	return true, false
+}
+
+func (c *hevcCodec) ready() bool {
+	return c.vps != nil && c.sps != nil && c.pps != nil
+}
+
+func (c *hevcCodec) sampleEntry() ([]byte, int, int, error) {
+	sps, err := parseHEVCSPS(c.sps)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid SPS: %w", err)
+	}
+
+	// HEVCDecoderConfigurationRecord
+	hvcC := []byte{1, sps.ptl[0]}
+	hvcC = append(hvcC, sps.ptl[1:12]...) // compatibility, constraint flags, level
+	hvcC = append(hvcC,
+		0xF0, 0x00, // min_spatial_segmentation_idc
+		0xFC,                            // parallelismType
+		0xFC|byte(sps.chromaFormat),     // chromaFormat
+		0xF8|byte(sps.bitDepthLuma-8),   // bitDepthLumaMinus8
+		0xF8|byte(sps.bitDepthChroma-8), // bitDepthChromaMinus8
+		0x00, 0x00,                      // avgFrameRate
+		byte(sps.maxSubLayers)<<3|byte(sps.temporalIDNesting)<<2|3, // lengthSizeMinusOne = 3
+		3, // numOfArrays
+	)
+	for _, ps := range []struct {
+		typ byte
+		nal []byte
+	}{{hevcNALVPS, c.vps}, {hevcNALSPS, c.sps}, {hevcNALPPS, c.pps}} {
+		hvcC = append(hvcC, 0x80|ps.typ)
+		hvcC = appendU16(hvcC, 1)
+		hvcC = appendU16(hvcC, uint16(len(ps.nal)))
+		hvcC = append(hvcC, ps.nal...)
+	}
+
+	entry := visualSampleEntry("hvc1", sps.width, sps.height, mkbox("hvcC", hvcC))
+	return entry, sps.width, sps.height, nil
+}
+
+type hevcSPS struct {
+	width, height     int
+	chromaFormat      int
+	bitDepthLuma      int
+	bitDepthChroma    int
+	maxSubLayers      int
+	temporalIDNesting int
+	ptl               [12]byte // general profile_tier_level bytes
+}
+
+func parseHEVCSPS(nal []byte) (*hevcSPS, error) {
+	if len(nal) < 3 {
+		return nil, errShortData
+	}
+
+	rbsp := unescapeRBSP(nal[2:])
+	r := &bitReader{data: rbsp}
+	sps := &hevcSPS{}
+
+	r.skip(4) // sps_video_parameter_set_id
+	sps.maxSubLayers = int(r.u(3)) + 1
+	sps.temporalIDNesting = int(r.u(1))
+
+	// general_profile_tier_level is byte aligned here
+	if len(rbsp) < 13 {
+		return nil, errShortData
+	}
+	copy(sps.ptl[:], rbsp[1:13])
+	r.skip(96)
+
+	subProfile := make([]bool, sps.maxSubLayers-1)
+	subLevel := make([]bool, sps.maxSubLayers-1)
+	for i := range subProfile {
+		subProfile[i] = r.flag()
+		subLevel[i] = r.flag()
+	}
+	if sps.maxSubLayers > 1 {
+		for i := sps.maxSubLayers - 1; i < 8; i++ {
+			r.skip(2) // reserved_zero_2bits
+		}
+	}
+	for i := range subProfile {
+		if subProfile[i] {
+			r.skip(88)
+		}
+		if subLevel[i] {
+			r.skip(8)
+		}
+	}
+
+	r.ue() // sps_seq_parameter_set_id
+	sps.chromaFormat = int(r.ue())
+	if sps.chromaFormat == 3 {
+		r.skip(1) // separate_colour_plane_flag
+	}
+	width := int(r.ue())
+	height := int(r.ue())
+
+	if r.flag() { // conformance_window_flag
+		subW, subH := 1, 1
+		switch sps.chromaFormat {
+		case 1:
+			subW, subH = 2, 2
+		case 2:
+			subW = 2
+		}
+		left, right := int(r.ue()), int(r.ue())
+		top, bottom := int(r.ue()), int(r.ue())
+		width -= subW * (left + right)
+		height -= subH * (top + bottom)
+	}
+
+	sps.bitDepthLuma = int(r.ue()) + 8
+	sps.bitDepthChroma = int(r.ue()) + 8
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	sps.width, sps.height = width, height
+	return sps, nil
+}
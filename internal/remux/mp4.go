@@ -0,0 +1,273 @@
+package remux
+
+import (
+	"encoding/binary"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	movieTimescale = 1000
+	videoTimescale = 90000
+)
+
+// mp4Epoch is the reference time of MP4 creation timestamps
+var mp4Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func appendU16(b []byte, v uint16) []byte { return binary.BigEndian.AppendUint16(b, v) }
+func appendU32(b []byte, v uint32) []byte { return binary.BigEndian.AppendUint32(b, v) }
+func appendU64(b []byte, v uint64) []byte { return binary.BigEndian.AppendUint64(b, v) }
+
+// mkbox wraps the concatenated parts in a box of the given type
+func mkbox(typ string, parts ...[]byte) []byte {
+	size := 8
+	for _, p := range parts {
+		size += len(p)
+	}
+	b := make([]byte, 0, size)
+	b = appendU32(b, uint32(size))
+	b = append(b, typ...)
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// mkfullbox is mkbox with a version and flags header
+func mkfullbox(typ string, version byte, flags uint32, parts ...[]byte) []byte {
+	header := appendU32(nil, uint32(version)<<24|flags&0xFFFFFF)
+	return mkbox(typ, append([][]byte{header}, parts...)...)
+}
+
+// unityMatrix is the identity transformation used by mvhd and tkhd
+var unityMatrix = func() []byte {
+	var b []byte
+	for _, v := range []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000} {
+		b = appendU32(b, v)
+	}
+	return b
+}()
+
+func visualSampleEntry(typ string, width, height int, config []byte) []byte {
+	b := make([]byte, 6)               // reserved
+	b = appendU16(b, 1)                // data_reference_index
+	b = append(b, make([]byte, 16)...) // pre_defined, reserved
+	b = appendU16(b, uint16(width))
+	b = appendU16(b, uint16(height))
+	b = appendU32(b, 0x00480000) // 72 dpi
+	b = appendU32(b, 0x00480000)
+	b = appendU32(b, 0)                // reserved
+	b = appendU16(b, 1)                // frame_count
+	b = append(b, make([]byte, 32)...) // compressorname
+	b = appendU16(b, 0x0018)           // depth
+	b = appendU16(b, 0xFFFF)           // pre_defined
+	return mkbox(typ, b, config)
+}
+
+// track is the sample table of the single video track
+type track struct {
+	sampleEntry   []byte
+	width, height int
+	sizes         []uint32
+	durations     []uint32
+	ctsOffsets    []int32
+	keyframes     []uint32 // 1-based sample numbers
+	mediaDuration int64    // in videoTimescale
+}
+
+// moov builds the movie box for samples stored contiguously at dataOffset
+func (t *track) moov(dataOffset int64, created time.Time, tags [][2]string, chapters []Chapter) []byte {
+	ts := uint32(0)
+	if !created.IsZero() {
+		ts = uint32(created.Sub(mp4Epoch).Seconds())
+	}
+	movieDuration := uint32(t.mediaDuration * movieTimescale / videoTimescale)
+
+	mvhd := appendU32(nil, ts)
+	mvhd = appendU32(mvhd, ts)
+	mvhd = appendU32(mvhd, movieTimescale)
+	mvhd = appendU32(mvhd, movieDuration)
+	mvhd = appendU32(mvhd, 0x00010000) // rate 1.0
+	mvhd = appendU16(mvhd, 0x0100)     // volume 1.0
+	mvhd = append(mvhd, make([]byte, 10)...)
+	mvhd = append(mvhd, unityMatrix...)
+	mvhd = append(mvhd, make([]byte, 24)...)
+	mvhd = appendU32(mvhd, 2) // next_track_ID
+
+	tkhd := appendU32(nil, ts)
+	tkhd = appendU32(tkhd, ts)
+	tkhd = appendU32(tkhd, 1) // track_ID
+	tkhd = appendU32(tkhd, 0)
+	tkhd = appendU32(tkhd, movieDuration)
+	tkhd = append(tkhd, make([]byte, 16)...) // reserved, layer, alternate_group, volume, reserved
+	tkhd = append(tkhd, unityMatrix...)
+	tkhd = appendU32(tkhd, uint32(t.width)<<16)
+	tkhd = appendU32(tkhd, uint32(t.height)<<16)
+
+	// Start presentation at the first sample's composition time
+	elst := appendU32(nil, 1)
+	elst = appendU32(elst, movieDuration)
+	elst = appendU32(elst, uint32(max(t.ctsOffsets[0], 0)))
+	elst = appendU32(elst, 0x00010000)
+
+	mdhd := appendU32(nil, ts)
+	mdhd = appendU32(mdhd, ts)
+	mdhd = appendU32(mdhd, videoTimescale)
+	mdhd = appendU32(mdhd, uint32(t.mediaDuration))
+	mdhd = appendU16(mdhd, 0x55C4) // "und"
+	mdhd = appendU16(mdhd, 0)
+
+	hdlr := appendU32(nil, 0)
+	hdlr = append(hdlr, "vide"...)
+	hdlr = append(hdlr, make([]byte, 12)...)
+	hdlr = append(hdlr, "VideoHandler\x00"...)
+
+	vmhd := make([]byte, 8) // graphicsmode, opcolor
+	dref := mkfullbox("dref", 0, 0, appendU32(nil, 1), mkfullbox("url ", 0, 1))
+
+	stbl := mkbox("stbl",
+		mkfullbox("stsd", 0, 0, appendU32(nil, 1), t.sampleEntry),
+		t.stts(),
+		t.ctts(),
+		t.stss(),
+		mkfullbox("stsc", 0, 0, appendU32(appendU32(appendU32(appendU32(nil, 1), 1), uint32(len(t.sizes))), 1)),
+		t.stsz(),
+		chunkOffsetBox(dataOffset),
+	)
+
+	trak := mkbox("trak",
+		mkfullbox("tkhd", 0, 3, tkhd),
+		mkbox("edts", mkfullbox("elst", 0, 0, elst)),
+		mkbox("mdia",
+			mkfullbox("mdhd", 0, 0, mdhd),
+			mkfullbox("hdlr", 0, 0, hdlr),
+			mkbox("minf",
+				mkfullbox("vmhd", 0, 1, vmhd),
+				mkbox("dinf", dref),
+				stbl,
+			),
+		),
+	)
+
+	return mkbox("moov", mkfullbox("mvhd", 0, 0, mvhd), trak, udta(tags, chapters))
+}
+
+func (t *track) stts() []byte {
+	return mkfullbox("stts", 0, 0, runLength(t.durations))
+}
+
+func (t *track) ctts() []byte {
+	allZero := true
+	for _, o := range t.ctsOffsets {
+		if o != 0 {
+			allZero = false
+			break
+		}
+	}
+	if allZero {
+		return nil
+	}
+
+	offsets := make([]uint32, len(t.ctsOffsets))
+	version := byte(0)
+	for i, o := range t.ctsOffsets {
+		if o < 0 {
+			version = 1
+		}
+		offsets[i] = uint32(o)
+	}
+	return mkfullbox("ctts", version, 0, runLength(offsets))
+}
+
+func (t *track) stss() []byte {
+	b := appendU32(nil, uint32(len(t.keyframes)))
+	for _, k := range t.keyframes {
+		b = appendU32(b, k)
+	}
+	return mkfullbox("stss", 0, 0, b)
+}
+
+func (t *track) stsz() []byte {
+	b := appendU32(nil, 0)
+	b = appendU32(b, uint32(len(t.sizes)))
+	for _, s := range t.sizes {
+		b = appendU32(b, s)
+	}
+	return mkfullbox("stsz", 0, 0, b)
+}
+
+// runLength encodes values as (count, value) pairs prefixed by the count
+func runLength(values []uint32) []byte {
+	var entries []byte
+	n := uint32(0)
+	for i := 0; i < len(values); {
+		j := i
+		for j < len(values) && values[j] == values[i] {
+			j++
+		}
+		entries = appendU32(appendU32(entries, uint32(j-i)), values[i])
+		n++
+		i = j
+	}
+	return append(appendU32(nil, n), entries...)
+}
+
+// chunkOffsetBox stores the single chunk offset, in 64 bits when needed
+func chunkOffsetBox(offset int64) []byte {
+	if offset > 0xFFFFFFFF {
+		return mkfullbox("co64", 0, 0, appendU32(nil, 1), appendU64(nil, uint64(offset)))
+	}
+	return mkfullbox("stco", 0, 0, appendU32(nil, 1), appendU32(nil, uint32(offset)))
+}
+
+// udta stores tags as iTunes-style freeform metadata items and chapters as
+// a Nero chapter list
+func udta(tags [][2]string, chapters []Chapter) []byte {
+	if len(tags) == 0 && len(chapters) == 0 {
+		return nil
+	}
+	if len(tags) == 0 {
+		return mkbox("udta", chpl(chapters))
+	}
+
+	var items []byte
+	for _, tag := range tags {
+		data := appendU32(nil, 1) // UTF-8
+		data = appendU32(data, 0) // locale
+		items = append(items, mkbox("----",
+			mkfullbox("mean", 0, 0, []byte("com.apple.iTunes")),
+			mkfullbox("name", 0, 0, []byte(tag[0])),
+			mkbox("data", data, []byte(tag[1])),
+		)...)
+	}
+
+	hdlr := appendU32(nil, 0)
+	hdlr = append(hdlr, "mdir"...)
+	hdlr = append(hdlr, "appl"...)
+	hdlr = append(hdlr, make([]byte, 9)...)
+
+	return mkbox("udta", chpl(chapters), mkfullbox("meta", 0, 0, mkfullbox("hdlr", 0, 0, hdlr), mkbox("ilst", items)))
+}
+
+// chpl is the Nero chapter list, with start times in 100ns units and up to
+// 255 chapters of up to 255 bytes each
+func chpl(chapters []Chapter) []byte {
+	if len(chapters) == 0 {
+		return nil
+	}
+	chapters = chapters[:min(len(chapters), 255)]
+
+	b := appendU32(nil, 0) // reserved
+	b = append(b, byte(len(chapters)))
+	for _, c := range chapters {
+		title := c.Title
+		for len(title) > 255 {
+			_, size := utf8.DecodeLastRuneInString(title)
+			title = title[:len(title)-size]
+		}
+		b = appendU64(b, uint64(max(c.Start, 0)/100))
+		b = append(b, byte(len(title)))
+		b = append(b, title...)
+	}
+	return mkfullbox("chpl", 1, 0, b)
+}
@@ -0,0 +1,323 @@
+package remux
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testBox is a parsed box with its offset in the parsed buffer
+type testBox struct {
+	typ     string
+	offset  int
+	payload []byte
+}
+
+// parseBoxes splits b into its top level boxes
+func parseBoxes(t *testing.T, b []byte) []testBox {
+	t.Helper()
+	var boxes []testBox
+	for pos := 0; pos < len(b); {
+		if pos+8 > len(b) {
+			t.Fatalf("truncated box header at %d", pos)
+		}
+		size := int(binary.BigEndian.Uint32(b[pos:]))
+		header := 8
+		if size == 1 {
+			size = int(binary.BigEndian.Uint64(b[pos+8:]))
+			header = 16
+		}
+		if size < header || pos+size > len(b) {
+			t.Fatalf("box %q at %d has bad size %d", b[pos+4:pos+8], pos, size)
+		}
+		boxes = append(boxes, testBox{typ: string(b[pos+4 : pos+8]), offset: pos, payload: b[pos+header : pos+size]})
+		pos += size
+	}
+	return boxes
+}
+
+// findBox descends through container boxes and returns the payload of the
+// last box on the path, or nil when it is missing. Full boxes along the path
+// need their version and flags skipped by the caller.
+func findBox(t *testing.T, b []byte, path ...string) []byte {
+	t.Helper()
+	for i, typ := range path {
+		var found []byte
+		for _, box := range parseBoxes(t, b) {
+			if box.typ == typ {
+				found = box.payload
+				break
+			}
+		}
+		if found == nil {
+			return nil
+		}
+		if i+1 < len(path) && typ == "meta" {
+			found = found[4:]
+		}
+		b = found
+	}
+	return b
+}
+
+func u32(b []byte, off int) uint32 { return binary.BigEndian.Uint32(b[off:]) }
+
+func TestChunkOffsetBox(t *testing.T) {
+	tests := []struct {
+		offset  int64
+		wantTyp string
+	}{
+		{0, "stco"},
+		{48, "stco"},
+		{0xFFFFFFFF, "stco"},
+		{0x100000000, "co64"},
+		{0x123456789A, "co64"},
+	}
+
+	for _, tt := range tests {
+		boxes := parseBoxes(t, chunkOffsetBox(tt.offset))
+		if len(boxes) != 1 || boxes[0].typ != tt.wantTyp {
+			t.Errorf("chunkOffsetBox(%#x) = %v, want a single %s", tt.offset, boxes, tt.wantTyp)
+			continue
+		}
+		p := boxes[0].payload
+		if n := u32(p, 4); n != 1 {
+			t.Errorf("chunkOffsetBox(%#x) has %d entries, want 1", tt.offset, n)
+		}
+		var got int64
+		if tt.wantTyp == "co64" {
+			got = int64(binary.BigEndian.Uint64(p[8:]))
+		} else {
+			got = int64(u32(p, 8))
+		}
+		if got != tt.offset {
+			t.Errorf("chunkOffsetBox(%#x) stores %#x", tt.offset, got)
+		}
+	}
+}
+
+func testTrack(ctsOffsets ...int32) *track {
+	t := &track{sampleEntry: mkbox("avc1"), width: 64, height: 64}
+	for i, o := range ctsOffsets {
+		t.sizes = append(t.sizes, 100)
+		t.durations = append(t.durations, 3000)
+		t.ctsOffsets = append(t.ctsOffsets, o)
+		if i%3 == 0 {
+			t.keyframes = append(t.keyframes, uint32(i+1))
+		}
+		t.mediaDuration += 3000
+	}
+	return t
+}
+
+func TestMoovChunkOffset(t *testing.T) {
+	for _, offset := range []int64{1000, 1 << 32} {
+		moov := findBox(t, testTrack(0, 0, 0).moov(offset, time.Time{}, nil, nil), "moov")
+		stbl := findBox(t, moov, "trak", "mdia", "minf", "stbl")
+		stco, co64 := findBox(t, stbl, "stco"), findBox(t, stbl, "co64")
+		if (offset > 0xFFFFFFFF) != (co64 != nil) || (stco == nil) == (co64 == nil) {
+			t.Errorf("offset %#x: stco %v co64 %v", offset, stco != nil, co64 != nil)
+		}
+	}
+}
+
+func TestMoovEditList(t *testing.T) {
+	tests := []struct {
+		name          string
+		track         *track
+		wantDuration  uint32 // movie timescale
+		wantMedia     uint32 // video timescale
+		wantMediaTime uint32
+		wantCtts      int // ctts version, -1 for none
+	}{
+		{
+			name:         "no reordering",
+			track:        testTrack(0, 0, 0, 0, 0, 0),
+			wantDuration: 200,
+			wantMedia:    18000,
+			wantCtts:     -1,
+		},
+		{
+			name:          "b-frames",
+			track:         testTrack(6000, 9000, 3000, 6000, 9000, 3000),
+			wantDuration:  200,
+			wantMedia:     18000,
+			wantMediaTime: 6000,
+			wantCtts:      0,
+		},
+		{
+			name:         "negative composition offset",
+			track:        testTrack(-3000, 3000, 0, 0, 0),
+			wantDuration: 166,
+			wantMedia:    15000,
+			wantCtts:     1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moov := findBox(t, tt.track.moov(0, time.Time{}, nil, nil), "moov")
+
+			if got := u32(findBox(t, moov, "mvhd"), 16); got != tt.wantDuration {
+				t.Errorf("mvhd duration = %d, want %d", got, tt.wantDuration)
+			}
+			if got := u32(findBox(t, moov, "trak", "tkhd"), 20); got != tt.wantDuration {
+				t.Errorf("tkhd duration = %d, want %d", got, tt.wantDuration)
+			}
+			if got := u32(findBox(t, moov, "trak", "mdia", "mdhd"), 16); got != tt.wantMedia {
+				t.Errorf("mdhd duration = %d, want %d", got, tt.wantMedia)
+			}
+
+			elst := findBox(t, moov, "trak", "edts", "elst")
+			if n := u32(elst, 4); n != 1 {
+				t.Fatalf("elst has %d entries, want 1", n)
+			}
+			if got := u32(elst, 8); got != tt.wantDuration {
+				t.Errorf("elst segment duration = %d, want %d", got, tt.wantDuration)
+			}
+			if got := u32(elst, 12); got != tt.wantMediaTime {
+				t.Errorf("elst media time = %d, want %d", got, tt.wantMediaTime)
+			}
+
+			ctts := findBox(t, moov, "trak", "mdia", "minf", "stbl", "ctts")
+			switch {
+			case tt.wantCtts < 0 && ctts != nil:
+				t.Error("unexpected ctts box")
+			case tt.wantCtts >= 0 && ctts == nil:
+				t.Error("missing ctts box")
+			case ctts != nil && int(ctts[0]) != tt.wantCtts:
+				t.Errorf("ctts version = %d, want %d", ctts[0], tt.wantCtts)
+			}
+		})
+	}
+}
+
+func TestMoovCreationTime(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	mvhd := findBox(t, testTrack(0).moov(0, created, nil, nil), "moov", "mvhd")
+	if got, want := u32(mvhd, 4), uint32(created.Sub(mp4Epoch)/time.Second); got != want {
+		t.Errorf("creation time = %d, want %d", got, want)
+	}
+}
+
+// readChpl decodes a chpl payload
+func readChpl(t *testing.T, p []byte) []Chapter {
+	t.Helper()
+	if p[0] != 1 {
+		t.Fatalf("chpl version = %d, want 1", p[0])
+	}
+	n := int(p[8])
+	p = p[9:]
+	chapters := make([]Chapter, 0, n)
+	for range n {
+		start := time.Duration(binary.BigEndian.Uint64(p)) * 100
+		size := int(p[8])
+		chapters = append(chapters, Chapter{Start: start, Title: string(p[9 : 9+size])})
+		p = p[9+size:]
+	}
+	if len(p) != 0 {
+		t.Errorf("%d trailing bytes in chpl", len(p))
+	}
+	return chapters
+}
+
+// readIlst decodes the freeform items of an ilst payload
+func readIlst(t *testing.T, p []byte) [][2]string {
+	t.Helper()
+	var tags [][2]string
+	for _, item := range parseBoxes(t, p) {
+		if item.typ != "----" {
+			t.Fatalf("unexpected ilst item %q", item.typ)
+		}
+		mean := findBox(t, item.payload, "mean")
+		name := findBox(t, item.payload, "name")
+		data := findBox(t, item.payload, "data")
+		if string(mean[4:]) != "com.apple.iTunes" {
+			t.Errorf("mean = %q", mean[4:])
+		}
+		if u32(data, 0) != 1 {
+			t.Errorf("data type = %d, want UTF-8", u32(data, 0))
+		}
+		tags = append(tags, [2]string{string(name[4:]), string(data[8:])})
+	}
+	return tags
+}
+
+func TestUdta(t *testing.T) {
+	many := make([]Chapter, 300)
+	for i := range many {
+		many[i] = Chapter{Start: time.Duration(i) * time.Second, Title: "c"}
+	}
+
+	tests := []struct {
+		name         string
+		tags         [][2]string
+		chapters     []Chapter
+		wantChapters []Chapter
+	}{
+		{name: "empty"},
+		{
+			name: "tags only",
+			tags: [][2]string{{"rewind.game", "Portal 2"}, {"rewind.note", ""}},
+		},
+		{
+			name:         "chapters only",
+			chapters:     []Chapter{{0, "Start"}, {1500 * time.Millisecond, "Clutch"}},
+			wantChapters: []Chapter{{0, "Start"}, {1500 * time.Millisecond, "Clutch"}},
+		},
+		{
+			name:         "tags and chapters",
+			tags:         [][2]string{{"rewind.game", "Hades"}},
+			chapters:     []Chapter{{-time.Second, "Before"}, {time.Hour, "Late"}},
+			wantChapters: []Chapter{{0, "Before"}, {time.Hour, "Late"}},
+		},
+		{
+			name:         "long title truncated at a rune boundary",
+			chapters:     []Chapter{{0, strings.Repeat("é", 200)}},
+			wantChapters: []Chapter{{0, strings.Repeat("é", 127)}},
+		},
+		{
+			name:         "chapter count capped",
+			chapters:     many,
+			wantChapters: many[:255],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := udta(tt.tags, tt.chapters)
+			if len(tt.tags) == 0 && len(tt.chapters) == 0 {
+				if b != nil {
+					t.Fatalf("udta() = %x, want nil", b)
+				}
+				return
+			}
+
+			box := findBox(t, b, "udta")
+			if box == nil {
+				t.Fatal("missing udta box")
+			}
+
+			var chapters []Chapter
+			if chpl := findBox(t, box, "chpl"); chpl != nil {
+				chapters = readChpl(t, chpl)
+			}
+			if !reflect.DeepEqual(chapters, tt.wantChapters) {
+				t.Errorf("chapters = %v, want %v", chapters, tt.wantChapters)
+			}
+
+			var tags [][2]string
+			if ilst := findBox(t, box, "meta", "ilst"); ilst != nil {
+				if hdlr := findBox(t, box, "meta", "hdlr"); string(hdlr[8:12]) != "mdir" {
+					t.Errorf("meta handler = %q, want mdir", hdlr[8:12])
+				}
+				tags = readIlst(t, ilst)
+			}
+			if !reflect.DeepEqual(tags, tt.tags) {
+				t.Errorf("tags = %q, want %q", tags, tt.tags)
+			}
+		})
+	}
+}
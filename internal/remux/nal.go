@@ -0,0 +1,35 @@
+package remux
+
+// splitAnnexB returns the NAL units of an Annex B byte stream without their
+// start codes
+func splitAnnexB(data []byte) [][]byte {
+	var nals [][]byte
+	start := -1
+
+	for i := 0; i+2 < len(data); i++ {
+		if data[i] != 0 || data[i+1] != 0 || data[i+2] != 1 {
+			continue
+		}
+		if start >= 0 {
+			nals = appendNAL(nals, data[start:i])
+		}
+		start = i + 3
+		i += 2
+	}
+
+	if start >= 0 && start < len(data) {
+		nals = appendNAL(nals, data[start:])
+	}
+	return nals
+}
+
+// appendNAL drops the trailing zero bytes that belong to a 4-byte start code
+func appendNAL(nals [][]byte, nal []byte) [][]byte {
+	for len(nal) > 0 && nal[len(nal)-1] == 0 {
+		nal = nal[:len(nal)-1]
+	}
+	if len(nal) == 0 {
+		return nals
+	}
+	return append(nals, nal)
+}
@@ -0,0 +1,201 @@
+// Package remux converts the MPEG-TS video stream produced by the capturer
+// into an MP4 file without calling ffmpeg.
+package remux
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Options controls TSToMP4
+type Options struct {
+	// Duration keeps only the last Duration of video, starting at the
+	// keyframe at or before the cut point. 0 keeps everything.
+	Duration time.Duration
+
+	// CreatedAt is stored as the movie creation time
+	CreatedAt time.Time
+
+	// Tags are written as freeform metadata items
+	Tags [][2]string
+
+	// Chapters are written as a chapter list. With Duration set their start
+	// times count from the cut point, so they move with the keyframe the
+	// clip actually starts at.
+	Chapters []Chapter
+}
+
+// Chapter is a named point on the movie timeline
+type Chapter struct {
+	Start time.Duration
+	Title string
+}
+
+// videoCodec handles the codec specific parts of the remux
+type videoCodec interface {
+	// filter stores parameter sets and reports whether a NAL unit belongs
+	// in the sample and whether it is a keyframe slice
+	filter(nal []byte) (keep, key bool)
+	ready() bool
+	sampleEntry() (entry []byte, width, height int, err error)
+}
+
+type sample struct {
+	pts, dts int64
+	data     []byte // length-prefixed NAL units
+	key      bool
+}
+
+// TSToMP4 remuxes an H.264 or HEVC transport stream into a progressive MP4
+// with the movie box in front. Audio streams are ignored.
+func TSToMP4(ts []byte, w io.Writer, opts Options) error {
+	streamType, units, err := demuxTS(ts)
+	if err != nil {
+		return err
+	}
+
+	var codec videoCodec
+	brand := "avc1"
+	switch streamType {
+	case streamTypeH264:
+		codec = &h264Codec{}
+	case streamTypeHEVC:
+		codec = &hevcCodec{}
+		brand = "hvc1"
+	default:
+		return ErrNoVideo
+	}
+
+	samples := make([]sample, 0, len(units))
+	for _, au := range units {
+		var data []byte
+		key := false
+		for _, nal := range splitAnnexB(au.data) {
+			keep, k := codec.filter(nal)
+			if !keep {
+				continue
+			}
+			key = key || k
+			data = appendU32(data, uint32(len(nal)))
+			data = append(data, nal...)
+		}
+		if len(data) > 0 {
+			samples = append(samples, sample{pts: au.pts, dts: au.dts, data: data, key: key})
+		}
+	}
+
+	samples, err = trim(samples, opts.Duration)
+	if err != nil {
+		return err
+	}
+	if !codec.ready() {
+		return errors.New("missing parameter sets")
+	}
+
+	entry, width, height, err := codec.sampleEntry()
+	if err != nil {
+		return err
+	}
+
+	t := &track{sampleEntry: entry, width: width, height: height}
+	var mdatSize int64
+	for i, s := range samples {
+		var dur int64
+		switch {
+		case i+1 < len(samples):
+			dur = samples[i+1].dts - s.dts
+		case i > 0:
+			dur = s.dts - samples[i-1].dts
+		default:
+			dur = videoTimescale / 30
+		}
+		if dur <= 0 {
+			dur = 1
+		}
+
+		t.sizes = append(t.sizes, uint32(len(s.data)))
+		t.durations = append(t.durations, uint32(dur))
+		t.ctsOffsets = append(t.ctsOffsets, int32(s.pts-s.dts))
+		if s.key {
+			t.keyframes = append(t.keyframes, uint32(i+1))
+		}
+		t.mediaDuration += dur
+		mdatSize += int64(len(s.data))
+	}
+
+	ftyp := mkbox("ftyp", []byte("isom"), appendU32(nil, 0x200), []byte("isomiso2"+brand+"mp41"))
+
+	mdatHeader := appendU32(nil, uint32(8+mdatSize))
+	mdatHeader = append(mdatHeader, "mdat"...)
+	if 8+mdatSize > 0xFFFFFFFF {
+		mdatHeader = appendU32(nil, 1)
+		mdatHeader = append(mdatHeader, "mdat"...)
+		mdatHeader = appendU64(mdatHeader, uint64(16+mdatSize))
+	}
+
+	chapters := opts.Chapters
+	if opts.Duration > 0 {
+		lead := time.Duration(t.mediaDuration)*time.Second/videoTimescale - opts.Duration
+		if lead > 0 {
+			chapters = make([]Chapter, len(opts.Chapters))
+			for i, c := range opts.Chapters {
+				chapters[i] = Chapter{Start: c.Start + lead, Title: c.Title}
+			}
+		}
+	}
+
+	// The chunk offset depends on the moov size, which only changes if the
+	// offset needs 64 bits
+	moov := t.moov(0, opts.CreatedAt, opts.Tags, chapters)
+	for {
+		offset := int64(len(ftyp) + len(moov) + len(mdatHeader))
+		next := t.moov(offset, opts.CreatedAt, opts.Tags, chapters)
+		if len(next) == len(moov) {
+			moov = next
+			break
+		}
+		moov = next
+	}
+
+	bw := bufio.NewWriterSize(w, 8*1024*1024)
+	for _, part := range [][]byte{ftyp, moov, mdatHeader} {
+		if _, err := bw.Write(part); err != nil {
+			return err
+		}
+	}
+	for _, s := range samples {
+		if _, err := bw.Write(s.data); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// trim drops samples before the first keyframe and, when duration is set,
+// everything before the last keyframe that still covers duration
+func trim(samples []sample, duration time.Duration) ([]sample, error) {
+	first := -1
+	for i, s := range samples {
+		if s.key {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return nil, fmt.Errorf("no keyframe in %d samples", len(samples))
+	}
+
+	cut := first
+	if duration > 0 {
+		target := samples[len(samples)-1].dts - int64(duration)*videoTimescale/int64(time.Second)
+		for i := first; i < len(samples) && samples[i].dts <= target; i++ {
+			if samples[i].key {
+				cut = i
+			}
+		}
+	}
+	return samples[cut:], nil
+}
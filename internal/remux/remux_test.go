@@ -0,0 +1,179 @@
+package remux
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestTrim(t *testing.T) {
+	// 10 samples 100ms apart with keyframes every 300ms
+	gop := func(first int) []sample {
+		var s []sample
+		for i := range 10 {
+			s = append(s, sample{dts: int64(i) * 9000, pts: int64(i) * 9000, key: i >= first && (i-first)%3 == 0})
+		}
+		return s
+	}
+
+	tests := []struct {
+		name     string
+		samples  []sample
+		duration time.Duration
+		wantDTS  int64 // of the first kept sample
+		wantLen  int
+		wantErr  bool
+	}{
+		{name: "keeps everything", samples: gop(0), wantDTS: 0, wantLen: 10},
+		{name: "drops leading non-keyframes", samples: gop(2), wantDTS: 18000, wantLen: 8},
+		{name: "cuts before the target", samples: gop(0), duration: 400 * time.Millisecond, wantDTS: 27000, wantLen: 7},
+		{name: "cuts at a keyframe on the target", samples: gop(0), duration: 300 * time.Millisecond, wantDTS: 54000, wantLen: 4},
+		{name: "duration past the start", samples: gop(1), duration: time.Minute, wantDTS: 9000, wantLen: 9},
+		{name: "shorter than a gop keeps the gop", samples: gop(0), duration: 50 * time.Millisecond, wantDTS: 54000, wantLen: 4},
+		{name: "no keyframe", samples: gop(10), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := trim(tt.samples, tt.duration)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("trim() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(got) != tt.wantLen || got[0].dts != tt.wantDTS {
+				t.Errorf("trim() kept %d samples from dts %d, want %d from %d", len(got), got[0].dts, tt.wantLen, tt.wantDTS)
+			}
+			if !got[0].key {
+				t.Error("trim() does not start at a keyframe")
+			}
+		})
+	}
+}
+
+// h264Fixture builds a 64x64 stream of two 3-frame GOPs with one frame of
+// reordering delay, parameter sets in front of each IDR and AUDs everywhere
+func h264Fixture() []byte {
+	sps := testSPS{profile: 66, widthMbs: 4, heightMapUnits: 4}.nal()
+	pps := []byte{0x68, 0xCE, 0x3C, 0x80}
+
+	var units []accessUnit
+	for i := range 6 {
+		data := []byte{0, 0, 0, 1, 0x09, 0xF0}
+		slice := append([]byte{0x41}, testPayload(200+i*150, byte(i))...)
+		if i%3 == 0 {
+			data = append(data, 0, 0, 0, 1)
+			data = append(data, sps...)
+			data = append(data, 0, 0, 0, 1)
+			data = append(data, pps...)
+			slice[0] = 0x65
+		}
+		data = append(data, 0, 0, 1)
+		data = append(data, slice...)
+
+		dts := int64(i) * 3000
+		units = append(units, accessUnit{pts: dts + 3000, dts: dts, data: data})
+	}
+	return videoTS(streamTypeH264, units)
+}
+
+func TestTSToMP4Golden(t *testing.T) {
+	tsPath := filepath.Join("testdata", "h264.ts")
+	mp4Path := filepath.Join("testdata", "h264.mp4")
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(tsPath, h264Fixture(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ts, err := os.ReadFile(tsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err = TSToMP4(ts, &out, Options{
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Tags:      [][2]string{{"rewind.game", "Test"}},
+		Chapters:  []Chapter{{0, "Start"}, {100 * time.Millisecond, "Marker"}},
+	})
+	if err != nil {
+		t.Fatalf("TSToMP4() error = %v", err)
+	}
+	got := out.Bytes()
+
+	if *update {
+		if err := os.WriteFile(mp4Path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	boxes := parseBoxes(t, got)
+	var types []string
+	for _, b := range boxes {
+		types = append(types, b.typ)
+	}
+	if !reflect.DeepEqual(types, []string{"ftyp", "moov", "mdat"}) {
+		t.Fatalf("top level boxes = %v", types)
+	}
+	moov, mdat := boxes[1].payload, boxes[2]
+
+	if got := u32(findBox(t, moov, "mvhd"), 16); got != 200 {
+		t.Errorf("movie duration = %d, want 200", got)
+	}
+	if got := u32(findBox(t, moov, "trak", "edts", "elst"), 12); got != 3000 {
+		t.Errorf("elst media time = %d, want 3000", got)
+	}
+	if tkhd := findBox(t, moov, "trak", "tkhd"); u32(tkhd, 76)>>16 != 64 || u32(tkhd, 80)>>16 != 64 {
+		t.Errorf("track size = %dx%d, want 64x64", u32(tkhd, 76)>>16, u32(tkhd, 80)>>16)
+	}
+
+	stbl := findBox(t, moov, "trak", "mdia", "minf", "stbl")
+	if stss := findBox(t, stbl, "stss"); u32(stss, 4) != 2 || u32(stss, 8) != 1 || u32(stss, 12) != 4 {
+		t.Errorf("stss = %x, want samples 1 and 4", stss)
+	}
+
+	// Samples hold only the slices, length prefixed, starting where stco
+	// points
+	stsz := findBox(t, stbl, "stsz")
+	offset := int(u32(findBox(t, stbl, "stco"), 8))
+	if offset != mdat.offset+8 {
+		t.Fatalf("chunk offset = %d, mdat payload at %d", offset, mdat.offset+8)
+	}
+	if n := u32(stsz, 8); n != 6 {
+		t.Fatalf("stsz has %d samples, want 6", n)
+	}
+	for i := range 6 {
+		size := int(u32(stsz, 12+4*i))
+		nal := got[offset+4 : offset+size]
+		if int(u32(got, offset)) != len(nal) {
+			t.Errorf("sample %d: NAL length %d, want %d", i, u32(got, offset), len(nal))
+		}
+		wantType := byte(0x41)
+		if i%3 == 0 {
+			wantType = 0x65
+		}
+		if nal[0] != wantType || !bytes.Equal(nal[1:], testPayload(200+i*150, byte(i))) {
+			t.Errorf("sample %d does not hold its slice", i)
+		}
+		offset += size
+	}
+
+	want, err := os.ReadFile(mp4Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s, rerun with -update after checking the change", mp4Path)
+	}
+}
@@ -0,0 +1,204 @@
+package remux
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+
+	streamTypeH264 = 0x1B
+	streamTypeHEVC = 0x24
+
+	ptsWrap = int64(1) << 33
+)
+
+// ErrNoVideo is returned when the stream has no supported video track
+var ErrNoVideo = errors.New("no H.264 or HEVC stream found")
+
+// accessUnit is one PES payload of the video stream
+type accessUnit struct {
+	pts, dts int64 // 90 kHz, unwrapped
+	data     []byte
+}
+
+type demuxer struct {
+	pmtPID     int
+	videoPID   int
+	streamType byte
+
+	pes       []byte
+	units     []accessUnit
+	dtsOffset int64
+	lastDTS   int64
+	haveDTS   bool
+}
+
+// demuxTS extracts the video access units of an MPEG-TS byte stream. The
+// stream may start and end mid-packet, as a ring buffer snapshot does.
+func demuxTS(data []byte) (byte, []accessUnit, error) {
+	start := findSync(data)
+	if start < 0 {
+		return 0, nil, fmt.Errorf("no transport stream sync found")
+	}
+
+	d := &demuxer{pmtPID: -1, videoPID: -1}
+
+	pos := start
+	for ; pos+tsPacketSize <= len(data); pos += tsPacketSize {
+		pkt := data[pos : pos+tsPacketSize]
+		if pkt[0] != tsSyncByte {
+			// Lost sync, look for the next packet boundary
+			next := findSync(data[pos+1:])
+			if next < 0 {
+				break
+			}
+			pos += 1 + next - tsPacketSize
+			continue
+		}
+		d.packet(pkt)
+	}
+
+	// Keep the last PES only if the stream ends on a packet boundary, a
+	// trailing partial packet means it was cut short
+	if pos == len(data) {
+		d.flush()
+	}
+
+	if d.videoPID < 0 {
+		return 0, nil, ErrNoVideo
+	}
+	return d.streamType, d.units, nil
+}
+
+// findSync returns the offset of the first packet followed by two more
+// packets starting with the sync byte
+func findSync(data []byte) int {
+	for i := 0; i+2*tsPacketSize < len(data); i++ {
+		if data[i] == tsSyncByte && data[i+tsPacketSize] == tsSyncByte && data[i+2*tsPacketSize] == tsSyncByte {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *demuxer) packet(pkt []byte) {
+	unitStart := pkt[1]&0x40 != 0
+	pid := int(pkt[1]&0x1F)<<8 | int(pkt[2])
+	afc := (pkt[3] >> 4) & 0x03
+
+	if afc&0x01 == 0 {
+		return // no payload
+	}
+
+	offset := 4
+	if afc&0x02 != 0 {
+		offset += 1 + int(pkt[4])
+	}
+	if offset >= tsPacketSize {
+		return
+	}
+	payload := pkt[offset:]
+
+	switch {
+	case pid == 0:
+		if unitStart {
+			d.parsePAT(psiSection(payload))
+		}
+	case pid == d.pmtPID:
+		if unitStart && d.videoPID < 0 {
+			d.parsePMT(psiSection(payload))
+		}
+	case pid == d.videoPID:
+		if unitStart {
+			d.flush()
+			d.pes = append(d.pes[:0:0], payload...)
+		} else if d.pes != nil {
+			d.pes = append(d.pes, payload...)
+		}
+	}
+}
+
+// psiSection skips the pointer field of a PSI payload
+func psiSection(payload []byte) []byte {
+	ptr := int(payload[0])
+	if 1+ptr >= len(payload) {
+		return nil
+	}
+	return payload[1+ptr:]
+}
+
+func (d *demuxer) parsePAT(s []byte) {
+	if len(s) < 8 || s[0] != 0x00 {
+		return
+	}
+	end := min(3+(int(s[1]&0x0F)<<8|int(s[2]))-4, len(s))
+	for i := 8; i+4 <= end; i += 4 {
+		program := int(s[i])<<8 | int(s[i+1])
+		if program != 0 {
+			d.pmtPID = int(s[i+2]&0x1F)<<8 | int(s[i+3])
+			return
+		}
+	}
+}
+
+func (d *demuxer) parsePMT(s []byte) {
+	if len(s) < 12 || s[0] != 0x02 {
+		return
+	}
+	end := min(3+(int(s[1]&0x0F)<<8|int(s[2]))-4, len(s))
+	i := 12 + (int(s[10]&0x0F)<<8 | int(s[11]))
+	for ; i+5 <= end; i += 5 + (int(s[i+3]&0x0F)<<8 | int(s[i+4])) {
+		streamType := s[i]
+		if streamType == streamTypeH264 || streamType == streamTypeHEVC {
+			d.streamType = streamType
+			d.videoPID = int(s[i+1]&0x1F)<<8 | int(s[i+2])
+			return
+		}
+	}
+}
+
+// flush turns the collected PES packet into an access unit
+func (d *demuxer) flush() {
+	pes := d.pes
+	d.pes = nil
+	if len(pes) < 9 || pes[0] != 0 || pes[1] != 0 || pes[2] != 1 {
+		return
+	}
+
+	flags := pes[7] >> 6
+	headerLen := int(pes[8])
+	if 9+headerLen > len(pes) || flags&0x02 == 0 {
+		return // no PTS, can't place the frame
+	}
+
+	pts := readTimestamp(pes[9:])
+	dts := pts
+	if flags == 0x03 && headerLen >= 10 {
+		dts = readTimestamp(pes[14:])
+	}
+
+	// Unwrap the 33-bit clock
+	dts += d.dtsOffset
+	if d.haveDTS && dts < d.lastDTS-ptsWrap/2 {
+		d.dtsOffset += ptsWrap
+		dts += ptsWrap
+	}
+	pts += d.dtsOffset
+	if pts < dts-ptsWrap/2 {
+		pts += ptsWrap
+	}
+	d.lastDTS, d.haveDTS = dts, true
+
+	d.units = append(d.units, accessUnit{pts: pts, dts: dts, data: pes[9+headerLen:]})
+}
+
+func readTimestamp(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 |
+		int64(b[1])<<22 |
+		int64(b[2]>>1)<<15 |
+		int64(b[3])<<7 |
+		int64(b[4]>>1)
+}
@@ -0,0 +1,267 @@
+package remux
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const (
+	testPMTPID   = 0x1000
+	testVideoPID = 0x100
+	testAudioPID = 0x101
+)
+
+// tsMuxer writes transport stream packets for tests
+type tsMuxer struct {
+	out []byte
+	cc  map[int]byte
+}
+
+func newTSMuxer() *tsMuxer {
+	return &tsMuxer{cc: map[int]byte{}}
+}
+
+// packet writes one packet, padding short payloads with adaptation field
+// stuffing the way muxers do for the last packet of a PES
+func (m *tsMuxer) packet(pid int, unitStart bool, payload []byte) {
+	pkt := []byte{tsSyncByte, byte(pid>>8) & 0x1F, byte(pid), 0x10 | m.cc[pid]}
+	if unitStart {
+		pkt[1] |= 0x40
+	}
+	m.cc[pid] = (m.cc[pid] + 1) & 0x0F
+
+	if n := tsPacketSize - 4 - len(payload); n > 0 {
+		pkt[3] |= 0x20
+		pkt = append(pkt, byte(n-1))
+		if n > 1 {
+			pkt = append(pkt, 0x00) // no adaptation flags
+			pkt = append(pkt, bytes.Repeat([]byte{0xFF}, n-2)...)
+		}
+	}
+	m.out = append(m.out, append(pkt, payload...)...)
+}
+
+// psi writes a PSI section with a zero pointer field
+func (m *tsMuxer) psi(pid int, section []byte) {
+	m.packet(pid, true, append([]byte{0}, section...))
+}
+
+// pat writes a program association table with a single program
+func (m *tsMuxer) pat(pmtPID int) {
+	s := []byte{0x00, 0xB0, 13, 0, 1, 0xC1, 0, 0}
+	s = append(s, 0, 0, 0xE0, 0x10) // network PID entry, skipped
+	s = append(s, 0, 1, 0xE0|byte(pmtPID>>8), byte(pmtPID))
+	s = append(s, 0, 0, 0, 0) // CRC, not checked
+	s[2] = byte(len(s) - 3)
+	m.psi(0, s)
+}
+
+// pmt writes a program map table listing the given (stream type, PID)
+// pairs. Every stream carries a 3-byte descriptor to exercise the ES loop.
+func (m *tsMuxer) pmt(pmtPID int, streams ...[2]int) {
+	s := []byte{0x02, 0xB0, 0, 0, 1, 0xC1, 0, 0, 0xE1, 0x00, 0xF0, 0}
+	for _, st := range streams {
+		s = append(s, byte(st[0]), 0xE0|byte(st[1]>>8), byte(st[1]), 0xF0, 3, 0x0A, 1, 0)
+	}
+	s = append(s, 0, 0, 0, 0)
+	s[2] = byte(len(s) - 3)
+	m.psi(pmtPID, s)
+}
+
+// pes writes an access unit as a PES packet split across as many packets as
+// it needs. The DTS is left out when it equals the PTS.
+func (m *tsMuxer) pes(pid int, au accessUnit) {
+	header := []byte{0, 0, 1, 0xE0, 0, 0, 0x80}
+	if au.dts == au.pts {
+		header = append(header, 0x80, 5)
+		header = appendTimestamp(header, 0x2, au.pts)
+	} else {
+		header = append(header, 0xC0, 10)
+		header = appendTimestamp(header, 0x3, au.pts)
+		header = appendTimestamp(header, 0x1, au.dts)
+	}
+
+	data := append(header, au.data...)
+	for first := true; len(data) > 0; first = false {
+		n := min(len(data), tsPacketSize-4)
+		m.packet(pid, first, data[:n])
+		data = data[n:]
+	}
+}
+
+func appendTimestamp(b []byte, prefix byte, ts int64) []byte {
+	ts &= ptsWrap - 1
+	return append(b,
+		prefix<<4|byte(ts>>29)&0x0E|1,
+		byte(ts>>22),
+		byte(ts>>14)&0xFE|1,
+		byte(ts>>7),
+		byte(ts<<1)|1,
+	)
+}
+
+// testPayload returns n bytes without start code emulation
+func testPayload(n int, seed byte) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i+int(seed))%251 + 1
+	}
+	return b
+}
+
+// videoTS muxes units into a stream with an audio track listed and
+// interleaved ahead of the video
+func videoTS(streamType byte, units []accessUnit) []byte {
+	m := newTSMuxer()
+	m.pat(testPMTPID)
+	m.pmt(testPMTPID, [2]int{0x0F, testAudioPID}, [2]int{int(streamType), testVideoPID})
+	for _, au := range units {
+		m.pes(testVideoPID, au)
+		m.packet(testAudioPID, true, testPayload(100, 7))
+	}
+	return m.out
+}
+
+func TestDemuxTS(t *testing.T) {
+	units := []accessUnit{
+		{pts: 3000, dts: 0, data: testPayload(500, 1)},
+		{pts: 12000, dts: 3000, data: testPayload(184, 2)},
+		{pts: 6000, dts: 6000, data: testPayload(10, 3)},
+		{pts: 9000, dts: 9000, data: testPayload(1000, 4)},
+	}
+
+	tests := []struct {
+		name     string
+		ts       func() []byte
+		wantType byte
+		want     []accessUnit
+		wantErr  error
+	}{
+		{
+			name:     "pes across packets",
+			ts:       func() []byte { return videoTS(streamTypeH264, units) },
+			wantType: streamTypeH264,
+			want:     units,
+		},
+		{
+			name:     "hevc",
+			ts:       func() []byte { return videoTS(streamTypeHEVC, units[:2]) },
+			wantType: streamTypeHEVC,
+			want:     units[:2],
+		},
+		{
+			name: "starts mid packet",
+			ts: func() []byte {
+				return append(testPayload(100, 9), videoTS(streamTypeH264, units)...)
+			},
+			wantType: streamTypeH264,
+			want:     units,
+		},
+		{
+			name: "trailing partial packet drops the last unit",
+			ts: func() []byte {
+				m := newTSMuxer()
+				m.pat(testPMTPID)
+				m.pmt(testPMTPID, [2]int{streamTypeH264, testVideoPID})
+				for _, au := range units {
+					m.pes(testVideoPID, au)
+				}
+				return m.out[:len(m.out)-50]
+			},
+			wantType: streamTypeH264,
+			want:     units[:3],
+		},
+		{
+			name: "resyncs after garbage",
+			ts: func() []byte {
+				m := newTSMuxer()
+				m.pat(testPMTPID)
+				m.pmt(testPMTPID, [2]int{streamTypeH264, testVideoPID})
+				m.pes(testVideoPID, units[0])
+				m.out = append(m.out, 1, 2, 3, 4, 5, 6, 7)
+				for _, au := range units[1:] {
+					m.pes(testVideoPID, au)
+				}
+				return m.out
+			},
+			wantType: streamTypeH264,
+			want:     units,
+		},
+		{
+			name: "video before the PAT is skipped",
+			ts: func() []byte {
+				m := newTSMuxer()
+				m.pes(testVideoPID, units[0])
+				m.pat(testPMTPID)
+				m.pmt(testPMTPID, [2]int{streamTypeH264, testVideoPID})
+				for _, au := range units[1:] {
+					m.pes(testVideoPID, au)
+				}
+				return m.out
+			},
+			wantType: streamTypeH264,
+			want:     units[1:],
+		},
+		{
+			name: "timestamps unwrap",
+			ts: func() []byte {
+				return videoTS(streamTypeH264, []accessUnit{
+					{pts: ptsWrap, dts: ptsWrap - 3000, data: testPayload(20, 1)},
+					{pts: ptsWrap + 3000, dts: ptsWrap, data: testPayload(20, 2)},
+					{pts: ptsWrap + 6000, dts: ptsWrap + 3000, data: testPayload(20, 3)},
+				})
+			},
+			wantType: streamTypeH264,
+			want: []accessUnit{
+				{pts: ptsWrap, dts: ptsWrap - 3000, data: testPayload(20, 1)},
+				{pts: ptsWrap + 3000, dts: ptsWrap, data: testPayload(20, 2)},
+				{pts: ptsWrap + 6000, dts: ptsWrap + 3000, data: testPayload(20, 3)},
+			},
+		},
+		{
+			name: "audio only",
+			ts: func() []byte {
+				m := newTSMuxer()
+				m.pat(testPMTPID)
+				m.pmt(testPMTPID, [2]int{0x0F, testAudioPID})
+				for range 3 {
+					m.packet(testAudioPID, true, testPayload(100, 0))
+				}
+				return m.out
+			},
+			wantErr: ErrNoVideo,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streamType, got, err := demuxTS(tt.ts())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("demuxTS() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if streamType != tt.wantType {
+				t.Errorf("stream type = %#x, want %#x", streamType, tt.wantType)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %d units, want %d", len(got), len(tt.want))
+				for i := range min(len(got), len(tt.want)) {
+					if !reflect.DeepEqual(got[i], tt.want[i]) {
+						t.Errorf("unit %d: pts %d dts %d len %d, want pts %d dts %d len %d", i,
+							got[i].pts, got[i].dts, len(got[i].data), tt.want[i].pts, tt.want[i].dts, len(tt.want[i].data))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDemuxTSNoSync(t *testing.T) {
+	if _, _, err := demuxTS(testPayload(1000, 0)); err == nil {
+		t.Fatal("expected an error for data without sync bytes")
+	}
+}
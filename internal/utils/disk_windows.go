@@ -0,0 +1,27 @@
+//go:build windows
+
+package utils
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceExW = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// FreeDiskSpace returns the bytes available to the current user on the
+// volume that holds path
+func FreeDiskSpace(path string) (uint64, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var free uint64
+	ret, _, callErr := procGetDiskFreeSpaceExW.Call(uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&free)), 0, 0)
+	if ret == 0 {
+		return 0, fmt.Errorf("GetDiskFreeSpaceExW failed: %w", callErr)
+	}
+	return free, nil
+}
@@ -3,13 +3,23 @@
 package utils
 
 import (
+	"context"
 	"os/exec"
 	"syscall"
 )
 
 // Command creates a command that won't show a console window on Windows
 func Command(name string, args ...string) *exec.Cmd {
-	cmd := exec.Command(name, args...)
+	return hideWindow(exec.Command(name, args...))
+}
+
+// CommandContext is Command with a context that kills the process when it
+// is done
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	return hideWindow(exec.CommandContext(ctx, name, args...))
+}
+
+func hideWindow(cmd *exec.Cmd) *exec.Cmd {
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		HideWindow:    true,
 		CreationFlags: 0x08000000, // CREATE_NO_WINDOW
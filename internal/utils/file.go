@@ -0,0 +1,17 @@
+package utils
+
+import "os"
+
+// PartSuffix marks a file that is still being written
+const PartSuffix = ".part"
+
+// WriteFileAtomic writes data next to path and renames it into place, so a
+// crash never leaves a truncated file behind
+func WriteFileAtomic(path string, data []byte) error {
+	partPath := path + PartSuffix
+	if err := os.WriteFile(partPath, data, 0644); err != nil {
+		os.Remove(partPath)
+		return err
+	}
+	return os.Rename(partPath, path)
+}
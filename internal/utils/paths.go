@@ -7,6 +7,10 @@ import (
 
 const AppName = "Rewind"
 
+// AppVersion is stamped into clip metadata. Overridden at build time with
+// -ldflags "-X rewind/internal/utils.AppVersion=..."
+var AppVersion = "1.0.1"
+
 func GetAppDataDir() (string, error) {
 	localAppData, err := os.UserCacheDir()
 	if err != nil {
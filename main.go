@@ -11,6 +11,8 @@ import (
 	"path/filepath"
 
 	"rewind/internal/app"
+	"rewind/internal/cli"
+	bus "rewind/internal/events"
 	"rewind/internal/input"
 	"rewind/internal/logging"
 
@@ -66,6 +68,7 @@ type TrayManager struct {
 	statusItem    *application.MenuItem
 	startStopItem *application.MenuItem
 	saveItem      *application.MenuItem
+	markerItem    *application.MenuItem
 	showHideItem  *application.MenuItem
 }
 
@@ -130,6 +133,15 @@ func (t *TrayManager) createMenu() {
 		}
 	})
 
+	// Drop Marker
+	t.markerItem = t.menu.Add("Drop Marker")
+	t.markerItem.SetEnabled(false)
+	t.markerItem.OnClick(func(ctx *application.Context) {
+		if t.rewindApp.IsRecording() {
+			t.rewindApp.AddMarker("")
+		}
+	})
+
 	t.menu.AddSeparator()
 
 	// Show/Hide Window
@@ -167,19 +179,36 @@ func (t *TrayManager) createMenu() {
 }
 
 func (t *TrayManager) UpdateState() {
-	isRecording := t.rewindApp.IsRecording()
-	slog.Info("updating tray state", "recording", isRecording)
+	state := t.rewindApp.GetState()
+	isRecording := state.Status.Capturing()
+	slog.Info("updating tray state", "status", state.Status, "extending", state.Extending)
 
 	if isRecording {
 		t.systray.SetIcon(appIconRecording)
-		t.statusItem.SetLabel("● Recording")
+		if state.Status == app.StatusSaving {
+			t.statusItem.SetLabel("● Saving")
+		} else {
+			t.statusItem.SetLabel("● Recording")
+		}
 		t.startStopItem.SetLabel("Stop Recording")
 		t.saveItem.SetEnabled(true)
+		t.markerItem.SetEnabled(true)
+		if state.Extending {
+			t.saveItem.SetLabel("Finish Clip")
+		} else {
+			t.saveItem.SetLabel("Save Clip")
+		}
 	} else {
 		t.systray.SetIcon(appIcon)
-		t.statusItem.SetLabel("● Ready")
+		if state.Status == app.StatusError {
+			t.statusItem.SetLabel("● Error")
+		} else {
+			t.statusItem.SetLabel("● Ready")
+		}
 		t.startStopItem.SetLabel("Start Recording")
+		t.saveItem.SetLabel("Save Clip")
 		t.saveItem.SetEnabled(false)
+		t.markerItem.SetEnabled(false)
 	}
 
 	t.menu.Update()
@@ -196,6 +225,17 @@ func (t *TrayManager) UpdateShowHideLabel() {
 }
 
 func main() {
+	// Subcommands run headless, without the window and tray
+	if cli.IsCommand(os.Args[1:]) {
+		os.Exit(cli.Run(os.Args[1:], getFFmpegPath()))
+	}
+
+	// Command flags go to the running instance, which reports the result
+	startupCmd, exitCode, done := cli.Forward(os.Args[1:])
+	if done {
+		os.Exit(exitCode)
+	}
+
 	logPath := logging.GetDefaultLogPath()
 	if err := logging.Setup(logPath, true); err != nil {
 		log.Printf("Failed to setup logging: %v", err)
@@ -214,6 +254,7 @@ func main() {
 	}()
 
 	rewindApp := app.New(ffmpegPath)
+	rewindApp.RunOnStartup(startupCmd)
 
 	var mainWindow *application.WebviewWindow
 
@@ -230,6 +271,22 @@ func main() {
 		SingleInstance: &application.SingleInstanceOptions{
 			UniqueID: "com.emirakts.rewind.single.instance",
 			OnSecondInstanceLaunch: func(data application.SecondInstanceData) {
+				// Commands normally arrive through the control endpoint;
+				// this covers launches that could not reach it
+				if len(data.Args) > 1 && app.HasCommandFlag(data.Args[1:]) {
+					cmd, err := app.ParseCommand(data.Args[1:])
+					if err != nil {
+						slog.Warn("invalid second instance arguments", "args", data.Args, "error", err)
+						return
+					}
+					if !cmd.Empty() {
+						if _, err := rewindApp.RunCommand(cmd); err != nil {
+							slog.Error("second instance command failed", "args", data.Args, "error", err)
+						}
+						return
+					}
+				}
+
 				slog.Info("Second instance launched, bringing window to front", "args", data.Args)
 				if mainWindow != nil {
 					mainWindow.Show()
@@ -242,6 +299,14 @@ func main() {
 	// Store the app instance for events
 	rewindApp.SetApp(appInstance)
 
+	// Answer command flags of later launches
+	control, err := cli.StartControl(rewindApp)
+	if err != nil {
+		slog.Warn("failed to start control endpoint", "error", err)
+	} else {
+		defer control.Close()
+	}
+
 	window := appInstance.Window.NewWithOptions(application.WebviewWindowOptions{
 		Title:            "Rewind",
 		Width:            420,
@@ -291,15 +356,22 @@ func main() {
 		}
 	})
 
+	// Drop Marker: Ctrl+F8
+	hkManager.Register(3, func() {
+		if rewindApp.IsRecording() {
+			rewindApp.AddMarker("")
+		}
+	})
+
 	hkManager.Start()
 	defer hkManager.Stop()
 
-	// Set callback for state changes to update tray
-	rewindApp.SetOnStateChange(func(state app.State) {
+	// Keep the tray in sync with every state transition
+	bus.On(rewindApp.Events(), func(app.StateChanged) {
 		trayManager.UpdateState()
 	})
 
-	err := appInstance.Run()
+	err = appInstance.Run()
 	if err != nil {
 		log.Fatal(err)
 	}